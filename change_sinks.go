@@ -0,0 +1,20 @@
+// Copyright 2020-present Kuei-chun Chen. All rights reserved.
+
+package keyhole
+
+// ChangeSinks stores sinks of change streams
+type ChangeSinks []string
+
+func (p *ChangeSinks) String() string {
+	str := ""
+	for _, sink := range *p {
+		str += "-sink " + sink + " "
+	}
+	return str
+}
+
+// Set sets flag var
+func (p *ChangeSinks) Set(value string) error {
+	*p = append(*p, value)
+	return nil
+}
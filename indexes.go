@@ -3,8 +3,12 @@
 package keyhole
 
 import (
+	"context"
+	"strings"
+
 	"github.com/simagix/keyhole/mdb"
 	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/x/mongo/driver/connstring"
 )
 
 // DuplicateIndexesFromFile duplicate indexes from definitions defined in a file
@@ -34,8 +38,69 @@ func CollectIndexStats(index *mdb.IndexStats, client *mongo.Client, maobiURL str
 		return err
 	}
 	index.PrintIndexesOf(databases)
+	if err = index.RecommendIndexes(client); err != nil {
+		return err
+	}
+	if _, err = index.OutputFormat(); err != nil {
+		return err
+	}
 	if ofile, data, err = index.OutputBSON(); err != nil {
 		return err
 	}
 	return GenerateMaobiReport(maobiURL, data, ofile)
 }
+
+// AdviseIndexes collects index usage of all members and outputs unused and redundant indexes
+func AdviseIndexes(index *mdb.IndexStats, client *mongo.Client, connString connstring.ConnString, hideFirst bool) error {
+	var err error
+	if _, err = index.GetIndexes(client); err != nil {
+		return err
+	}
+	advisor := mdb.NewIndexAdvisor(index)
+	advisor.SetHideFirst(hideFirst)
+	if err = advisor.CollectUsage(client, connString); err != nil {
+		return err
+	}
+	if err = advisor.CollectCosts(client); err != nil {
+		return err
+	}
+	index.Print()
+	advisor.Advise()
+	advisor.Print()
+	if _, err = advisor.OutputDropScript(); err != nil {
+		return err
+	}
+	if err = index.RecommendIndexes(client); err != nil {
+		return err
+	}
+	_, _, err = index.OutputBSON()
+	return err
+}
+
+// PlanIndexes compares indexes of a source, a URI or an -index.bson.gz file, against a target and applies the plan
+func PlanIndexes(src *mdb.IndexStats, index *mdb.IndexStats, client *mongo.Client, source string, isDrop bool, auto bool) error {
+	var err error
+	if strings.HasPrefix(source, "mongodb://") || strings.HasPrefix(source, "mongodb+srv://") {
+		var sclient *mongo.Client
+		if sclient, err = mdb.NewMongoClient(source); err != nil {
+			return err
+		}
+		defer sclient.Disconnect(context.Background())
+		if _, err = src.GetIndexes(sclient); err != nil {
+			return err
+		}
+	} else if err = src.SetClusterDetailsFromFile(source); err != nil {
+		return err
+	}
+	if _, err = index.GetIndexes(client); err != nil {
+		return err
+	}
+	planner := mdb.NewIndexPlanner(src, index)
+	planner.SetDropExtra(isDrop)
+	planner.Plan()
+	if err = planner.EstimateSizes(client); err != nil {
+		return err
+	}
+	planner.Print()
+	return planner.Apply(client, auto)
+}
@@ -19,6 +19,9 @@ func AnalyzeMongoLogs(loginfo *mdb.LogInfo, filenames []string, maobiURL string)
 			continue
 		}
 		loginfo.Print()
+		if _, err = loginfo.OutputFormat(); err != nil {
+			fmt.Println(err)
+		}
 		if ofile, data, err = loginfo.OutputBSON(); err != nil {
 			fmt.Println(err)
 			continue
@@ -29,3 +32,47 @@ func AnalyzeMongoLogs(loginfo *mdb.LogInfo, filenames []string, maobiURL string)
 	}
 	return err
 }
+
+// FanOutMongoLogs a helper function to correlate a mongos log with shards logs
+func FanOutMongoLogs(loginfo *mdb.LogInfo, filenames []string) error {
+	if len(filenames) < 2 {
+		return fmt.Errorf("a mongos log and logs of shards are required")
+	}
+	fanout := mdb.NewLogFanOut(loginfo)
+	if err := fanout.AnalyzeFiles(filenames); err != nil {
+		return err
+	}
+	fanout.Print()
+	return nil
+}
+
+// MergeMongoLogs a helper function to analyze logs and merge results into one
+func MergeMongoLogs(loginfo *mdb.LogInfo, filenames []string, maobiURL string) error {
+	var err error
+	var data []byte
+	var ofile string
+	if err = loginfo.MergeFiles(filenames); err != nil {
+		return err
+	}
+	loginfo.Print()
+	if _, err = loginfo.OutputFormat(); err != nil {
+		return err
+	}
+	if ofile, data, err = loginfo.OutputBSON(); err != nil {
+		return err
+	}
+	return GenerateMaobiReport(maobiURL, data, ofile)
+}
+
+// DiffMongoLogs a helper function to compare query patterns of two logs
+func DiffMongoLogs(loginfo *mdb.LogInfo, filenames []string) error {
+	if len(filenames) != 2 {
+		return fmt.Errorf("two log files or two -log.bson.gz files are required")
+	}
+	diff := mdb.NewLogDiff(loginfo)
+	if err := diff.Compare(filenames[0], filenames[1]); err != nil {
+		return err
+	}
+	diff.Print()
+	return nil
+}
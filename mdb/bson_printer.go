@@ -17,6 +17,7 @@ import (
 
 // BSONPrinter stores bson printer info
 type BSONPrinter struct {
+	format  string
 	nocolor bool
 	version string
 }
@@ -26,6 +27,11 @@ func NewBSONPrinter(version string) *BSONPrinter {
 	return &BSONPrinter{version: version}
 }
 
+// SetFormat sets output format, json, csv, prom, or html
+func (p *BSONPrinter) SetFormat(format string) {
+	p.format = format
+}
+
 // SetNoColor set nocolor flag
 func (p *BSONPrinter) SetNoColor(nocolor bool) {
 	p.nocolor = nocolor
@@ -62,6 +68,10 @@ func (p *BSONPrinter) Print(filename string) error {
 			return err
 		}
 		li.Print()
+		li.SetFormat(p.format)
+		if _, err = li.OutputFormat(); err != nil {
+			return err
+		}
 		if err = li.OutputJSON(); err != nil {
 			return err
 		}
@@ -71,6 +81,10 @@ func (p *BSONPrinter) Print(filename string) error {
 			return err
 		}
 		ix.Print()
+		ix.SetFormat(p.format)
+		if _, err = ix.OutputFormat(); err != nil {
+			return err
+		}
 		if err = ix.OutputJSON(); err != nil {
 			return err
 		}
@@ -95,6 +109,10 @@ func (p *BSONPrinter) Print(filename string) error {
 				return err
 			}
 			cluster.Print()
+			cluster.SetFormat(p.format)
+			if _, err = cluster.OutputFormat(); err != nil {
+				return err
+			}
 		}
 		os.Mkdir(outdir, 0755)
 		ofile := filepath.Base(filename)
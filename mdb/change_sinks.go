@@ -0,0 +1,268 @@
+// Copyright 2020-present Kuei-chun Chen. All rights reserved.
+
+package mdb
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+const (
+	defaultRotateSize = 100 * 1024 * 1024 // bytes of a JSONL file before rotation
+	webhookTimeout    = 30 * time.Second
+)
+
+// ChangeSink receives change events.  Events written are durable after Flush, and
+// the resume token is saved only after all sinks are flushed.
+type ChangeSink interface {
+	Close() error
+	Flush() error
+	Name() string
+	Write(event bson.Raw) error
+}
+
+// NewChangeSink returns a sink by spec, jsonl:{file}[:maxMB], bson:{file}, a webhook URL, or - for stdout
+func NewChangeSink(spec string) (ChangeSink, error) {
+	if spec == "-" {
+		return &JSONLSink{writer: bufio.NewWriter(os.Stdout)}, nil
+	} else if strings.HasPrefix(spec, "http://") || strings.HasPrefix(spec, "https://") {
+		return &WebhookSink{client: &http.Client{Timeout: webhookTimeout}, url: spec}, nil
+	} else if strings.HasPrefix(spec, "jsonl:") {
+		var maxMB int
+		filename := strings.TrimPrefix(spec, "jsonl:")
+		if i := strings.LastIndex(filename, ":"); i > 0 {
+			if _, err := fmt.Sscanf(filename[i+1:], "%d", &maxMB); err == nil {
+				filename = filename[:i]
+			}
+		}
+		return NewJSONLSink(filename, int64(maxMB)*1024*1024)
+	} else if strings.HasPrefix(spec, "bson:") {
+		return NewBSONSink(strings.TrimPrefix(spec, "bson:"))
+	}
+	return nil, fmt.Errorf("unsupported sink %v, use jsonl:{file}[:maxMB], bson:{file}, a URL, or -", spec)
+}
+
+// JSONLSink writes events in relaxed extended JSON, a line each, and rotates files by size
+type JSONLSink struct {
+	file     *os.File
+	filename string
+	maxSize  int64
+	size     int64
+	writer   *bufio.Writer
+}
+
+// NewJSONLSink returns *JSONLSink appending to a file, rotated at maxSize bytes, 100MB if 0
+func NewJSONLSink(filename string, maxSize int64) (*JSONLSink, error) {
+	if maxSize <= 0 {
+		maxSize = defaultRotateSize
+	}
+	s := &JSONLSink{filename: filename, maxSize: maxSize}
+	return s, s.open()
+}
+
+func (s *JSONLSink) open() error {
+	var err error
+	if s.file, err = os.OpenFile(s.filename, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644); err != nil {
+		return err
+	}
+	fi, _ := s.file.Stat()
+	s.size = fi.Size()
+	s.writer = bufio.NewWriter(s.file)
+	return nil
+}
+
+// rotate renames the current file with a timestamp and opens a new one
+func (s *JSONLSink) rotate() error {
+	if err := s.Close(); err != nil {
+		return err
+	}
+	ext := ".jsonl"
+	if !strings.HasSuffix(s.filename, ext) {
+		ext = ""
+	}
+	rotated := fmt.Sprintf("%v-%v%v", strings.TrimSuffix(s.filename, ext), time.Now().Format("20060102-150405.000"), ext)
+	if err := os.Rename(s.filename, rotated); err != nil {
+		return err
+	}
+	return s.open()
+}
+
+// Close flushes and closes the file
+func (s *JSONLSink) Close() error {
+	if err := s.Flush(); err != nil {
+		return err
+	}
+	if s.file != nil {
+		return s.file.Close()
+	}
+	return nil
+}
+
+// Flush flushes buffered events to the file
+func (s *JSONLSink) Flush() error {
+	if err := s.writer.Flush(); err != nil {
+		return err
+	}
+	if s.file != nil {
+		return s.file.Sync()
+	}
+	return nil
+}
+
+// Name returns the sink name
+func (s *JSONLSink) Name() string {
+	if s.file == nil {
+		return "stdout"
+	}
+	return "jsonl:" + s.filename
+}
+
+// Write writes an event
+func (s *JSONLSink) Write(event bson.Raw) error {
+	data, err := bson.MarshalExtJSON(event, false, false)
+	if err != nil {
+		return err
+	}
+	if s.file != nil && s.size > 0 && s.size+int64(len(data))+1 > s.maxSize {
+		if err = s.rotate(); err != nil {
+			return err
+		}
+	}
+	n, err := s.writer.Write(append(data, '\n'))
+	s.size += int64(n)
+	return err
+}
+
+// BSONSink appends events to a BSON file, readable by bsondump, gzipped if ending with .gz
+type BSONSink struct {
+	file     *os.File
+	filename string
+	gzip     *gzip.Writer
+	writer   io.Writer
+}
+
+// NewBSONSink returns *BSONSink.  A new gzip member is appended to an existing .gz file.
+func NewBSONSink(filename string) (*BSONSink, error) {
+	var err error
+	s := &BSONSink{filename: filename}
+	if s.file, err = os.OpenFile(filename, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644); err != nil {
+		return nil, err
+	}
+	s.writer = s.file
+	if strings.HasSuffix(filename, ".gz") {
+		s.gzip = gzip.NewWriter(s.file)
+		s.writer = s.gzip
+	}
+	return s, nil
+}
+
+// Close flushes and closes the file
+func (s *BSONSink) Close() error {
+	if s.gzip != nil {
+		if err := s.gzip.Close(); err != nil {
+			return err
+		}
+	}
+	return s.file.Close()
+}
+
+// Flush flushes compressed data to the file
+func (s *BSONSink) Flush() error {
+	if s.gzip != nil {
+		if err := s.gzip.Flush(); err != nil {
+			return err
+		}
+	}
+	return s.file.Sync()
+}
+
+// Name returns the sink name
+func (s *BSONSink) Name() string {
+	return "bson:" + s.filename
+}
+
+// Write writes an event
+func (s *BSONSink) Write(event bson.Raw) error {
+	_, err := s.writer.Write(event)
+	return err
+}
+
+// WebhookSink posts batches of events as a JSON array to a URL
+type WebhookSink struct {
+	buffer [][]byte
+	client *http.Client
+	url    string
+}
+
+// Close posts remaining events
+func (s *WebhookSink) Close() error {
+	return s.Flush()
+}
+
+// Flush posts buffered events, an error if the response is not 2xx.  Events are dropped
+// even if failed because they are replayed from the saved token after resuming.
+func (s *WebhookSink) Flush() error {
+	if len(s.buffer) == 0 {
+		return nil
+	}
+	body := append([]byte{'['}, bytes.Join(s.buffer, []byte{','})...)
+	body = append(body, ']')
+	s.buffer = nil
+	resp, err := s.client.Post(s.url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook %v returned %v", s.url, resp.Status)
+	}
+	return nil
+}
+
+// Reset drops buffered events not posted
+func (s *WebhookSink) Reset() {
+	s.buffer = nil
+}
+
+// Name returns the sink name
+func (s *WebhookSink) Name() string {
+	return s.url
+}
+
+// Write buffers an event until Flush
+func (s *WebhookSink) Write(event bson.Raw) error {
+	data, err := bson.MarshalExtJSON(event, false, false)
+	if err != nil {
+		return err
+	}
+	s.buffer = append(s.buffer, data)
+	return nil
+}
+
+// callbackSink calls a function of each event
+type callbackSink struct {
+	cb callback
+}
+
+func (s *callbackSink) Close() error { return nil }
+func (s *callbackSink) Flush() error { return nil }
+func (s *callbackSink) Name() string { return "callback" }
+
+func (s *callbackSink) Write(event bson.Raw) error {
+	var doc bson.M
+	if err := bson.Unmarshal(event, &doc); err != nil {
+		return err
+	}
+	s.cb(doc)
+	return nil
+}
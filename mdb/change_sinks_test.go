@@ -0,0 +1,166 @@
+// Copyright 2020-present Kuei-chun Chen. All rights reserved.
+
+package mdb
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+func getChangeEvent(t *testing.T, i int) bson.Raw {
+	data, err := bson.Marshal(bson.D{{Key: "_id", Value: bson.M{"_data": "8263"}}, {Key: "operationType", Value: "insert"},
+		{Key: "fullDocument", Value: bson.M{"_id": int32(i), "city": "Atlanta"}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func TestJSONLSink(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "changes.jsonl")
+	sink, err := NewJSONLSink(filename, 200)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 5; i++ {
+		if err = sink.Write(getChangeEvent(t, i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err = sink.Close(); err != nil {
+		t.Fatal(err)
+	}
+	files, _ := filepath.Glob(filepath.Join(filepath.Dir(filename), "changes*.jsonl"))
+	if len(files) < 2 {
+		t.Fatal("expected rotated files, but got", files)
+	}
+	file, _ := os.Open(filename)
+	defer file.Close()
+	scanner := bufio.NewScanner(file)
+	if !scanner.Scan() {
+		t.Fatal("expected events in", filename)
+	}
+	var doc bson.M
+	if err = bson.UnmarshalExtJSON(scanner.Bytes(), false, &doc); err != nil || doc["operationType"] != "insert" {
+		t.Fatal("unexpected event", scanner.Text(), err)
+	}
+
+	if _, err = NewChangeSink("kafka:topic"); err == nil {
+		t.Fatal("expected error")
+	}
+}
+
+func TestBSONSink(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "changes.bson.gz")
+	for i := 0; i < 2; i++ { // appends a gzip member
+		sink, err := NewChangeSink("bson:" + filename)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sink.Write(getChangeEvent(t, i))
+		if err = sink.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	file, _ := os.Open(filename)
+	defer file.Close()
+	reader, err := gzip.NewReader(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, _ := io.ReadAll(reader)
+	count := 0
+	for len(data) > 0 {
+		doc := bson.Raw(data[:binary.LittleEndian.Uint32(data)])
+		if err = doc.Validate(); err != nil {
+			t.Fatal(err)
+		}
+		data = data[len(doc):]
+		count++
+	}
+	if count != 2 {
+		t.Fatal("expected 2 events, but got", count)
+	}
+}
+
+func TestWebhookSink(t *testing.T) {
+	var events []map[string]interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewDecoder(r.Body).Decode(&events)
+	}))
+	defer server.Close()
+	sink, err := NewChangeSink(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sink.Write(getChangeEvent(t, 1))
+	sink.Write(getChangeEvent(t, 2))
+	if err = sink.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 2 || events[1]["operationType"] != "insert" {
+		t.Fatal("unexpected events", events)
+	}
+
+	failed := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer failed.Close()
+	webhook := &WebhookSink{client: http.DefaultClient, url: failed.URL}
+	webhook.Write(getChangeEvent(t, 3))
+	if err = webhook.Flush(); err == nil {
+		t.Fatal("expected an error of 503")
+	}
+	if len(webhook.buffer) != 0 {
+		t.Fatal("expected events of a failed post dropped, but got", len(webhook.buffer))
+	}
+}
+
+func TestIsResumableChangeStreamError(t *testing.T) {
+	if isResumableChangeStreamError(mongo.CommandError{Code: 13, Name: "Unauthorized"}) {
+		t.Fatal("expected Unauthorized not resumable")
+	}
+	if !isResumableChangeStreamError(mongo.CommandError{Code: 91, Name: "ShutdownInProgress"}) {
+		t.Fatal("expected ShutdownInProgress resumable")
+	}
+	if !isResumableChangeStreamError(mongo.CommandError{Code: 1, Labels: []string{resumableErrorLabel}}) {
+		t.Fatal("expected a labeled error resumable")
+	}
+	if !isResumableChangeStreamError(&sinkError{err: errors.New("timeout"), name: "webhook"}) {
+		t.Fatal("expected a sink error resumable")
+	}
+}
+
+func TestResumeToken(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "resume.json")
+	token, err := ReadResumeToken(filename)
+	if err != nil || token != nil {
+		t.Fatal("expected no token", token, err)
+	}
+	data, _ := bson.Marshal(bson.M{"_data": "82635F4C2B000000012B022C0100296E5A1004"})
+	if err = SaveResumeToken(filename, data); err != nil {
+		t.Fatal(err)
+	}
+	if token, err = ReadResumeToken(filename); err != nil {
+		t.Fatal(err)
+	}
+	if token.Lookup("_data").StringValue() != "82635F4C2B000000012B022C0100296E5A1004" {
+		t.Fatal("unexpected token", token)
+	}
+	cs := NewChangeStream()
+	if err = cs.SetFullDocumentBeforeChange("always"); err == nil {
+		t.Fatal("expected error")
+	}
+}
@@ -0,0 +1,228 @@
+// Copyright 2020-present Kuei-chun Chen. All rights reserved.
+
+package mdb
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+const (
+	expensiveLookupBytes = 16 * 1024 // a looked up document at least this large is expensive
+	expensiveLookupRatio = 10        // or at least this many times of its update description
+	lagWarningRatio      = 0.5       // of the oplog window
+	statsPrintInterval   = 10 * time.Second
+)
+
+// ChangeEventStats stores stats of events of a namespace and an operation type
+type ChangeEventStats struct {
+	Bytes         int64         `bson:"bytes"`
+	Count         int64         `bson:"count"`
+	Namespace     string        `bson:"ns"`
+	OperationType string        `bson:"operationType"`
+	Sizes         LatencySketch `bson:"sizes"`
+}
+
+// UpdateLookupStats stores costs of looking up current documents of update events
+type UpdateLookupStats struct {
+	DeltaBytes  int64 `bson:"deltaBytes"` // bytes of update descriptions
+	Expensive   int64 `bson:"expensive"`
+	LookupBytes int64 `bson:"lookupBytes"` // bytes of looked up documents
+	Missing     int64 `bson:"missing"`     // documents deleted before lookups
+	Updates     int64 `bson:"updates"`
+}
+
+// ChangeStreamStats measures throughput, lag, sizes, and update lookups of change events.
+// It is a ChangeSink and prints a summary periodically and when closed.
+type ChangeStreamStats struct {
+	Begin       time.Time                    `bson:"begin"`
+	Events      map[string]*ChangeEventStats `bson:"events"`
+	Lag         LatencySketch                `bson:"lag"` // milliseconds behind wall-clock time
+	Lookups     UpdateLookupStats            `bson:"lookups"`
+	MaxLag      time.Duration                `bson:"maxLag"`
+	OplogWindow int64                        `bson:"oplogWindow"` // seconds
+	Sizes       LatencySketch                `bson:"sizes"`       // bytes
+
+	pending []pendingEvent // events since the last Flush, dropped by Reset because they are replayed
+	printed time.Time
+}
+
+// pendingEvent stores an event not yet flushed and when it was received
+type pendingEvent struct {
+	event    bson.Raw
+	received time.Time
+}
+
+// NewChangeStreamStats returns *ChangeStreamStats
+func NewChangeStreamStats() *ChangeStreamStats {
+	now := time.Now()
+	return &ChangeStreamStats{Begin: now, Events: map[string]*ChangeEventStats{}, printed: now}
+}
+
+// SetOplogWindow sets oplog window in seconds to warn of lag
+func (s *ChangeStreamStats) SetOplogWindow(seconds int64) {
+	s.OplogWindow = seconds
+}
+
+// Close prints a summary
+func (s *ChangeStreamStats) Close() error {
+	s.commit()
+	fmt.Println(s.printChangeStreamSummary(time.Now()))
+	return nil
+}
+
+// Flush adds events since the last flush and prints a summary every 10 seconds
+func (s *ChangeStreamStats) Flush() error {
+	s.commit()
+	if now := time.Now(); now.Sub(s.printed) >= statsPrintInterval {
+		fmt.Println(s.printChangeStreamSummary(now))
+		s.printed = now
+	}
+	return nil
+}
+
+// Name returns the sink name
+func (s *ChangeStreamStats) Name() string {
+	return "stats"
+}
+
+// Reset drops events since the last flush, which are replayed after resuming
+func (s *ChangeStreamStats) Reset() {
+	s.pending = nil
+}
+
+// Write buffers an event until the next flush
+func (s *ChangeStreamStats) Write(event bson.Raw) error {
+	s.pending = append(s.pending, pendingEvent{event: append(bson.Raw{}, event...), received: time.Now()})
+	return nil
+}
+
+// commit adds buffered events
+func (s *ChangeStreamStats) commit() {
+	for _, p := range s.pending {
+		s.record(p.event, p.received)
+	}
+	s.pending = nil
+}
+
+// record adds an event received at a time
+func (s *ChangeStreamStats) record(event bson.Raw, now time.Time) {
+	op, _ := event.Lookup("operationType").StringValueOK()
+	ns, _ := event.Lookup("ns", "db").StringValueOK()
+	if coll, ok := event.Lookup("ns", "coll").StringValueOK(); ok {
+		ns += "." + coll
+	}
+	key := ns + "/" + op
+	if s.Events[key] == nil {
+		s.Events[key] = &ChangeEventStats{Namespace: ns, OperationType: op}
+	}
+	stats := s.Events[key]
+	stats.Count++
+	stats.Bytes += int64(len(event))
+	stats.Sizes.Add(len(event))
+	s.Sizes.Add(len(event))
+
+	var eventTime time.Time // wallTime is available from 6.0
+	if wallTime, ok := event.Lookup("wallTime").DateTimeOK(); ok {
+		eventTime = time.UnixMilli(wallTime)
+	} else if t, _, ok := event.Lookup("clusterTime").TimestampOK(); ok {
+		eventTime = time.Unix(int64(t), 0)
+	}
+	if !eventTime.IsZero() {
+		lag := now.Sub(eventTime)
+		if lag < 0 {
+			lag = 0
+		}
+		s.Lag.Add(int(lag.Milliseconds()))
+		if lag > s.MaxLag {
+			s.MaxLag = lag
+		}
+	}
+
+	if op != "update" {
+		return
+	}
+	s.Lookups.Updates++
+	delta := len(event.Lookup("updateDescription").Value)
+	s.Lookups.DeltaBytes += int64(delta)
+	doc, ok := event.Lookup("fullDocument").DocumentOK()
+	if !ok {
+		s.Lookups.Missing++
+		return
+	}
+	s.Lookups.LookupBytes += int64(len(doc))
+	if len(doc) >= expensiveLookupBytes || len(doc) >= expensiveLookupRatio*delta {
+		s.Lookups.Expensive++
+	}
+}
+
+// getEventStats returns event stats sorted by counts
+func (s *ChangeStreamStats) getEventStats() []*ChangeEventStats {
+	events := []*ChangeEventStats{}
+	for _, stats := range s.Events {
+		events = append(events, stats)
+	}
+	sort.Slice(events, func(i int, j int) bool {
+		if events[i].Count == events[j].Count {
+			return events[i].Namespace+events[i].OperationType < events[j].Namespace+events[j].OperationType
+		}
+		return events[i].Count > events[j].Count
+	})
+	return events
+}
+
+// printChangeStreamSummary returns throughput, lag, sizes, and update lookups
+func (s *ChangeStreamStats) printChangeStreamSummary(now time.Time) string {
+	var buffer bytes.Buffer
+	seconds := now.Sub(s.Begin).Seconds()
+	if seconds < 1 {
+		seconds = 1
+	}
+	total := s.Sizes.Total()
+	buffer.WriteString(fmt.Sprintf("\nChange events in %v, %d events, %.1f events/sec\n",
+		now.Sub(s.Begin).Truncate(time.Second), total, float64(total)/seconds))
+	buffer.WriteString("+----------------------------------------+----------+--------+----------+--------+--------+--------+\n")
+	buffer.WriteString("| Namespace                              | Op Type  |  Count | Events/s | AvgSz  | P50 Sz | P99 Sz |\n")
+	buffer.WriteString("|----------------------------------------+----------+--------+----------+--------+--------+--------|\n")
+	for _, stats := range s.getEventStats() {
+		ns := stats.Namespace
+		if len(ns) > 38 {
+			ns = ns[:35] + "..."
+		}
+		op := stats.OperationType
+		if len(op) > 8 {
+			op = op[:8]
+		}
+		buffer.WriteString(fmt.Sprintf("| %-38v | %-8v | %6d | %8.1f | %6d | %6d | %6d |\n", ns, op, stats.Count,
+			float64(stats.Count)/seconds, stats.Bytes/stats.Count, stats.Sizes.Percentile(50), stats.Sizes.Percentile(99)))
+	}
+	buffer.WriteString("+----------------------------------------+----------+--------+----------+--------+--------+--------+\n")
+	buffer.WriteString("sizes in bytes\n")
+	if s.Lag.Total() > 0 {
+		buffer.WriteString(fmt.Sprintf("lag (ms): p50 %d, p95 %d, p99 %d, max %d\n", s.Lag.Percentile(50),
+			s.Lag.Percentile(95), s.Lag.Percentile(99), s.MaxLag.Milliseconds()))
+	}
+	if s.OplogWindow > 0 {
+		buffer.WriteString(fmt.Sprintf("oplog window: %v", time.Duration(s.OplogWindow)*time.Second))
+		if s.MaxLag.Seconds() >= lagWarningRatio*float64(s.OplogWindow) {
+			buffer.WriteString(fmt.Sprintf(", WARNING: max lag is %.0f%% of the oplog window",
+				100*s.MaxLag.Seconds()/float64(s.OplogWindow)))
+		}
+		buffer.WriteString("\n")
+	}
+	if lookups := s.Lookups; lookups.Updates > 0 {
+		looked := lookups.Updates - lookups.Missing
+		avg := int64(0)
+		if looked > 0 {
+			avg = lookups.LookupBytes / looked
+		}
+		buffer.WriteString(fmt.Sprintf("updateLookup: %d updates, %d (%.1f%%) expensive, %d missing documents, avg %d bytes looked up vs %d bytes of updateDescription\n",
+			lookups.Updates, lookups.Expensive, 100*float64(lookups.Expensive)/float64(lookups.Updates), lookups.Missing,
+			avg, lookups.DeltaBytes/lookups.Updates))
+	}
+	return buffer.String()
+}
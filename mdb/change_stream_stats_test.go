@@ -0,0 +1,67 @@
+// Copyright 2020-present Kuei-chun Chen. All rights reserved.
+
+package mdb
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestChangeStreamStats(t *testing.T) {
+	now := time.Now()
+	stats := NewChangeStreamStats()
+	stats.Begin = now.Add(-10 * time.Second)
+	stats.SetOplogWindow(60)
+	ns := bson.M{"db": "keyhole", "coll": "orders"}
+	for i := 0; i < 10; i++ {
+		data, _ := bson.Marshal(bson.M{"operationType": "insert", "ns": ns, "fullDocument": bson.M{"_id": i},
+			"clusterTime": primitive.Timestamp{T: uint32(now.Add(-2 * time.Second).Unix())}})
+		stats.record(data, now)
+	}
+	big := strings.Repeat("x", 1024)
+	for i := 0; i < 4; i++ {
+		event := bson.M{"operationType": "update", "ns": ns, "wallTime": primitive.NewDateTimeFromTime(now.Add(-40 * time.Second)),
+			"updateDescription": bson.M{"updatedFields": bson.M{"qty": i}}}
+		if i < 3 {
+			event["fullDocument"] = bson.M{"_id": i, "qty": i, "notes": big}
+		} else {
+			event["fullDocument"] = nil
+		}
+		data, _ := bson.Marshal(event)
+		stats.record(data, now)
+	}
+	events := stats.getEventStats()
+	if len(events) != 2 || events[0].OperationType != "insert" || events[0].Count != 10 || events[0].Namespace != "keyhole.orders" {
+		t.Fatal("unexpected events", events)
+	}
+	if stats.Lookups.Updates != 4 || stats.Lookups.Missing != 1 || stats.Lookups.Expensive != 3 {
+		t.Fatal("unexpected lookups", stats.Lookups)
+	}
+	if stats.MaxLag.Truncate(time.Millisecond) != 40*time.Second {
+		t.Fatal("expected max lag 40s, but got", stats.MaxLag)
+	}
+	str := stats.printChangeStreamSummary(now)
+	if !strings.Contains(str, "14 events, 1.4 events/sec") || !strings.Contains(str, "WARNING") ||
+		!strings.Contains(str, "3 (75.0%) expensive") {
+		t.Fatal("unexpected summary", str)
+	}
+	t.Log(str)
+}
+
+func TestChangeStreamStatsReset(t *testing.T) {
+	stats := NewChangeStreamStats()
+	data, _ := bson.Marshal(bson.M{"operationType": "insert", "ns": bson.M{"db": "keyhole", "coll": "orders"}})
+	stats.Write(data)
+	stats.Flush()
+	stats.Write(data) // replayed after resuming from the last checkpoint
+	stats.Reset()
+	stats.Write(data)
+	stats.Flush()
+	if events := stats.getEventStats(); len(events) != 1 || events[0].Count != 2 {
+		t.Fatal("expected 2 events counted once, but got", events)
+	}
+}
@@ -3,24 +3,69 @@
 package mdb
 
 import (
+	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"log"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
 	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
+const (
+	changeStreamFatalError   = 280
+	changeStreamHistoryLost  = 286
+	resumableErrorLabel      = "ResumableChangeStreamError"
+	checkpointInterval       = time.Second
+	maxWatchRetries          = 10
+	maxWatchBackoff          = 30 * time.Second
+	resumeTokenFilePerm      = 0644
+	resumeTokenTempExtension = ".tmp"
+)
+
+// resumableErrorCodes are codes of errors to resume change streams from servers before 4.4 not labeling errors
+var resumableErrorCodes = []int{6, 7, 43, 63, 89, 91, 133, 150, 189, 234, 262, 9001, 10107, 11600, 11602,
+	13388, 13435, 13436}
+
+// sinkError is an error of a sink, resumable after the buffered events are dropped
+type sinkError struct {
+	err  error
+	name string
+}
+
+func (e *sinkError) Error() string { return e.name + ": " + e.err.Error() }
+
 // ChangeStream defines what to watch? client, database or collection
 type ChangeStream struct {
-	collection string
-	database   string
-	pipeline   []bson.D
+	batchSize                int32
+	collection               string
+	database                 string
+	fullDocumentBeforeChange string
+	pipeline                 []bson.D
+	resumeFile               string
+	sinks                    []ChangeSink
+	startAtOperationTime     *primitive.Timestamp
 }
 
 type callback func(bson.M)
 
+// AddSink adds a sink of change events
+func (cs *ChangeStream) AddSink(sink ChangeSink) {
+	cs.sinks = append(cs.sinks, sink)
+}
+
+// SetBatchSize sets batch size
+func (cs *ChangeStream) SetBatchSize(batchSize int32) {
+	cs.batchSize = batchSize
+}
+
 // SetCollection sets collection
 func (cs *ChangeStream) SetCollection(collection string) {
 	cs.collection = collection
@@ -31,6 +76,15 @@ func (cs *ChangeStream) SetDatabase(database string) {
 	cs.database = database
 }
 
+// SetFullDocumentBeforeChange sets fullDocumentBeforeChange, off, whenAvailable, or required
+func (cs *ChangeStream) SetFullDocumentBeforeChange(mode string) error {
+	if mode != "" && mode != "off" && mode != "whenAvailable" && mode != "required" {
+		return fmt.Errorf("invalid fullDocumentBeforeChange %v, use off, whenAvailable, or required", mode)
+	}
+	cs.fullDocumentBeforeChange = mode
+	return nil
+}
+
 // SetPipeline sets pipeline
 func (cs *ChangeStream) SetPipeline(pipeline []bson.D) {
 	cs.pipeline = pipeline
@@ -45,47 +99,231 @@ func (cs *ChangeStream) SetPipelineString(pipe string) {
 	cs.pipeline = pipeline
 }
 
+// SetResumeFile sets the file to persist resume tokens
+func (cs *ChangeStream) SetResumeFile(resumeFile string) {
+	cs.resumeFile = resumeFile
+}
+
+// SetStartAtOperationTime sets the cluster time to start, ignored if resuming from a saved token
+func (cs *ChangeStream) SetStartAtOperationTime(t time.Time) {
+	cs.startAtOperationTime = &primitive.Timestamp{T: uint32(t.Unix())}
+}
+
 // NewChangeStream gets a new ChangeStream
 func NewChangeStream() *ChangeStream {
 	return &ChangeStream{}
 }
 
-// Watch prints oplogs in JSON format
-func (cs *ChangeStream) Watch(client *mongo.Client, cb callback) {
+// Watch writes change events to sinks and a callback if not nil.  It resumes from the token in
+// the resume file, retries on errors with backoff, and returns on SIGINT/SIGTERM.  A token is
+// saved after sinks are flushed, so events are delivered at least once.
+func (cs *ChangeStream) Watch(client *mongo.Client, cb callback) error {
+	var err error
+	var token bson.Raw
+	sinks := cs.sinks
+	if cb != nil {
+		sinks = append(sinks, &callbackSink{cb: cb})
+	}
+	defer func() {
+		for _, sink := range sinks {
+			if e := sink.Close(); e != nil {
+				log.Println(sink.Name(), e)
+			}
+		}
+	}()
+	if token, err = ReadResumeToken(cs.resumeFile); err != nil {
+		return err
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(sig)
+	go func() {
+		select {
+		case <-sig:
+			log.Println("stopping change stream")
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	retries := 0
+	for {
+		var resumed bson.Raw
+		resumed, err = cs.watch(ctx, client, sinks, token)
+		if ctx.Err() != nil || err == nil { // interrupted or invalidated
+			return nil
+		}
+		if isFatalChangeStreamError(err) {
+			return fmt.Errorf("cannot resume change stream, remove %v to restart: %v", cs.resumeFile, err)
+		} else if !isResumableChangeStreamError(err) {
+			return err
+		}
+		for _, sink := range sinks { // events not flushed are replayed after resuming
+			if r, ok := sink.(interface{ Reset() }); ok {
+				r.Reset()
+			}
+		}
+		if !bytes.Equal(resumed, token) {
+			retries = 0
+		}
+		token = resumed
+		if retries++; retries > maxWatchRetries {
+			return err
+		}
+		backoff := time.Duration(1<<uint(retries-1)) * time.Second
+		if backoff > maxWatchBackoff {
+			backoff = maxWatchBackoff
+		}
+		log.Printf("change stream error, retry %d in %v: %v\n", retries, backoff, err)
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(backoff):
+		}
+	}
+}
+
+// watch opens a change stream and writes events until an error, returns the last saved token
+func (cs *ChangeStream) watch(ctx context.Context, client *mongo.Client, sinks []ChangeSink, token bson.Raw) (bson.Raw, error) {
 	var err error
-	var ctx = context.Background()
 	var cur *mongo.ChangeStream
-	fmt.Println("pipeline", cs.pipeline)
 	opts := options.ChangeStream()
-	opts.SetFullDocument("updateLookup")
+	opts.SetFullDocument(options.UpdateLookup)
+	if cs.batchSize > 0 {
+		opts.SetBatchSize(cs.batchSize)
+	}
+	if cs.fullDocumentBeforeChange != "" {
+		opts.SetFullDocumentBeforeChange(options.FullDocument(cs.fullDocumentBeforeChange))
+	}
+	if token != nil {
+		log.Println("resume after", token.String())
+		opts.SetStartAfter(token)
+	} else if cs.startAtOperationTime != nil {
+		log.Println("start at", time.Unix(int64(cs.startAtOperationTime.T), 0).UTC().Format(time.RFC3339))
+		opts.SetStartAtOperationTime(cs.startAtOperationTime)
+	}
 	if cs.collection != "" && cs.database != "" {
-		fmt.Println("Watching", cs.database+"."+cs.collection)
-		var coll = client.Database(cs.database).Collection(cs.collection)
-		if cur, err = coll.Watch(ctx, cs.pipeline, opts); err != nil {
-			panic(err)
-		}
+		log.Println("Watching", cs.database+"."+cs.collection, "pipeline", cs.pipeline)
+		cur, err = client.Database(cs.database).Collection(cs.collection).Watch(ctx, cs.pipeline, opts)
 	} else if cs.database != "" {
-		fmt.Println("Watching", cs.database)
-		var db = client.Database(cs.database)
-		if cur, err = db.Watch(ctx, cs.pipeline, opts); err != nil {
-			panic(err)
-		}
+		log.Println("Watching", cs.database, "pipeline", cs.pipeline)
+		cur, err = client.Database(cs.database).Watch(ctx, cs.pipeline, opts)
 	} else {
-		fmt.Println("Watching all")
-		if cur, err = client.Watch(ctx, cs.pipeline, opts); err != nil {
-			panic(err)
+		log.Println("Watching all", "pipeline", cs.pipeline)
+		cur, err = client.Watch(ctx, cs.pipeline, opts)
+	}
+	if err != nil {
+		return token, err
+	}
+	defer cur.Close(context.Background())
+
+	checkpointed := time.Now()
+	for {
+		if cur.TryNext(ctx) {
+			for _, sink := range sinks {
+				if err = sink.Write(cur.Current); err != nil {
+					return token, &sinkError{err: err, name: sink.Name()}
+				}
+			}
+			if time.Since(checkpointed) < checkpointInterval {
+				continue
+			}
+		} else if err = cur.Err(); err != nil {
+			if ctx.Err() != nil { // interrupted, all events returned were written
+				token, _ = cs.checkpoint(sinks, token, cur.ResumeToken())
+			}
+			return token, err
+		} else if cur.ID() == 0 {
+			log.Println("change stream invalidated")
+			return cs.checkpoint(sinks, token, cur.ResumeToken())
+		}
+		// periodically or when idle, an empty batch also advances the post batch resume token
+		if token, err = cs.checkpoint(sinks, token, cur.ResumeToken()); err != nil {
+			return token, err
+		}
+		checkpointed = time.Now()
+	}
+}
+
+// checkpoint flushes sinks and saves the resume token if changed
+func (cs *ChangeStream) checkpoint(sinks []ChangeSink, saved bson.Raw, token bson.Raw) (bson.Raw, error) {
+	if token == nil || bytes.Equal(saved, token) {
+		return saved, nil
+	}
+	for _, sink := range sinks {
+		if err := sink.Flush(); err != nil {
+			return saved, &sinkError{err: err, name: sink.Name()}
 		}
 	}
+	if err := SaveResumeToken(cs.resumeFile, token); err != nil {
+		return saved, err
+	}
+	return append(bson.Raw{}, token...), nil
+}
+
+// isFatalChangeStreamError returns true if a change stream cannot be resumed
+func isFatalChangeStreamError(err error) bool {
+	var serr mongo.ServerError
+	if errors.As(err, &serr) {
+		return serr.HasErrorCode(changeStreamHistoryLost) || serr.HasErrorCode(changeStreamFatalError)
+	}
+	return false
+}
 
-	defer cur.Close(ctx)
-	var doc bson.M
-	for cur.Next(ctx) {
-		if err = cur.Decode(&doc); err != nil {
-			log.Fatal(err)
+// isResumableChangeStreamError returns true if an error is of a sink, of network, or
+// labeled or coded resumable by servers
+func isResumableChangeStreamError(err error) bool {
+	var serr *sinkError
+	if errors.As(err, &serr) || mongo.IsNetworkError(err) {
+		return true
+	}
+	var cerr mongo.ServerError
+	if !errors.As(err, &cerr) {
+		return false
+	}
+	if cerr.HasErrorLabel(resumableErrorLabel) {
+		return true
+	}
+	for _, code := range resumableErrorCodes {
+		if cerr.HasErrorCode(code) {
+			return true
 		}
-		cb(doc)
 	}
-	if err = cur.Err(); err != nil {
-		log.Fatal(err)
+	return false
+}
+
+// ReadResumeToken reads a resume token in extended JSON, nil if the file doesn't exist
+func ReadResumeToken(filename string) (bson.Raw, error) {
+	if filename == "" {
+		return nil, nil
+	}
+	data, err := os.ReadFile(filename)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	var token bson.Raw
+	if err = bson.UnmarshalExtJSON(data, false, &token); err != nil {
+		return nil, fmt.Errorf("invalid resume token in %v: %v", filename, err)
+	}
+	return token, nil
+}
+
+// SaveResumeToken writes a resume token in extended JSON, replacing the file atomically
+func SaveResumeToken(filename string, token bson.Raw) error {
+	if filename == "" {
+		return nil
+	}
+	data, err := bson.MarshalExtJSON(token, true, false)
+	if err != nil {
+		return err
+	}
+	tmpfile := filename + resumeTokenTempExtension
+	if err = os.WriteFile(tmpfile, data, resumeTokenFilePerm); err != nil {
+		return err
 	}
+	return os.Rename(tmpfile, filename)
 }
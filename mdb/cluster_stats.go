@@ -45,11 +45,13 @@ type ClusterStats struct {
 	Shards           []Shard          `bson:"shards"`
 	Version          string           `bson:"version"`
 
-	dbNames   []string
-	fastMode  bool
-	redact    bool
-	signature string
-	verbose   bool
+	dbNames    []string
+	fastMode   bool
+	format     string
+	redact     bool
+	sampleSize int
+	signature  string
+	verbose    bool
 }
 
 // NewClusterStats returns *ClusterStats
@@ -68,11 +70,21 @@ func (p *ClusterStats) SetFastMode(fastMode bool) {
 	p.fastMode = fastMode
 }
 
+// SetFormat sets output format, json, csv, prom, or html
+func (p *ClusterStats) SetFormat(format string) {
+	p.format = format
+}
+
 // SetRedaction sets redact
 func (p *ClusterStats) SetRedaction(redact bool) {
 	p.redact = redact
 }
 
+// SetSampleSize sets number of sampled documents for schema analysis, 0 to skip
+func (p *ClusterStats) SetSampleSize(sampleSize int) {
+	p.sampleSize = sampleSize
+}
+
 // SetVerbose sets verbose mode
 func (p *ClusterStats) SetVerbose(verbose bool) {
 	p.verbose = verbose
@@ -120,6 +132,7 @@ func (p *ClusterStats) GetClusterStats(client *mongo.Client, connString connstri
 	db := NewDatabaseStats(p.Logger.AppName)
 	db.SetNumberShards(len(p.Shards))
 	db.SetRedaction(p.redact)
+	db.SetSampleSize(p.sampleSize)
 	db.SetVerbose(p.verbose)
 	db.SetFastMode(p.fastMode)
 	var databases []Database
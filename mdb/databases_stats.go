@@ -26,12 +26,13 @@ const (
 type DatabaseStats struct {
 	Logger *gox.Logger
 
-	fastMode  bool
-	numShards int
-	redaction bool
-	threads   int
-	verbose   bool
-	version   string
+	fastMode   bool
+	numShards  int
+	redaction  bool
+	sampleSize int
+	threads    int
+	verbose    bool
+	version    string
 }
 
 // ListDatabases stores listDatabases
@@ -64,12 +65,14 @@ type Database struct {
 
 // Collection stores struct
 type Collection struct {
-	Chunks   []Chunk `bson:"chunks,truncate"`
-	Document bson.M  `bson:"document,truncate"`
-	Indexes  []Index `bson:"indexes,truncate"`
-	Name     string  `bson:"name,truncate"`
-	NS       string  `bson:"namespace,truncate"`
-	Stats    struct {
+	Chunks        []Chunk       `bson:"chunks,truncate"`
+	Document      bson.M        `bson:"document,truncate"`
+	Indexes       []Index       `bson:"indexes,truncate"`
+	Name          string        `bson:"name,truncate"`
+	NS            string        `bson:"namespace,truncate"`
+	Schema        *Schema       `bson:"schema,omitempty"`
+	SearchIndexes []SearchIndex `bson:"searchIndexes,omitempty"`
+	Stats         struct {
 		Count          int64   `bson:"count,truncate"`
 		IndexDetails   bson.M  `bson:"indexDetails,truncate"`
 		AvgObjSize     float64 `bson:"avgObjSize,truncate"`
@@ -123,6 +126,11 @@ func (p *DatabaseStats) SetRedaction(redaction bool) {
 	p.redaction = redaction
 }
 
+// SetSampleSize sets number of sampled documents for schema analysis, 0 to skip
+func (p *DatabaseStats) SetSampleSize(sampleSize int) {
+	p.sampleSize = sampleSize
+}
+
 // SetVerbose sets verbosity
 func (p *DatabaseStats) SetVerbose(verbose bool) {
 	p.verbose = verbose
@@ -200,6 +208,7 @@ func (p *DatabaseStats) GetAllDatabasesStats(client *mongo.Client, dbNames []str
 
 				var cursor *mongo.Cursor
 				var sampleDoc bson.M
+				var schema *Schema
 				opts := options.Find()
 				opts.SetLimit(5) // get 5 samples and choose the max_size()
 				opts.SetHint(bson.D{{Key: "$natural", Value: 1}})
@@ -229,6 +238,15 @@ func (p *DatabaseStats) GetAllDatabasesStats(client *mongo.Client, dbNames []str
 					if sampleDoc == nil {
 						p.Logger.Debug("no sample doc available")
 					}
+					if p.sampleSize > 0 {
+						analyzer := NewSchemaAnalyzer()
+						analyzer.SetSampleSize(p.sampleSize)
+						analyzer.SetRedaction(p.redaction)
+						var serr error
+						if schema, serr = analyzer.Analyze(collection); serr != nil {
+							p.Logger.Errorf(`ns %v schema error %v`, ns, serr)
+						}
+					}
 				} else {
 					p.Logger.Debug("skip ", collectionName)
 				}
@@ -269,7 +287,7 @@ func (p *DatabaseStats) GetAllDatabasesStats(client *mongo.Client, dbNames []str
 				}
 				mu.Lock()
 				collstats := Collection{NS: ns, Name: collectionName, Chunks: chunks, Document: sampleDoc,
-					Indexes: indexes}
+					Indexes: indexes, Schema: schema}
 				data, _ := bson.Marshal(stats)
 				bson.Unmarshal(data, &collstats.Stats)
 				collections = append(collections, collstats)
@@ -0,0 +1,443 @@
+// Copyright 2020-present Kuei-chun Chen. All rights reserved.
+
+package mdb
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// output formats
+const (
+	FormatCSV  = "csv"
+	FormatHTML = "html"
+	FormatJSON = "json"
+	FormatProm = "prom"
+)
+
+// formatExts maps formats to file extensions
+var formatExts = map[string]string{FormatCSV: ".csv", FormatHTML: ".html", FormatJSON: ".jsonl", FormatProm: ".prom"}
+
+// ValidateFormat returns an error if a format is not supported
+func ValidateFormat(format string) error {
+	if format == "" || formatExts[format] != "" {
+		return nil
+	}
+	return fmt.Errorf(`unsupported format %v, use json, csv, prom, or html`, format)
+}
+
+// exportFunc writes data of a format to a writer
+type exportFunc func(w io.Writer, format string) error
+
+// outputFormat writes data of a format to a file under outdir
+func outputFormat(basename string, format string, export exportFunc) (string, error) {
+	var err error
+	if err = ValidateFormat(format); err != nil || format == "" {
+		return "", err
+	}
+	var buffer bytes.Buffer
+	if err = export(&buffer, format); err != nil {
+		return "", err
+	}
+	dir := outdir
+	if format == FormatHTML {
+		dir = htmldir
+	}
+	os.Mkdir(dir, 0755)
+	ext := formatExts[format]
+	ofile := fmt.Sprintf(`%v/%v%v`, dir, basename, ext)
+	i := 1
+	for DoesFileExist(ofile) {
+		ofile = fmt.Sprintf(`%v/%v.%d%v`, dir, basename, i, ext)
+		i++
+	}
+	if err = os.WriteFile(ofile, buffer.Bytes(), 0644); err != nil {
+		return ofile, err
+	}
+	fmt.Printf("%v data written to %v\n", format, ofile)
+	return ofile, err
+}
+
+// writeJSONLines writes one json document per line
+func writeJSONLines(w io.Writer, docs []map[string]interface{}) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetEscapeHTML(false)
+	for _, doc := range docs {
+		if err := encoder.Encode(doc); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeCSV writes a header and records
+func writeCSV(w io.Writer, header []string, records [][]string) error {
+	writer := csv.NewWriter(w)
+	if err := writer.Write(header); err != nil {
+		return err
+	}
+	if err := writer.WriteAll(records); err != nil {
+		return err
+	}
+	return writer.Error()
+}
+
+// promMetric stores a metric of Prometheus text exposition format
+type promMetric struct {
+	help   string
+	name   string
+	mtype  string
+	values []promValue
+}
+
+// promValue stores labels and a value of a metric
+type promValue struct {
+	labels [][2]string
+	suffix string
+	value  float64
+}
+
+// writePrometheus writes metrics in Prometheus text exposition format
+func writePrometheus(w io.Writer, metrics []promMetric) error {
+	var buffer bytes.Buffer
+	for _, m := range metrics {
+		if len(m.values) == 0 {
+			continue
+		}
+		buffer.WriteString(fmt.Sprintf("# HELP %v %v\n", m.name, m.help))
+		buffer.WriteString(fmt.Sprintf("# TYPE %v %v\n", m.name, m.mtype))
+		for _, v := range m.values {
+			buffer.WriteString(m.name + v.suffix)
+			if len(v.labels) > 0 {
+				strs := []string{}
+				for _, label := range v.labels {
+					strs = append(strs, fmt.Sprintf(`%v="%v"`, label[0], escapePromLabel(label[1])))
+				}
+				buffer.WriteString("{" + strings.Join(strs, ",") + "}")
+			}
+			buffer.WriteString(fmt.Sprintf(" %v\n", v.value))
+		}
+	}
+	_, err := w.Write(buffer.Bytes())
+	return err
+}
+
+// escapePromLabel escapes backslash, double-quote, and line feed of a label value
+func escapePromLabel(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(value)
+}
+
+// Export writes query patterns, slow ops, and histograms in json (lines), csv, prom, or html format.
+// Only query patterns are written in csv, see exportSlowOps and exportHistograms.
+func (li *LogInfo) Export(w io.Writer, format string) error {
+	switch format {
+	case FormatJSON:
+		docs := []map[string]interface{}{}
+		for _, op := range li.OpPatterns {
+			doc := map[string]interface{}{"type": "opPattern"}
+			for i, v := range li.getOpPatternRecord(op) {
+				doc[opPatternHeader[i]] = v
+			}
+			doc["avgMilli"] = float64(op.TotalMilli) / float64(op.Count)
+			doc["scanRatio"] = op.ScanRatio()
+			docs = append(docs, doc)
+		}
+		for _, op := range li.getSlowOps() {
+			docs = append(docs, map[string]interface{}{"type": "slowOp", "milli": op.Milli, "log": op.Log})
+		}
+		for _, h := range li.Histograms {
+			docs = append(docs, map[string]interface{}{"type": "histogram", "utc": h.UTC, "ops": h.Ops})
+		}
+		return writeJSONLines(w, docs)
+	case FormatCSV:
+		records := [][]string{}
+		for _, op := range li.OpPatterns {
+			record := []string{}
+			for _, v := range li.getOpPatternRecord(op) {
+				record = append(record, fmt.Sprint(v))
+			}
+			records = append(records, record)
+		}
+		return writeCSV(w, opPatternHeader, records)
+	case FormatProm:
+		return writePrometheus(w, li.getPromMetrics())
+	case FormatHTML:
+		return li.WriteHTML(w)
+	}
+	return ValidateFormat(format)
+}
+
+// getSlowOps returns slow ops unless redacted
+func (li *LogInfo) getSlowOps() []RawLog {
+	if li.Redaction {
+		return []RawLog{}
+	}
+	return li.SlowOps
+}
+
+// exportSlowOps writes slow ops in csv format
+func (li *LogInfo) exportSlowOps(w io.Writer, format string) error {
+	records := [][]string{}
+	for _, op := range li.getSlowOps() {
+		records = append(records, []string{fmt.Sprint(op.Milli), op.Log})
+	}
+	return writeCSV(w, []string{"milli", "log"}, records)
+}
+
+// exportHistograms writes ops per minute in csv format
+func (li *LogInfo) exportHistograms(w io.Writer, format string) error {
+	ops := getHistogramOps(li.Histograms)
+	records := [][]string{}
+	for _, h := range li.Histograms {
+		record := []string{h.UTC}
+		for _, op := range ops {
+			record = append(record, fmt.Sprint(h.Ops[op]))
+		}
+		records = append(records, record)
+	}
+	return writeCSV(w, append([]string{"utc"}, ops...), records)
+}
+
+// OutputFormat writes loginfo data of the format set to a file under outdir, and
+// slow ops and histograms to their own files in csv format
+func (li *LogInfo) OutputFormat() (string, error) {
+	basename := strings.TrimSuffix(filepath.Base(li.filename), logExt)
+	basename = strings.TrimSuffix(strings.TrimSuffix(basename, ".gz"), ".log")
+	ofile, err := outputFormat(basename+"-log", li.format, li.Export)
+	if err != nil || li.format != FormatCSV {
+		return ofile, err
+	}
+	if len(li.getSlowOps()) > 0 {
+		if _, err = outputFormat(basename+"-log-slowops", li.format, li.exportSlowOps); err != nil {
+			return ofile, err
+		}
+	}
+	if len(li.Histograms) > 0 {
+		_, err = outputFormat(basename+"-log-histograms", li.format, li.exportHistograms)
+	}
+	return ofile, err
+}
+
+// opPatternHeader defines columns of query patterns
+var opPatternHeader = []string{"command", "namespace", "filter", "count", "totalMilli", "maxMilli",
+	"p50Milli", "p95Milli", "p99Milli", "totalReslen", "docsExamined", "keysExamined", "returned",
+	"yields", "scan", "index", "queryHash"}
+
+// getOpPatternRecord returns values of a query pattern in the order of opPatternHeader
+func (li *LogInfo) getOpPatternRecord(op OpPattern) []interface{} {
+	return []interface{}{op.Command, op.Namespace, op.Filter, op.Count, op.TotalMilli, op.MaxMilli,
+		op.Percentile(50), op.Percentile(95), op.Percentile(99), op.TotalReslen, op.TotalDocsExamined,
+		op.TotalKeysExamined, op.TotalReturned, op.TotalYields, op.Scan, op.Index, op.QueryHash}
+}
+
+// getHistogramOps returns sorted op names of histograms
+func getHistogramOps(histograms []Histogram) []string {
+	opsMap := map[string]bool{}
+	for _, h := range histograms {
+		for op := range h.Ops {
+			opsMap[op] = true
+		}
+	}
+	ops := []string{}
+	for op := range opsMap {
+		ops = append(ops, op)
+	}
+	sort.Strings(ops)
+	return ops
+}
+
+// getPromMetrics returns query patterns metrics, histograms are not exported
+// because textfile collectors reject timestamps
+func (li *LogInfo) getPromMetrics() []promMetric {
+	summary := promMetric{name: "keyhole_log_op_milliseconds", mtype: "summary",
+		help: "Latency of query patterns in milliseconds."}
+	maxMilli := promMetric{name: "keyhole_log_op_max_milliseconds", mtype: "gauge",
+		help: "Max latency of query patterns in milliseconds."}
+	docs := promMetric{name: "keyhole_log_op_docs_examined_total", mtype: "counter",
+		help: "Documents examined by query patterns."}
+	keys := promMetric{name: "keyhole_log_op_keys_examined_total", mtype: "counter",
+		help: "Index keys examined by query patterns."}
+	returned := promMetric{name: "keyhole_log_op_returned_total", mtype: "counter",
+		help: "Documents returned by query patterns."}
+	for _, op := range li.OpPatterns {
+		labels := [][2]string{{"command", op.Command}, {"ns", op.Namespace}, {"pattern", op.Filter},
+			{"queryHash", op.QueryHash}, {"shape", op.Shape}, {"scan", op.Scan}}
+		for _, q := range []float64{50, 95, 99} {
+			qlabels := append(append([][2]string{}, labels...), [2]string{"quantile", fmt.Sprint(q / 100)})
+			summary.values = append(summary.values, promValue{labels: qlabels, value: float64(op.Percentile(q))})
+		}
+		summary.values = append(summary.values, promValue{labels: labels, suffix: "_sum", value: float64(op.TotalMilli)})
+		summary.values = append(summary.values, promValue{labels: labels, suffix: "_count", value: float64(op.Count)})
+		maxMilli.values = append(maxMilli.values, promValue{labels: labels, value: float64(op.MaxMilli)})
+		docs.values = append(docs.values, promValue{labels: labels, value: float64(op.TotalDocsExamined)})
+		keys.values = append(keys.values, promValue{labels: labels, value: float64(op.TotalKeysExamined)})
+		returned.values = append(returned.values, promValue{labels: labels, value: float64(op.TotalReturned)})
+	}
+	slowOps := promMetric{name: "keyhole_log_slow_ops", mtype: "gauge", help: "Number of slowest ops kept.",
+		values: []promValue{{value: float64(len(li.SlowOps))}}}
+	return []promMetric{summary, maxMilli, docs, keys, returned, slowOps}
+}
+
+// indexHeader defines columns of indexes
+var indexHeader = []string{"database", "namespace", "name", "key", "totalOps", "unique", "sparse",
+	"expireAfterSeconds", "isShardKey", "isDupped"}
+
+// Export writes indexes in json (lines), csv, prom, or html format
+func (ix *IndexStats) Export(w io.Writer, format string) error {
+	switch format {
+	case FormatJSON:
+		docs := []map[string]interface{}{}
+		for _, db := range ix.Databases {
+			for _, coll := range db.Collections {
+				for _, o := range coll.Indexes {
+					doc := map[string]interface{}{}
+					for i, v := range getIndexRecord(db.Name, coll.NS, o) {
+						doc[indexHeader[i]] = v
+					}
+					usage := []map[string]interface{}{}
+					for _, u := range o.Usage {
+						usage = append(usage, map[string]interface{}{"host": u.Host, "shard": u.Shard,
+							"ops": u.Accesses.Ops, "since": u.Accesses.Since})
+					}
+					doc["usage"] = usage
+					docs = append(docs, doc)
+				}
+			}
+		}
+		return writeJSONLines(w, docs)
+	case FormatCSV:
+		records := [][]string{}
+		for _, db := range ix.Databases {
+			for _, coll := range db.Collections {
+				for _, o := range coll.Indexes {
+					record := []string{}
+					for _, v := range getIndexRecord(db.Name, coll.NS, o) {
+						record = append(record, fmt.Sprint(v))
+					}
+					records = append(records, record)
+				}
+			}
+		}
+		return writeCSV(w, indexHeader, records)
+	case FormatProm:
+		ops := promMetric{name: "keyhole_index_ops_total", mtype: "counter",
+			help: "Index accesses since the server started, by host."}
+		dupped := promMetric{name: "keyhole_index_redundant", mtype: "gauge",
+			help: "1 if an index is covered by another index."}
+		for _, db := range ix.Databases {
+			for _, coll := range db.Collections {
+				for _, o := range coll.Indexes {
+					labels := [][2]string{{"ns", coll.NS}, {"index", o.Name}}
+					for _, u := range o.Usage {
+						ulabels := append(append([][2]string{}, labels...), [2]string{"host", u.Host}, [2]string{"shard", u.Shard})
+						ops.values = append(ops.values, promValue{labels: ulabels, value: float64(u.Accesses.Ops)})
+					}
+					value := 0.0
+					if o.IsDupped {
+						value = 1
+					}
+					dupped.values = append(dupped.values, promValue{labels: labels, value: value})
+				}
+			}
+		}
+		return writePrometheus(w, []promMetric{ops, dupped})
+	case FormatHTML:
+		return ix.WriteHTML(w)
+	}
+	return ValidateFormat(format)
+}
+
+// OutputFormat writes indexes of the format set to a file under outdir
+func (ix *IndexStats) OutputFormat() (string, error) {
+	basename := strings.TrimSuffix(filepath.Base(ix.filename), indexExt)
+	return outputFormat(basename+"-index", ix.format, ix.Export)
+}
+
+// getIndexRecord returns values of an index in the order of indexHeader
+func getIndexRecord(dbName string, ns string, o Index) []interface{} {
+	return []interface{}{dbName, ns, o.Name, o.KeyString, o.TotalOps, o.Unique, o.Sparse,
+		o.ExpireAfterSeconds, o.IsShardKey, o.IsDupped}
+}
+
+// collectionHeader defines columns of collections stats
+var collectionHeader = []string{"database", "namespace", "count", "size", "storageSize", "avgObjSize",
+	"nindexes", "totalIndexSize", "sharded", "nchunks"}
+
+// Export writes cluster summary and collections stats in json (lines), csv, prom, or html format
+func (p *ClusterStats) Export(w io.Writer, format string) error {
+	databases := []Database{}
+	if p.Databases != nil {
+		databases = *p.Databases
+	}
+	switch format {
+	case FormatJSON:
+		docs := []map[string]interface{}{{"type": "cluster", "host": p.HostInfo.System.Hostname,
+			"cluster": p.Cluster, "process": p.Process, "version": p.BuildInfo.Version,
+			"numCores": p.HostInfo.System.NumCores, "memSizeMB": p.HostInfo.System.MemSizeMB, "shards": len(p.Shards)}}
+		for _, db := range databases {
+			docs = append(docs, map[string]interface{}{"type": "database", "database": db.Name,
+				"objects": db.Stats.Objects, "dataSize": db.Stats.DataSize, "storageSize": db.Stats.StorageSize,
+				"indexSize": db.Stats.IndexSize, "indexes": db.Stats.Indexes})
+			for _, coll := range db.Collections {
+				doc := map[string]interface{}{"type": "collection"}
+				for i, v := range getCollectionRecord(db.Name, coll) {
+					doc[collectionHeader[i]] = v
+				}
+				docs = append(docs, doc)
+			}
+		}
+		return writeJSONLines(w, docs)
+	case FormatCSV:
+		records := [][]string{}
+		for _, db := range databases {
+			for _, coll := range db.Collections {
+				record := []string{}
+				for _, v := range getCollectionRecord(db.Name, coll) {
+					record = append(record, fmt.Sprint(v))
+				}
+				records = append(records, record)
+			}
+		}
+		return writeCSV(w, collectionHeader, records)
+	case FormatProm:
+		info := promMetric{name: "keyhole_cluster_info", mtype: "gauge", help: "Cluster information.",
+			values: []promValue{{labels: [][2]string{{"host", p.HostInfo.System.Hostname}, {"cluster", p.Cluster},
+				{"process", p.Process}, {"version", p.BuildInfo.Version}}, value: 1}}}
+		count := promMetric{name: "keyhole_collection_documents", mtype: "gauge", help: "Number of documents."}
+		size := promMetric{name: "keyhole_collection_size_bytes", mtype: "gauge", help: "Uncompressed data size."}
+		storage := promMetric{name: "keyhole_collection_storage_bytes", mtype: "gauge", help: "Storage size."}
+		indexSize := promMetric{name: "keyhole_collection_index_bytes", mtype: "gauge", help: "Total index size."}
+		for _, db := range databases {
+			for _, coll := range db.Collections {
+				labels := [][2]string{{"ns", coll.NS}}
+				count.values = append(count.values, promValue{labels: labels, value: float64(coll.Stats.Count)})
+				size.values = append(size.values, promValue{labels: labels, value: float64(coll.Stats.Size)})
+				storage.values = append(storage.values, promValue{labels: labels, value: float64(coll.Stats.StorageSize)})
+				indexSize.values = append(indexSize.values, promValue{labels: labels, value: float64(coll.Stats.TotalIndexSize)})
+			}
+		}
+		return writePrometheus(w, []promMetric{info, count, size, storage, indexSize})
+	case FormatHTML:
+		return p.WriteHTML(w)
+	}
+	return ValidateFormat(format)
+}
+
+// OutputFormat writes cluster stats of the format set to a file under outdir
+func (p *ClusterStats) OutputFormat() (string, error) {
+	basename := strings.ReplaceAll(p.HostInfo.System.Hostname, ":", "_") + "-stats"
+	return outputFormat(basename, p.format, p.Export)
+}
+
+// getCollectionRecord returns values of a collection in the order of collectionHeader
+func getCollectionRecord(dbName string, coll Collection) []interface{} {
+	return []interface{}{dbName, coll.NS, coll.Stats.Count, coll.Stats.Size, coll.Stats.StorageSize,
+		coll.Stats.AvgObjSize, coll.Stats.Nindexes, coll.Stats.TotalIndexSize, coll.Stats.Sharded, coll.Stats.Nchunks}
+}
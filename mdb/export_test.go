@@ -0,0 +1,68 @@
+// Copyright 2020-present Kuei-chun Chen. All rights reserved.
+
+package mdb
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestLogInfoExport(t *testing.T) {
+	str := `{"t":{"$date":"2020-11-05T09:00:50.680+00:00"},"s":"I","c":"COMMAND","id":51803,"ctx":"conn1","msg":"Slow query","attr":{"type":"command","ns":"keyhole.cars","command":{"find":"cars","filter":{"color":"red"}},"planSummary":"COLLSCAN","docsExamined":100,"nreturned":1,"reslen":100,"durationMillis":120}}`
+	loginfo := NewLogInfo("utest-xxxxxx")
+	loginfo.SetSilent(true)
+	if err := loginfo.Parse(bufio.NewReader(strings.NewReader(str))); err != nil {
+		t.Fatal(err)
+	}
+
+	var buffer bytes.Buffer
+	if err := loginfo.Export(&buffer, FormatJSON); err != nil {
+		t.Fatal(err)
+	}
+	var doc map[string]interface{}
+	line := strings.Split(buffer.String(), "\n")[0]
+	if err := json.Unmarshal([]byte(line), &doc); err != nil {
+		t.Fatal(err)
+	}
+	if doc["type"] != "opPattern" || doc["namespace"] != "keyhole.cars" || doc["scanRatio"] != float64(100) {
+		t.Fatal("unexpected json", line)
+	}
+
+	buffer.Reset()
+	if err := loginfo.Export(&buffer, FormatCSV); err != nil {
+		t.Fatal(err)
+	}
+	records, err := csv.NewReader(strings.NewReader(buffer.String())).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 2 || records[1][0] != "find" || records[1][4] != "120" {
+		t.Fatal("unexpected csv", records)
+	}
+	buffer.Reset()
+	if err = loginfo.exportHistograms(&buffer, FormatCSV); err != nil {
+		t.Fatal(err)
+	}
+	if records, err = csv.NewReader(strings.NewReader(buffer.String())).ReadAll(); err != nil {
+		t.Fatal(err)
+	} else if len(records) != 2 || records[0][1] != "find" || records[1][0] != "2020-11-05T09:00:00Z" {
+		t.Fatal("unexpected histograms csv", records)
+	}
+
+	buffer.Reset()
+	if err := loginfo.Export(&buffer, FormatProm); err != nil {
+		t.Fatal(err)
+	}
+	expected := `keyhole_log_op_milliseconds_count{command="find",ns="keyhole.cars",pattern="{\"color\":1}",queryHash="",shape="{\"color\":1}",scan="COLLSCAN"} 1`
+	if !strings.Contains(buffer.String(), expected) {
+		t.Fatal("expected", expected, "but got", buffer.String())
+	}
+
+	if err := loginfo.Export(&buffer, "xml"); err == nil {
+		t.Fatal("expected unsupported format error")
+	}
+}
@@ -0,0 +1,385 @@
+// Copyright 2020-present Kuei-chun Chen. All rights reserved.
+
+package mdb
+
+import (
+	"bytes"
+	"fmt"
+	htmlstd "html"
+	"html/template"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/simagix/gox"
+	"golang.org/x/text/language"
+	"golang.org/x/text/message"
+)
+
+// htmlReport stores contents of an offline HTML report
+type htmlReport struct {
+	Charts    []template.HTML
+	Summaries []string
+	Tables    []htmlTable
+	Title     string
+}
+
+// htmlTable stores a sortable table
+type htmlTable struct {
+	Caption string
+	Header  []string
+	Rows    [][]htmlCell
+}
+
+// htmlCell stores a table cell, sorted by key if it's a number
+type htmlCell struct {
+	Key     float64
+	Numeric bool
+	Pre     bool
+	Value   string
+}
+
+// textCell returns a text cell
+func textCell(v interface{}) htmlCell {
+	return htmlCell{Value: fmt.Sprint(v)}
+}
+
+// numCell returns a numeric cell
+func numCell(v float64, str string) htmlCell {
+	return htmlCell{Key: v, Numeric: true, Value: str}
+}
+
+// intCell returns a numeric cell of an integer with thousands separators
+func intCell(v int64) htmlCell {
+	printer := message.NewPrinter(language.English)
+	return numCell(float64(v), printer.Sprintf("%d", v))
+}
+
+// writeHTMLReport writes a report using the HTML template
+func writeHTMLReport(w io.Writer, report htmlReport) error {
+	templ, err := template.New("report").Parse(htmlReportTemplate)
+	if err != nil {
+		return err
+	}
+	return templ.Execute(w, report)
+}
+
+// getSVGBarChart returns a horizontal bar chart as inline SVG
+func getSVGBarChart(title string, labels []string, values []float64) template.HTML {
+	if len(values) == 0 {
+		return ""
+	}
+	max := 0.0
+	for _, v := range values {
+		if v > max {
+			max = v
+		}
+	}
+	if max == 0 {
+		max = 1
+	}
+	width, labelWidth, barHeight := 900, 360, 20
+	height := 30 + len(values)*barHeight
+	var buffer bytes.Buffer
+	buffer.WriteString(fmt.Sprintf(`<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d">`, width, height))
+	buffer.WriteString(fmt.Sprintf(`<text x="0" y="16" class="title">%v</text>`, htmlstd.EscapeString(title)))
+	for i, v := range values {
+		y := 26 + i*barHeight
+		label := labels[i]
+		if len(label) > 56 {
+			label = label[:53] + "..."
+		}
+		w := int(float64(width-labelWidth-80) * v / max)
+		buffer.WriteString(fmt.Sprintf(`<text x="%d" y="%d" text-anchor="end">%v</text>`, labelWidth-6, y+14, htmlstd.EscapeString(label)))
+		buffer.WriteString(fmt.Sprintf(`<rect x="%d" y="%d" width="%d" height="%d" class="bar"><title>%v: %v</title></rect>`,
+			labelWidth, y+2, w, barHeight-4, htmlstd.EscapeString(labels[i]), v))
+		buffer.WriteString(fmt.Sprintf(`<text x="%d" y="%d">%v</text>`, labelWidth+w+4, y+14, v))
+	}
+	buffer.WriteString(`</svg>`)
+	return template.HTML(buffer.String())
+}
+
+// getSVGLineChart returns a line chart of values over time as inline SVG
+func getSVGLineChart(title string, labels []string, values []float64) template.HTML {
+	if len(values) < 2 {
+		return ""
+	}
+	max := 0.0
+	for _, v := range values {
+		if v > max {
+			max = v
+		}
+	}
+	if max == 0 {
+		max = 1
+	}
+	width, height, left, top := 900, 240, 50, 30
+	plotWidth, plotHeight := width-left-10, height-top-30
+	points := []string{}
+	for i, v := range values {
+		x := left + plotWidth*i/(len(values)-1)
+		y := top + plotHeight - int(float64(plotHeight)*v/max)
+		points = append(points, fmt.Sprintf("%d,%d", x, y))
+	}
+	var buffer bytes.Buffer
+	buffer.WriteString(fmt.Sprintf(`<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d">`, width, height))
+	buffer.WriteString(fmt.Sprintf(`<text x="0" y="16" class="title">%v</text>`, htmlstd.EscapeString(title)))
+	buffer.WriteString(fmt.Sprintf(`<line x1="%d" y1="%d" x2="%d" y2="%d" class="axis"/>`, left, top+plotHeight, left+plotWidth, top+plotHeight))
+	buffer.WriteString(fmt.Sprintf(`<line x1="%d" y1="%d" x2="%d" y2="%d" class="axis"/>`, left, top, left, top+plotHeight))
+	buffer.WriteString(fmt.Sprintf(`<text x="%d" y="%d" text-anchor="end">%v</text>`, left-4, top+10, max))
+	buffer.WriteString(fmt.Sprintf(`<text x="%d" y="%d" text-anchor="end">0</text>`, left-4, top+plotHeight))
+	buffer.WriteString(fmt.Sprintf(`<text x="%d" y="%d">%v</text>`, left, height-8, htmlstd.EscapeString(labels[0])))
+	buffer.WriteString(fmt.Sprintf(`<text x="%d" y="%d" text-anchor="end">%v</text>`, left+plotWidth, height-8, htmlstd.EscapeString(labels[len(labels)-1])))
+	buffer.WriteString(fmt.Sprintf(`<polyline points="%v" class="line"/>`, strings.Join(points, " ")))
+	buffer.WriteString(`</svg>`)
+	return template.HTML(buffer.String())
+}
+
+// WriteHTML writes an offline HTML report of query patterns, histograms, and slow ops
+func (li *LogInfo) WriteHTML(w io.Writer) error {
+	report := htmlReport{Title: "Keyhole Logs Analytics",
+		Summaries: []string{fmt.Sprintf(`file: %v, version: %v, log type: %v`, li.filename, li.DBVersion, li.LogType)}}
+	labels, values := []string{}, []float64{}
+	for _, h := range li.Histograms {
+		total := 0
+		for _, n := range h.Ops {
+			total += n
+		}
+		labels = append(labels, h.UTC)
+		values = append(values, float64(total))
+	}
+	report.Charts = append(report.Charts, getSVGLineChart("Slow Ops per Minute", labels, values))
+	if len(li.Events.Timeline) > 0 {
+		labels, values = []string{}, []float64{}
+		for _, h := range li.Events.Timeline {
+			total := 0
+			for category, n := range h.Ops {
+				if category != EventConnection {
+					total += n
+				}
+			}
+			labels = append(labels, h.UTC)
+			values = append(values, float64(total))
+		}
+		report.Charts = append(report.Charts, getSVGLineChart("Events per Minute, Excluding Connections", labels, values))
+	}
+
+	patterns := append([]OpPattern{}, li.OpPatterns...)
+	sort.Slice(patterns, func(i, j int) bool { return patterns[i].TotalMilli > patterns[j].TotalMilli })
+	labels, values = []string{}, []float64{}
+	for i, op := range patterns {
+		if i >= 10 {
+			break
+		}
+		labels = append(labels, op.Command+" "+op.Namespace+" "+op.Filter)
+		values = append(values, float64(op.TotalMilli))
+	}
+	report.Charts = append(report.Charts, getSVGBarChart("Top Query Patterns by Total Milliseconds", labels, values))
+
+	table := htmlTable{Caption: "Query Patterns", Header: []string{"Command", "Namespace", "Count", "avg ms", "p50 ms",
+		"p95 ms", "p99 ms", "max ms", "Total ms", "Scan Ratio", "COLLSCAN", "Index", "Query Pattern"}}
+	for _, op := range li.OpPatterns {
+		avg := float64(op.TotalMilli) / float64(op.Count)
+		table.Rows = append(table.Rows, []htmlCell{textCell(op.Command), textCell(op.Namespace), intCell(int64(op.Count)),
+			numCell(avg, strings.TrimSpace(gox.MilliToTimeString(avg))), intCell(int64(op.Percentile(50))),
+			intCell(int64(op.Percentile(95))),
+			intCell(int64(op.Percentile(99))), intCell(int64(op.MaxMilli)), intCell(op.TotalMilli),
+			numCell(op.ScanRatio(), fmt.Sprintf("%.1f", op.ScanRatio())), textCell(op.Scan), textCell(op.Index),
+			textCell(op.Filter)})
+	}
+	report.Tables = append(report.Tables, table)
+	if len(li.Events.Catalogue) > 0 {
+		table = htmlTable{Caption: "Events", Header: []string{"Event", "Component", "id", "Count", "First", "Last", "Message"}}
+		for _, e := range li.Events.Catalogue {
+			table.Rows = append(table.Rows, []htmlCell{textCell(e.Category), textCell(e.Component), intCell(int64(e.ID)),
+				intCell(int64(e.Count)), textCell(e.First), textCell(e.Last), textCell(e.Message)})
+		}
+		report.Tables = append(report.Tables, table)
+		table = htmlTable{Caption: "Timeline of Notable Events", Header: []string{"Minute", "Events"}}
+		for _, h := range li.Events.GetNotableMinutes() {
+			strs := []string{}
+			for category, n := range h.Ops {
+				strs = append(strs, fmt.Sprintf("%v: %d", category, n))
+			}
+			sort.Strings(strs)
+			table.Rows = append(table.Rows, []htmlCell{textCell(h.UTC), textCell(strings.Join(strs, ", "))})
+		}
+		report.Tables = append(report.Tables, table)
+	}
+	if slowOps := li.getSlowOps(); len(slowOps) > 0 {
+		table = htmlTable{Caption: "Slowest Ops", Header: []string{"Milliseconds", "Log"}}
+		for _, op := range slowOps {
+			table.Rows = append(table.Rows, []htmlCell{intCell(int64(op.Milli)), {Pre: true, Value: op.Log}})
+		}
+		report.Tables = append(report.Tables, table)
+	}
+	return writeHTMLReport(w, report)
+}
+
+// WriteHTML writes an offline HTML report of indexes and their usages
+func (ix *IndexStats) WriteHTML(w io.Writer) error {
+	report := htmlReport{Title: "Keyhole Indexes Usages",
+		Summaries: []string{"x: redundant index, ?: unused index, *: shard key"}}
+	type usage struct {
+		label string
+		ops   int
+	}
+	usages := []usage{}
+	table := htmlTable{Caption: "Indexes", Header: []string{"", "Namespace", "Name", "Key", "Total Ops", "Unique",
+		"Sparse", "TTL", "Usages"}}
+	for _, db := range ix.Databases {
+		for _, coll := range db.Collections {
+			for _, o := range coll.Indexes {
+				flag := ""
+				if o.IsShardKey {
+					flag = "*"
+				} else if o.IsDupped {
+					flag = "x"
+				} else if o.KeyString != "{ _id: 1 }" && o.TotalOps == 0 && o.ExpireAfterSeconds < 0 {
+					flag = "?"
+				}
+				ttl := ""
+				if o.ExpireAfterSeconds >= 0 {
+					ttl = fmt.Sprint(o.ExpireAfterSeconds)
+				}
+				strs := []string{}
+				for _, u := range o.Usage {
+					strs = append(strs, fmt.Sprintf("%v: %v since %v", u.Host, u.Accesses.Ops, u.Accesses.Since.Format("2006-01-02T15:04:05")))
+				}
+				table.Rows = append(table.Rows, []htmlCell{textCell(flag), textCell(coll.NS), textCell(o.Name),
+					textCell(o.KeyString), intCell(int64(o.TotalOps)), textCell(o.Unique), textCell(o.Sparse),
+					textCell(ttl), {Pre: true, Value: strings.Join(strs, "\n")}})
+				usages = append(usages, usage{label: coll.NS + " " + o.KeyString, ops: o.TotalOps})
+			}
+		}
+	}
+	sort.Slice(usages, func(i, j int) bool { return usages[i].ops > usages[j].ops })
+	labels, values := []string{}, []float64{}
+	for i, u := range usages {
+		if i >= 10 {
+			break
+		}
+		labels = append(labels, u.label)
+		values = append(values, float64(u.ops))
+	}
+	report.Charts = append(report.Charts, getSVGBarChart("Most Used Indexes", labels, values))
+	report.Tables = append(report.Tables, table)
+	return writeHTMLReport(w, report)
+}
+
+// WriteHTML writes an offline HTML report of cluster summary, databases, and collections stats
+func (p *ClusterStats) WriteHTML(w io.Writer) error {
+	report := htmlReport{Title: "Keyhole Cluster Stats", Summaries: []string{p.GetShortSummary()}}
+	databases := []Database{}
+	if p.Databases != nil {
+		databases = *p.Databases
+	}
+	dbTable := htmlTable{Caption: "Databases", Header: []string{"Database", "Objects", "Data Size", "Storage Size",
+		"Index Size", "Indexes"}}
+	collTable := htmlTable{Caption: "Collections", Header: []string{"Namespace", "Documents", "Avg Size", "Data Size",
+		"Storage Size", "Indexes", "Index Size", "Sharded"}}
+	schemaTable := htmlTable{Caption: "Schema Warnings", Header: []string{"Namespace", "Samples", "Max Size", "Max Depth",
+		"Max Fields", "Warning"}}
+	type storage struct {
+		label string
+		size  int64
+	}
+	sizes := []storage{}
+	for _, db := range databases {
+		dbTable.Rows = append(dbTable.Rows, []htmlCell{textCell(db.Name), intCell(db.Stats.Objects), intCell(db.Stats.DataSize),
+			intCell(db.Stats.StorageSize), intCell(db.Stats.IndexSize), intCell(db.Stats.Indexes)})
+		for _, coll := range db.Collections {
+			stats := coll.Stats
+			collTable.Rows = append(collTable.Rows, []htmlCell{textCell(coll.NS), intCell(stats.Count),
+				intCell(int64(stats.AvgObjSize)), intCell(stats.Size), intCell(stats.StorageSize), intCell(stats.Nindexes),
+				intCell(stats.TotalIndexSize), textCell(stats.Sharded)})
+			sizes = append(sizes, storage{label: coll.NS, size: stats.StorageSize + stats.TotalIndexSize})
+			if coll.Schema == nil {
+				continue
+			}
+			for _, warning := range coll.Schema.Warnings {
+				schemaTable.Rows = append(schemaTable.Rows, []htmlCell{textCell(coll.NS), intCell(coll.Schema.Samples),
+					intCell(coll.Schema.MaxSize), intCell(int64(coll.Schema.MaxDepth)), intCell(int64(coll.Schema.MaxFields)),
+					textCell(warning)})
+			}
+		}
+	}
+	sort.Slice(sizes, func(i, j int) bool { return sizes[i].size > sizes[j].size })
+	labels, values := []string{}, []float64{}
+	for i, s := range sizes {
+		if i >= 10 {
+			break
+		}
+		labels = append(labels, s.label)
+		values = append(values, float64(s.size))
+	}
+	report.Charts = append(report.Charts, getSVGBarChart("Top Collections by Storage and Index Bytes", labels, values))
+	report.Tables = append(report.Tables, dbTable)
+	if len(collTable.Rows) > 0 {
+		report.Tables = append(report.Tables, collTable)
+	}
+	if len(schemaTable.Rows) > 0 {
+		report.Tables = append(report.Tables, schemaTable)
+	}
+	return writeHTMLReport(w, report)
+}
+
+const htmlReportTemplate = `<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>{{.Title}}</title>
+<style>
+  body { font-family: Helvetica, Arial, sans-serif; background-color: #f2f2f2; margin: 30px 60px; }
+  h1 { font-family: "Trebuchet MS"; font-size: 1.7em; }
+  table { font-family: Consolas, monaco, monospace; font-size: 12px; border-collapse: collapse; margin-bottom: 30px; }
+  caption { caption-side: top; font-weight: bold; font-style: italic; margin: 2px; text-align: left; }
+  table, th, td { border: 1px solid gray; vertical-align: top; }
+  th, td { padding: 2px 4px; }
+  th { background-color: #a0c3ff; cursor: pointer; white-space: nowrap; }
+  tr:nth-child(odd) { background-color: #f2f2f2; }
+  tr:nth-child(even) { background-color: #fff; }
+  td.num { text-align: right; }
+  pre { margin: 0; white-space: pre-wrap; word-break: break-all; }
+  svg { display: block; margin-bottom: 20px; font-size: 11px; background-color: #fff; }
+  svg .title { font-size: 14px; font-weight: bold; }
+  svg .bar { fill: #4a7fd4; }
+  svg .line { fill: none; stroke: #4a7fd4; stroke-width: 1.5; }
+  svg .axis { stroke: gray; }
+</style>
+</head>
+<body>
+<h1>{{.Title}}</h1>
+{{range .Summaries}}<p>{{.}}</p>
+{{end}}
+{{range .Charts}}{{.}}
+{{end}}
+{{range .Tables}}
+<table class="sortable">
+  <caption>{{.Caption}}</caption>
+  <tr>{{range .Header}}<th>{{.}}</th>{{end}}</tr>
+  {{range .Rows}}<tr>{{range .}}{{if .Numeric}}<td class="num" data-key="{{.Key}}">{{.Value}}</td>{{else if .Pre}}<td><pre>{{.Value}}</pre></td>{{else}}<td>{{.Value}}</td>{{end}}{{end}}</tr>
+  {{end}}
+</table>
+{{end}}
+<script>
+  document.querySelectorAll('table.sortable th').forEach(function(th) {
+    th.addEventListener('click', function() {
+      var table = th.closest('table');
+      var col = Array.prototype.indexOf.call(th.parentNode.children, th);
+      var asc = th.getAttribute('data-order') !== 'asc';
+      th.setAttribute('data-order', asc ? 'asc' : 'desc');
+      var rows = Array.prototype.slice.call(table.rows, 1);
+      rows.sort(function(a, b) {
+        var x = a.cells[col], y = b.cells[col];
+        var r = x.hasAttribute('data-key') ? parseFloat(x.getAttribute('data-key')) - parseFloat(y.getAttribute('data-key')) :
+          x.textContent.localeCompare(y.textContent);
+        return asc ? r : -r;
+      });
+      rows.forEach(function(row) { row.parentNode.appendChild(row); });
+    });
+  });
+</script>
+</body>
+</html>
+`
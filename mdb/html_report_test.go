@@ -0,0 +1,32 @@
+// Copyright 2020-present Kuei-chun Chen. All rights reserved.
+
+package mdb
+
+import (
+	"bufio"
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestLogInfoWriteHTML(t *testing.T) {
+	str := `{"t":{"$date":"2020-11-05T09:00:50.680+00:00"},"s":"I","c":"COMMAND","id":51803,"ctx":"conn1","msg":"Slow query","attr":{"type":"command","ns":"keyhole.cars","command":{"find":"cars","filter":{"color":"<red>"}},"planSummary":"COLLSCAN","reslen":100,"durationMillis":120}}`
+	loginfo := NewLogInfo("utest-xxxxxx")
+	loginfo.SetSilent(true)
+	if err := loginfo.Parse(bufio.NewReader(strings.NewReader(str))); err != nil {
+		t.Fatal(err)
+	}
+	var buffer bytes.Buffer
+	if err := loginfo.WriteHTML(&buffer); err != nil {
+		t.Fatal(err)
+	}
+	doc := buffer.String()
+	if strings.Contains(doc, "<script src=") || strings.Contains(doc, "<link ") {
+		t.Fatal("expected no external resources")
+	}
+	for _, s := range []string{"<svg ", `<table class="sortable">`, "<td>keyhole.cars</td>", `data-key="120"`, "&lt;red&gt;"} {
+		if !strings.Contains(doc, s) {
+			t.Fatal("expected", s)
+		}
+	}
+}
@@ -0,0 +1,437 @@
+// Copyright 2020-present Kuei-chun Chen. All rights reserved.
+
+package mdb
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/simagix/gox"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/x/mongo/driver/connstring"
+)
+
+// index advices
+const (
+	AdviceRedundantPrefix   = "redundant-prefix"
+	AdviceRedundantSuperset = "redundant-superset"
+	AdviceTTLOnly           = "ttl-only"
+	AdviceUnused            = "unused"
+)
+
+const (
+	dropScriptExt = "-drop-indexes.js"
+)
+
+// IndexAdvice stores an index to review and its costs
+type IndexAdvice struct {
+	Advice    string        `bson:"advice"`
+	CoveredBy string        `bson:"coveredBy,omitempty"` // key of the index serving the same queries
+	Hosts     int           `bson:"hosts"`               // number of hosts reporting usage
+	KeyString string        `bson:"keyString"`
+	Name      string        `bson:"name"`
+	Namespace string        `bson:"ns"`
+	Ops       int           `bson:"ops"`
+	Size      int64         `bson:"size"`   // index size in bytes of all shards
+	Window    time.Duration `bson:"window"` // shortest usage window of all hosts
+	Writes    int64         `bson:"writes"` // collection writes maintaining the index
+}
+
+// IndexAdvisor combines index usage from all members and shards and advises indexes to drop
+type IndexAdvisor struct {
+	Advices []IndexAdvice `bson:"advices"`
+
+	hideFirst bool
+	ix        *IndexStats
+	now       time.Time
+	sizes     map[string]map[string]int64 // index sizes by namespace and index name
+	writes    map[string]int64            // collection writes by namespace
+}
+
+// NewIndexAdvisor returns *IndexAdvisor of indexes collected by IndexStats
+func NewIndexAdvisor(ix *IndexStats) *IndexAdvisor {
+	return &IndexAdvisor{ix: ix, now: time.Now(), sizes: map[string]map[string]int64{}, writes: map[string]int64{}}
+}
+
+// SetHideFirst sets to hide indexes in the drop script, and to drop them after a review period
+func (ia *IndexAdvisor) SetHideFirst(hideFirst bool) {
+	ia.hideFirst = hideFirst
+}
+
+// CollectUsage replaces index usage with $indexStats of all data bearing members of all shards
+func (ia *IndexAdvisor) CollectUsage(client *mongo.Client, connString connstring.ConnString) error {
+	var err error
+	var uris []string
+	if uris, err = GetDataBearingServerURIs(client, connString); err != nil {
+		return err
+	}
+
+	usages := map[string][]IndexUsage{} // by namespace
+	if len(uris) == 0 {                 // standalone
+		usages, err = ia.getIndexUsage(client, "")
+		ia.setUsage(usages)
+		return err
+	}
+	var mu sync.Mutex
+	var e error
+	wg := gox.NewWaitGroup(6)
+	for i, uri := range uris {
+		wg.Add(1)
+		go func(uri string, n int) {
+			defer wg.Done()
+			sclient, err := NewMongoClient(uri)
+			if err == nil {
+				defer sclient.Disconnect(context.Background())
+				var result map[string][]IndexUsage
+				var setName string
+				if status, err := GetServerStatus(sclient); err == nil {
+					setName = status.Repl.SetName
+				}
+				if result, err = ia.getIndexUsage(sclient, setName); err == nil {
+					mu.Lock()
+					for ns, list := range result {
+						usages[ns] = append(usages[ns], list...)
+					}
+					mu.Unlock()
+					return
+				}
+			}
+			ia.ix.Logger.Errorf(`[t-%d] error: %v`, n, err)
+			mu.Lock()
+			e = err
+			mu.Unlock()
+		}(uri, i)
+	}
+	wg.Wait()
+	ia.setUsage(usages)
+	return e
+}
+
+// getIndexUsage returns $indexStats of collections from a server
+func (ia *IndexAdvisor) getIndexUsage(client *mongo.Client, shard string) (map[string][]IndexUsage, error) {
+	ctx := context.Background()
+	usages := map[string][]IndexUsage{}
+	for _, db := range ia.ix.Databases {
+		for _, coll := range db.Collections {
+			cur, err := client.Database(db.Name).Collection(coll.Name).Aggregate(ctx, MongoPipeline(`{"$indexStats": {}}`))
+			if err != nil {
+				return usages, err
+			}
+			for cur.Next(ctx) {
+				var usage IndexUsage
+				if err = cur.Decode(&usage); err != nil {
+					continue
+				}
+				if usage.Shard == "" {
+					usage.Shard = shard
+				}
+				usages[coll.NS] = append(usages[coll.NS], usage)
+			}
+			cur.Close(ctx)
+		}
+	}
+	return usages, nil
+}
+
+// setUsage replaces usage and total ops of indexes
+func (ia *IndexAdvisor) setUsage(usages map[string][]IndexUsage) {
+	for d, db := range ia.ix.Databases {
+		for c, coll := range db.Collections {
+			list, ok := usages[coll.NS]
+			if !ok {
+				continue
+			}
+			for i := range coll.Indexes {
+				index := &ia.ix.Databases[d].Collections[c].Indexes[i]
+				index.TotalOps = 0
+				index.Usage = []IndexUsage{}
+				for _, usage := range list {
+					if usage.Name == index.Name {
+						index.TotalOps += usage.Accesses.Ops
+						index.Usage = append(index.Usage, usage)
+					}
+				}
+				sort.Slice(index.Usage, func(x int, y int) bool {
+					return index.Usage[x].Shard+index.Usage[x].Host < index.Usage[y].Shard+index.Usage[y].Host
+				})
+			}
+		}
+	}
+}
+
+// CollectCosts collects index sizes and collection writes of all shards
+func (ia *IndexAdvisor) CollectCosts(client *mongo.Client) error {
+	ctx := context.Background()
+	pipeline := MongoPipeline(`{"$collStats": {"storageStats": {}, "latencyStats": {}}}`)
+	for _, db := range ia.ix.Databases {
+		for _, coll := range db.Collections {
+			cur, err := client.Database(db.Name).Collection(coll.Name).Aggregate(ctx, pipeline)
+			if err != nil {
+				return err
+			}
+			ia.sizes[coll.NS] = map[string]int64{}
+			for cur.Next(ctx) { // a document of each shard
+				var doc struct {
+					LatencyStats struct {
+						Writes struct {
+							Ops int64 `bson:"ops"`
+						} `bson:"writes"`
+					} `bson:"latencyStats"`
+					StorageStats struct {
+						IndexSizes map[string]int64 `bson:"indexSizes"`
+					} `bson:"storageStats"`
+				}
+				if err = cur.Decode(&doc); err != nil {
+					continue
+				}
+				ia.writes[coll.NS] += doc.LatencyStats.Writes.Ops
+				for name, size := range doc.StorageStats.IndexSizes {
+					ia.sizes[coll.NS][name] += size
+				}
+			}
+			cur.Close(ctx)
+		}
+	}
+	return nil
+}
+
+// Advise classifies indexes as redundant, TTL only, or unused
+func (ia *IndexAdvisor) Advise() []IndexAdvice {
+	ia.Advices = []IndexAdvice{}
+	for _, db := range ia.ix.Databases {
+		for _, coll := range db.Collections {
+			advices := []IndexAdvice{}
+			for _, index := range coll.Indexes {
+				if index.Name == "_id_" || index.IsShardKey {
+					continue
+				}
+				advice := IndexAdvice{KeyString: index.KeyString, Name: index.Name, Namespace: coll.NS,
+					Ops: index.TotalOps, Hosts: len(index.Usage), Size: ia.sizes[coll.NS][index.Name], Writes: ia.writes[coll.NS]}
+				for _, usage := range index.Usage {
+					if window := ia.now.Sub(usage.Accesses.Since); advice.Window == 0 || window < advice.Window {
+						advice.Window = window
+					}
+				}
+				if index.ExpireAfterSeconds >= 0 {
+					if index.TotalOps == 0 {
+						advice.Advice = AdviceTTLOnly
+						advices = append(advices, advice)
+					}
+					continue
+				}
+				if advice.Advice, advice.CoveredBy = getRedundancy(index, coll.Indexes); advice.Advice == "" && index.TotalOps == 0 {
+					advice.Advice = AdviceUnused
+				}
+				if advice.Advice != "" {
+					advices = append(advices, advice)
+				}
+			}
+			covering := map[string]bool{}
+			for _, advice := range advices {
+				if advice.CoveredBy != "" {
+					covering[advice.CoveredBy] = true
+				}
+			}
+			for _, advice := range advices { // keeps an unused index replacing a redundant one
+				if advice.Advice != AdviceUnused || !covering[advice.KeyString] {
+					ia.Advices = append(ia.Advices, advice)
+				}
+			}
+		}
+	}
+	sort.Slice(ia.Advices, func(i int, j int) bool {
+		if ia.Advices[i].Size == ia.Advices[j].Size {
+			return ia.Advices[i].Namespace+ia.Advices[i].Name < ia.Advices[j].Namespace+ia.Advices[j].Name
+		}
+		return ia.Advices[i].Size > ia.Advices[j].Size
+	})
+	return ia.Advices
+}
+
+// getRedundancy returns an advice and the key of another index serving all queries of an index.  A
+// hidden index serves no queries and never covers another.
+func getRedundancy(index Index, list []Index) (string, string) {
+	if index.Unique || index.Weights != nil {
+		return "", "" // a unique constraint cannot be replaced
+	}
+	for _, other := range list {
+		if other.Name == index.Name || other.Hidden || !reflect.DeepEqual(index.Collation, other.Collation) {
+			continue
+		}
+		prefix, equal := isKeyPrefix(index.Key, other.Key)
+		if !prefix {
+			continue
+		}
+		if hasSameFilters(index, other) {
+			if !equal {
+				return AdviceRedundantPrefix, other.KeyString
+			} else if other.Unique {
+				return AdviceRedundantSuperset, other.KeyString
+			}
+		} else if (index.Sparse || index.PartialFilterExpression != nil) && !other.Sparse && other.PartialFilterExpression == nil {
+			return AdviceRedundantSuperset, other.KeyString
+		}
+	}
+	return "", ""
+}
+
+// hasSameFilters returns true if both indexes have the same sparse and partial filter
+func hasSameFilters(index Index, other Index) bool {
+	return index.Sparse == other.Sparse && reflect.DeepEqual(index.PartialFilterExpression, other.PartialFilterExpression)
+}
+
+// isKeyPrefix returns true if fields of a key are a prefix of another key in the same or all reversed
+// directions, and whether they are equal.  Special indexes, e.g. hashed, text, and geo, are not compared.
+func isKeyPrefix(key bson.D, other bson.D) (bool, bool) {
+	if len(key) == 0 || len(key) > len(other) {
+		return false, false
+	}
+	reversed := false
+	for i, elem := range key {
+		x, ok := getKeyDirection(elem.Value)
+		y, ok2 := getKeyDirection(other[i].Value)
+		if !ok || !ok2 || elem.Key != other[i].Key || strings.Contains(elem.Key, "$**") {
+			return false, false
+		}
+		if i == 0 {
+			reversed = x != y
+		} else if (x != y) != reversed {
+			return false, false
+		}
+	}
+	for _, elem := range other[len(key):] {
+		if _, ok := getKeyDirection(elem.Value); !ok {
+			return false, false
+		}
+	}
+	return true, len(key) == len(other)
+}
+
+// getKeyDirection returns 1 or -1 of an ascending or descending key
+func getKeyDirection(value interface{}) (int, bool) {
+	var v float64
+	switch n := value.(type) {
+	case int32:
+		v = float64(n)
+	case int64:
+		v = float64(n)
+	case float64:
+		v = n
+	default:
+		return 0, false
+	}
+	if v > 0 {
+		return 1, true
+	} else if v < 0 {
+		return -1, true
+	}
+	return 0, false
+}
+
+// Print prints advices
+func (ia *IndexAdvisor) Print() {
+	fmt.Println(ia.printAdvisorSummary())
+}
+
+// printAdvisorSummary returns indexes to review with costs
+func (ia *IndexAdvisor) printAdvisorSummary() string {
+	var buffer bytes.Buffer
+	var size int64
+	for _, advice := range ia.Advices {
+		size += advice.Size
+	}
+	buffer.WriteString(fmt.Sprintf("\nIndex advisor: %d indexes to review, %v of storage\n", len(ia.Advices), getStorageSize(size)))
+	buffer.WriteString("+--------------------+------------------------------+------------------------------------+---------+----------+--------+-------+\n")
+	buffer.WriteString("| Advice             | Namespace                    | Index Key                          |    Size |   Writes |    Ops | Window|\n")
+	buffer.WriteString("|--------------------+------------------------------+------------------------------------+---------+----------+--------+-------|\n")
+	for _, advice := range ia.Advices {
+		ns := advice.Namespace
+		if len(ns) > 28 {
+			ns = ns[:25] + "..."
+		}
+		key := advice.KeyString
+		if len(key) > 34 {
+			key = key[:31] + "..."
+		}
+		buffer.WriteString(fmt.Sprintf("| %-18v | %-28v | %-34v | %7v | %8d | %6d | %5v |\n", advice.Advice, ns, key,
+			getStorageSize(advice.Size), advice.Writes, advice.Ops, getWindowString(advice.Window)))
+	}
+	buffer.WriteString("+--------------------+------------------------------+------------------------------------+---------+----------+--------+-------+\n")
+	buffer.WriteString("writes: collection writes since restarts, each insert and delete, and updates of indexed fields, maintain the index\n")
+	buffer.WriteString("window: shortest usage window of all members, usage is reset when a server restarts\n")
+	for _, advice := range ia.Advices {
+		if advice.CoveredBy != "" {
+			buffer.WriteString(fmt.Sprintf("%v %v is covered by %v\n", advice.Namespace, advice.KeyString, advice.CoveredBy))
+		}
+	}
+	return buffer.String()
+}
+
+// getStorageSize returns a size in KB, MB, or GB
+func getStorageSize(size int64) string {
+	if size >= 1024*1024*1024 {
+		return fmt.Sprintf("%.1fGB", float64(size)/(1024*1024*1024))
+	} else if size >= 1024*1024 {
+		return fmt.Sprintf("%.1fMB", float64(size)/(1024*1024))
+	}
+	return fmt.Sprintf("%.1fKB", float64(size)/1024)
+}
+
+// getWindowString returns a usage window in days or hours
+func getWindowString(window time.Duration) string {
+	if window >= 24*time.Hour {
+		return fmt.Sprintf("%dd", int(window.Hours()/24))
+	}
+	return fmt.Sprintf("%dh", int(window.Hours()))
+}
+
+// GetDropScript returns a mongo shell script to hide or drop indexes, excluding TTL only indexes
+func (ia *IndexAdvisor) GetDropScript() string {
+	var buffer bytes.Buffer
+	buffer.WriteString(fmt.Sprintf("// keyhole index advisor, %v, review before running\n", ia.now.Format(time.RFC3339)))
+	if ia.hideFirst {
+		buffer.WriteString("// hidden indexes are maintained but not used by queries, unhideIndex() to roll back,\n")
+		buffer.WriteString("// and uncomment dropIndex() after a review period\n")
+	}
+	for _, advice := range ia.Advices {
+		buffer.WriteString(fmt.Sprintf("\n// %v %v, %v, %d ops in %v", advice.Namespace, advice.KeyString, advice.Advice,
+			advice.Ops, getWindowString(advice.Window)))
+		if advice.CoveredBy != "" {
+			buffer.WriteString(", covered by " + advice.CoveredBy)
+		}
+		buffer.WriteString("\n")
+		if advice.Advice == AdviceTTLOnly {
+			buffer.WriteString("// kept, used by the TTL monitor to delete expired documents\n")
+			continue
+		}
+		dbName, collName := SplitNamespace(advice.Namespace)
+		coll := fmt.Sprintf("db.getSiblingDB(%q).getCollection(%q)", dbName, collName)
+		if ia.hideFirst {
+			buffer.WriteString(fmt.Sprintf("%v.hideIndex(%q);\n", coll, advice.Name))
+			buffer.WriteString(fmt.Sprintf("// %v.dropIndex(%q);\n", coll, advice.Name))
+		} else {
+			buffer.WriteString(fmt.Sprintf("%v.dropIndex(%q);\n", coll, advice.Name))
+		}
+	}
+	return buffer.String()
+}
+
+// OutputDropScript writes the drop script to a file
+func (ia *IndexAdvisor) OutputDropScript() (string, error) {
+	os.Mkdir(outdir, 0755)
+	basename := strings.TrimSuffix(ia.ix.filename, indexExt)
+	ofile := fmt.Sprintf(`%v/%v%v`, outdir, basename, dropScriptExt)
+	if err := os.WriteFile(ofile, []byte(ia.GetDropScript()), 0644); err != nil {
+		return ofile, err
+	}
+	fmt.Println("Drop script is written to", ofile)
+	return ofile, nil
+}
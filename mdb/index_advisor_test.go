@@ -0,0 +1,103 @@
+// Copyright 2020-present Kuei-chun Chen. All rights reserved.
+
+package mdb
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func getAdvisorIndex(name string, keyString string, key bson.D, ops int) Index {
+	since := time.Now().Add(-72 * time.Hour)
+	return Index{Name: name, Key: key, KeyString: keyString, ExpireAfterSeconds: -1, TotalOps: ops,
+		Usage: []IndexUsage{{Accesses: Accesses{Ops: ops, Since: since}, Host: "host1:27017", Name: name, Shard: "rs0"},
+			{Accesses: Accesses{Since: since.Add(24 * time.Hour)}, Host: "host2:27017", Name: name, Shard: "rs0"}}}
+}
+
+func TestIsKeyPrefix(t *testing.T) {
+	ab := bson.D{{Key: "a", Value: int32(1)}, {Key: "b", Value: int32(-1)}}
+	if prefix, equal := isKeyPrefix(bson.D{{Key: "a", Value: -1.0}}, ab); !prefix || equal {
+		t.Fatal("expected a prefix")
+	}
+	if prefix, _ := isKeyPrefix(bson.D{{Key: "a", Value: int32(-1)}, {Key: "b", Value: int32(-1)}}, ab); prefix {
+		t.Fatal("expected mixed directions not a prefix")
+	}
+	if prefix, _ := isKeyPrefix(bson.D{{Key: "a", Value: "hashed"}}, ab); prefix {
+		t.Fatal("expected a hashed key not a prefix")
+	}
+	if prefix, equal := isKeyPrefix(ab, ab); !prefix || !equal {
+		t.Fatal("expected equal keys")
+	}
+}
+
+func TestIndexAdvisor(t *testing.T) {
+	ix := NewIndexStats("utest-xxxxxx")
+	sparse := getAdvisorIndex("email_1", "{ email: 1 }", bson.D{{Key: "email", Value: int32(1)}}, 5)
+	sparse.Sparse = true
+	unique := getAdvisorIndex("email_1_name_1", "{ email: 1, name: 1 }", bson.D{{Key: "email", Value: int32(1)}, {Key: "name", Value: int32(1)}}, 9)
+	unique.Unique = true
+	ttl := getAdvisorIndex("ts_1", "{ ts: 1 }", bson.D{{Key: "ts", Value: int32(1)}}, 0)
+	ttl.ExpireAfterSeconds = 3600
+	indexes := []Index{getAdvisorIndex("_id_", "{ _id: 1 }", bson.D{{Key: "_id", Value: int32(1)}}, 0),
+		getAdvisorIndex("a_1", "{ a: 1 }", bson.D{{Key: "a", Value: int32(1)}}, 7),
+		getAdvisorIndex("a_1_b_1", "{ a: 1, b: 1 }", bson.D{{Key: "a", Value: int32(1)}, {Key: "b", Value: int32(1)}}, 3),
+		getAdvisorIndex("c_1", "{ c: 1 }", bson.D{{Key: "c", Value: int32(1)}}, 0), sparse, unique, ttl}
+	ix.Databases = []Database{{Name: "keyhole", Collections: []Collection{{Name: "users", NS: "keyhole.users", Indexes: indexes}}}}
+
+	advisor := NewIndexAdvisor(ix)
+	advisor.sizes["keyhole.users"] = map[string]int64{"a_1": 4096, "c_1": 8192, "email_1": 1024}
+	advisor.writes["keyhole.users"] = 1000
+	advices := map[string]IndexAdvice{}
+	for _, advice := range advisor.Advise() {
+		advices[advice.Name] = advice
+	}
+	if len(advices) != 4 || advices["a_1"].Advice != AdviceRedundantPrefix || advices["c_1"].Advice != AdviceUnused ||
+		advices["email_1"].Advice != AdviceRedundantSuperset || advices["ts_1"].Advice != AdviceTTLOnly {
+		t.Fatal("unexpected advices", advices)
+	}
+	if advisor.Advices[0].Name != "c_1" || advices["a_1"].Window.Round(time.Hour) != 48*time.Hour || advices["a_1"].Hosts != 2 {
+		t.Fatal("unexpected costs", advisor.Advices[0])
+	}
+	t.Log(advisor.printAdvisorSummary())
+
+	advisor.SetHideFirst(true)
+	script := advisor.GetDropScript()
+	if !strings.Contains(script, `db.getSiblingDB("keyhole").getCollection("users").hideIndex("c_1");`) ||
+		!strings.Contains(script, `// db.getSiblingDB("keyhole").getCollection("users").dropIndex("c_1");`) ||
+		strings.Contains(script, `hideIndex("ts_1")`) {
+		t.Fatal("unexpected script", script)
+	}
+	t.Log(script)
+}
+
+func TestIndexAdvisorKeepsCoveringIndex(t *testing.T) {
+	ix := NewIndexStats("utest-xxxxxx")
+	hidden := getAdvisorIndex("x_1_y_1", "{ x: 1, y: 1 }", bson.D{{Key: "x", Value: int32(1)}, {Key: "y", Value: int32(1)}}, 0)
+	hidden.Hidden = true
+	indexes := []Index{getAdvisorIndex("_id_", "{ _id: 1 }", bson.D{{Key: "_id", Value: int32(1)}}, 0),
+		getAdvisorIndex("a_1", "{ a: 1 }", bson.D{{Key: "a", Value: int32(1)}}, 7),
+		getAdvisorIndex("a_1_b_1", "{ a: 1, b: 1 }", bson.D{{Key: "a", Value: int32(1)}, {Key: "b", Value: int32(1)}}, 0),
+		getAdvisorIndex("x_1", "{ x: 1 }", bson.D{{Key: "x", Value: int32(1)}}, 5), hidden}
+	ix.Databases = []Database{{Name: "keyhole", Collections: []Collection{{Name: "users", NS: "keyhole.users", Indexes: indexes}}}}
+
+	advisor := NewIndexAdvisor(ix)
+	advices := map[string]IndexAdvice{}
+	for _, advice := range advisor.Advise() {
+		advices[advice.Name] = advice
+	}
+	if advices["a_1"].Advice != AdviceRedundantPrefix || advices["a_1"].CoveredBy != "{ a: 1, b: 1 }" {
+		t.Fatal("expected a_1 covered by a_1_b_1", advices)
+	}
+	if _, ok := advices["a_1_b_1"]; ok {
+		t.Fatal("expected an unused index covering a_1 kept", advices["a_1_b_1"])
+	}
+	if _, ok := advices["x_1"]; ok {
+		t.Fatal("expected x_1 not covered by a hidden index", advices["x_1"])
+	}
+	if advices["x_1_y_1"].Advice != AdviceUnused || len(advices) != 2 {
+		t.Fatal("unexpected advices", advices)
+	}
+}
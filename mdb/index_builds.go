@@ -0,0 +1,362 @@
+// Copyright 2020-present Kuei-chun Chen. All rights reserved.
+
+package mdb
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/x/mongo/driver/connstring"
+)
+
+// IndexBuild stores progress of an index build on a member
+type IndexBuild struct {
+	CommitQuorum string   `bson:"commitQuorum,omitempty"`
+	Done         int64    `bson:"done"`
+	Elapsed      int64    `bson:"elapsedSecs"`
+	Error        string   `bson:"error,omitempty"` // error of a member not reachable
+	ETA          int64    `bson:"etaSecs"`         // -1 if unknown
+	Host         string   `bson:"host"`
+	Indexes      []string `bson:"indexes"`
+	Namespace    string   `bson:"ns"`
+	Phase        string   `bson:"phase"`
+	Shard        string   `bson:"shard"`
+	Total        int64    `bson:"total"`
+	Waiting      bool     `bson:"waitingForCommitQuorum"`
+}
+
+// indexBuildOp stores fields of an index build op of $currentOp
+type indexBuildOp struct {
+	Command struct {
+		CommitQuorum  interface{} `bson:"commitQuorum"`
+		CreateIndexes string      `bson:"createIndexes"`
+		Indexes       []struct {
+			Name string `bson:"name"`
+		} `bson:"indexes"`
+	} `bson:"command"`
+	Msg       string `bson:"msg"`
+	Namespace string `bson:"ns"`
+	Progress  struct {
+		Done  int64 `bson:"done,truncate"`
+		Total int64 `bson:"total,truncate"`
+	} `bson:"progress"`
+	SecsRunning int64 `bson:"secs_running,truncate"`
+}
+
+// indexBuildMember stores a client of a data bearing member, reconnected if failed
+type indexBuildMember struct {
+	client *mongo.Client
+	host   string
+	uri    string // empty if the client is not owned
+}
+
+// indexBuildSample stores keys processed at a time to calculate rates
+type indexBuildSample struct {
+	done  int64
+	phase string
+	time  time.Time
+}
+
+// IndexBuildMonitor watches active index builds of all data bearing members
+type IndexBuildMonitor struct {
+	Builds []IndexBuild `bson:"builds"`
+
+	done     chan struct{}
+	format   string
+	interval time.Duration
+	nocolor  bool
+	samples  map[string]indexBuildSample
+}
+
+// NewIndexBuildMonitor returns *IndexBuildMonitor
+func NewIndexBuildMonitor() *IndexBuildMonitor {
+	return &IndexBuildMonitor{done: make(chan struct{}), interval: 5 * time.Second, samples: map[string]indexBuildSample{}}
+}
+
+// SetFormat sets output format, json for a JSON line of each build of each refresh
+func (m *IndexBuildMonitor) SetFormat(format string) {
+	m.format = format
+}
+
+// SetInterval sets refresh interval
+func (m *IndexBuildMonitor) SetInterval(interval time.Duration) {
+	m.interval = interval
+}
+
+// SetNoColor prints tables without clearing screen
+func (m *IndexBuildMonitor) SetNoColor(nocolor bool) {
+	m.nocolor = nocolor
+}
+
+// Stop stops watching
+func (m *IndexBuildMonitor) Stop() {
+	close(m.done)
+}
+
+// Watch refreshes index builds of all members until interrupted or stopped, a member
+// not reachable is reported as an error row and retried at the next refresh
+func (m *IndexBuildMonitor) Watch(client *mongo.Client, connString connstring.ConnString) error {
+	var err error
+	var uris []string
+	if uris, err = GetDataBearingServerURIs(client, connString); err != nil {
+		return err
+	}
+	members := []*indexBuildMember{}
+	if len(uris) == 0 { // standalone
+		members = append(members, &indexBuildMember{client: client, host: strings.Join(connString.Hosts, ",")})
+	}
+	for _, uri := range uris {
+		member := &indexBuildMember{host: uri, uri: uri}
+		if cs, err := connstring.Parse(uri); err == nil {
+			member.host = strings.Join(cs.Hosts, ",")
+		}
+		members = append(members, member)
+	}
+	defer func() {
+		for _, member := range members {
+			if member.uri != "" && member.client != nil {
+				member.client.Disconnect(context.Background())
+			}
+		}
+	}()
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(sig)
+	ticker := time.NewTicker(m.interval)
+	defer ticker.Stop()
+	for {
+		m.refresh(members)
+		if err = m.Print(); err != nil {
+			return err
+		}
+		select {
+		case <-m.done:
+			return nil
+		case <-sig:
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// refresh collects index builds from all members, and an error row of each member failed
+func (m *IndexBuildMonitor) refresh(members []*indexBuildMember) {
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	builds := []IndexBuild{}
+	now := time.Now()
+	for _, member := range members {
+		wg.Add(1)
+		go func(member *indexBuildMember) {
+			defer wg.Done()
+			var err error
+			var list []IndexBuild
+			if member.client == nil {
+				member.client, err = NewMongoClient(member.uri)
+			}
+			if err == nil {
+				list, err = getIndexBuilds(member.client)
+			}
+			if err != nil {
+				list = []IndexBuild{{Error: err.Error(), Host: member.host, Indexes: []string{}}}
+			}
+			mu.Lock()
+			builds = append(builds, list...)
+			mu.Unlock()
+		}(member)
+	}
+	wg.Wait()
+	m.setBuilds(builds, now)
+}
+
+// setBuilds sets builds and their ETAs from rates of keys processed since the last refresh
+func (m *IndexBuildMonitor) setBuilds(builds []IndexBuild, now time.Time) {
+	samples := map[string]indexBuildSample{}
+	for i, build := range builds {
+		builds[i].ETA = -1
+		if build.Total == 0 || build.Waiting || build.Error != "" {
+			continue
+		}
+		key := build.Host + "/" + build.Namespace + "/" + strings.Join(build.Indexes, ",")
+		samples[key] = indexBuildSample{done: build.Done, phase: build.Phase, time: now}
+		prev, ok := m.samples[key]
+		if ok && prev.phase == build.Phase && build.Done > prev.done {
+			rate := float64(build.Done-prev.done) / now.Sub(prev.time).Seconds()
+			builds[i].ETA = int64(float64(build.Total-build.Done) / rate)
+		} else if build.Done > 0 && build.Elapsed > 0 { // first sample, assumes the same rate since the beginning
+			builds[i].ETA = build.Elapsed * (build.Total - build.Done) / build.Done
+		}
+	}
+	sort.Slice(builds, func(i int, j int) bool {
+		if builds[i].Namespace != builds[j].Namespace {
+			return builds[i].Namespace < builds[j].Namespace
+		} else if builds[i].Shard != builds[j].Shard {
+			return builds[i].Shard < builds[j].Shard
+		}
+		return builds[i].Host < builds[j].Host
+	})
+	m.Builds = builds
+	m.samples = samples
+}
+
+// getIndexBuilds returns active index builds of a member from $currentOp
+func getIndexBuilds(client *mongo.Client) ([]IndexBuild, error) {
+	ctx := context.Background()
+	var host, shard string
+	if status, err := GetServerStatus(client); err == nil {
+		host, shard = status.Host, status.Repl.SetName
+	}
+	pipeline := MongoPipeline(`[{"$currentOp": {"allUsers": true, "idleConnections": true}},
+		{"$match": {"$or": [{"command.createIndexes": {"$exists": true}}, {"msg": {"$regex": "^Index Build"}}]}}]`)
+	cur, err := client.Database("admin").Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, err
+	}
+	defer cur.Close(ctx)
+	builds := map[string]*IndexBuild{}
+	keys := []string{}
+	for cur.Next(ctx) {
+		var op indexBuildOp
+		if err = cur.Decode(&op); err != nil {
+			continue
+		}
+		build := toIndexBuild(op)
+		build.Host, build.Shard = host, shard
+		key := build.Namespace + "/" + strings.Join(build.Indexes, ",")
+		if prev, ok := builds[key]; ok { // client createIndexes op and the build op
+			mergeIndexBuild(prev, build)
+			continue
+		}
+		builds[key] = &build
+		keys = append(keys, key)
+	}
+	list := []IndexBuild{}
+	for _, key := range keys {
+		build := builds[key]
+		setPendingPhase(build)
+		list = append(list, *build)
+	}
+	return list, nil
+}
+
+// setPendingPhase labels a build of which only the createIndexes op is active, waiting for
+// commit quorum only if the commitQuorum is specified or the op says so
+func setPendingPhase(build *IndexBuild) {
+	if build.Phase != "" || build.Total > 0 {
+		return
+	}
+	build.Waiting = build.Waiting || build.CommitQuorum != ""
+	build.Phase = "no progress reported"
+	if build.Waiting {
+		build.Phase = "waiting for commit quorum"
+	}
+}
+
+// toIndexBuild returns an index build of an op
+func toIndexBuild(op indexBuildOp) IndexBuild {
+	build := IndexBuild{Done: op.Progress.Done, Elapsed: op.SecsRunning, Indexes: []string{},
+		Namespace: op.Namespace, Total: op.Progress.Total}
+	if strings.HasSuffix(op.Namespace, ".$cmd") && op.Command.CreateIndexes != "" { // the createIndexes op
+		build.Namespace = strings.TrimSuffix(op.Namespace, "$cmd") + op.Command.CreateIndexes
+	}
+	for _, index := range op.Command.Indexes {
+		build.Indexes = append(build.Indexes, index.Name)
+	}
+	if op.Command.CommitQuorum != nil {
+		build.CommitQuorum = fmt.Sprint(op.Command.CommitQuorum)
+	}
+	if strings.HasPrefix(op.Msg, "Index Build") { // e.g. Index Build: scanning collection Index Build: scanning collection: 1/10 10%
+		phase := strings.TrimPrefix(op.Msg, "Index Build: ")
+		if i := strings.Index(phase, " Index Build"); i > 0 {
+			phase = phase[:i]
+		}
+		build.Phase = phase
+	}
+	build.Waiting = strings.Contains(strings.ToLower(op.Msg), "commit quorum")
+	return build
+}
+
+// mergeIndexBuild merges ops of the same build
+func mergeIndexBuild(build *IndexBuild, other IndexBuild) {
+	if other.CommitQuorum != "" {
+		build.CommitQuorum = other.CommitQuorum
+	}
+	if other.Phase != "" {
+		build.Phase, build.Done, build.Total = other.Phase, other.Done, other.Total
+	}
+	if other.Elapsed > build.Elapsed {
+		build.Elapsed = other.Elapsed
+	}
+	build.Waiting = build.Waiting || other.Waiting
+}
+
+// Print prints a table of index builds, or a JSON line of each build
+func (m *IndexBuildMonitor) Print() error {
+	if m.format != "json" {
+		if !m.nocolor {
+			fmt.Print("\033[H\033[2J") // clears screen
+		}
+		fmt.Println(m.printIndexBuildsSummary(time.Now()))
+		return nil
+	}
+	for _, build := range m.Builds {
+		data, err := bson.MarshalExtJSON(build, false, false)
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(data))
+	}
+	return nil
+}
+
+// printIndexBuildsSummary returns a table of index builds
+func (m *IndexBuildMonitor) printIndexBuildsSummary(now time.Time) string {
+	var buffer bytes.Buffer
+	active := 0
+	for _, build := range m.Builds {
+		if build.Error == "" {
+			active++
+		}
+	}
+	buffer.WriteString(fmt.Sprintf("\nIndex builds at %v, %d active\n", now.Format(time.RFC3339), active))
+	if len(m.Builds) == 0 {
+		return buffer.String()
+	}
+	buffer.WriteString("+--------------------------------+----------------------+------------------------------------------+---------------------------+-----------+-----------+\n")
+	buffer.WriteString("| Namespace / Indexes            | Shard / Host         | Phase                                    |            Keys Processed |   Elapsed |       ETA |\n")
+	buffer.WriteString("|--------------------------------+----------------------+------------------------------------------+---------------------------+-----------+-----------|\n")
+	for _, build := range m.Builds {
+		progress := "-"
+		if build.Total > 0 {
+			progress = fmt.Sprintf("%d/%d (%.0f%%)", build.Done, build.Total, 100*float64(build.Done)/float64(build.Total))
+		}
+		eta := "-"
+		if build.ETA >= 0 {
+			eta = fmt.Sprint(time.Duration(build.ETA) * time.Second)
+		}
+		phase := build.Phase
+		if build.Error != "" {
+			phase = "error: " + build.Error
+		}
+		buffer.WriteString(fmt.Sprintf("| %-30v | %-20v | %-40v | %25v | %9v | %9v |\n", truncate(build.Namespace, 30),
+			truncate(build.Shard, 20), truncate(phase, 40), progress, time.Duration(build.Elapsed)*time.Second, eta))
+		quorum := ""
+		if build.CommitQuorum != "" {
+			quorum = "commitQuorum: " + build.CommitQuorum
+		}
+		buffer.WriteString(fmt.Sprintf("|   %-28v | %-20v | %-40v | %25v | %9v | %9v |\n", truncate(strings.Join(build.Indexes, ","), 28),
+			truncate(build.Host, 20), truncate(quorum, 40), "", "", ""))
+	}
+	buffer.WriteString("+--------------------------------+----------------------+------------------------------------------+---------------------------+-----------+-----------+\n")
+	return buffer.String()
+}
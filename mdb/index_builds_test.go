@@ -0,0 +1,67 @@
+// Copyright 2020-present Kuei-chun Chen. All rights reserved.
+
+package mdb
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestToIndexBuild(t *testing.T) {
+	var op indexBuildOp
+	op.Namespace = "keyhole.$cmd"
+	op.Command.CreateIndexes = "orders"
+	op.Command.CommitQuorum = "majority"
+	op.Command.Indexes = append(op.Command.Indexes, struct {
+		Name string `bson:"name"`
+	}{Name: "email_1"})
+	build := toIndexBuild(op)
+	if build.Namespace != "keyhole.orders" || build.CommitQuorum != "majority" || build.Phase != "" {
+		t.Fatal("unexpected createIndexes op", build)
+	}
+	pending := build
+	setPendingPhase(&pending)
+	if !pending.Waiting || pending.Phase != "waiting for commit quorum" {
+		t.Fatal("expected waiting for commit quorum", pending)
+	}
+	pending = IndexBuild{Namespace: "keyhole.orders"}
+	setPendingPhase(&pending)
+	if pending.Waiting || pending.Phase != "no progress reported" {
+		t.Fatal("expected not waiting without a commitQuorum", pending)
+	}
+
+	op.Namespace = "keyhole.orders"
+	op.Command.CommitQuorum = nil
+	op.Msg = "Index Build: scanning collection Index Build: scanning collection: 250/1000 25%"
+	op.Progress.Done, op.Progress.Total, op.SecsRunning = 250, 1000, 30
+	mergeIndexBuild(&build, toIndexBuild(op))
+	if build.Phase != "scanning collection" || build.Done != 250 || build.Elapsed != 30 || build.CommitQuorum != "majority" {
+		t.Fatal("unexpected merged build", build)
+	}
+}
+
+func TestIndexBuildMonitor(t *testing.T) {
+	now := time.Now()
+	m := NewIndexBuildMonitor()
+	build := IndexBuild{Done: 250, Elapsed: 30, Host: "host1:27017", Indexes: []string{"email_1"}, Namespace: "keyhole.orders",
+		Phase: "scanning collection", Shard: "rs0", Total: 1000}
+	waiting := IndexBuild{Elapsed: 60, Host: "host2:27017", Indexes: []string{"ts_1"}, Namespace: "keyhole.events",
+		Phase: "waiting for commit quorum", Shard: "rs0", Waiting: true}
+	m.setBuilds([]IndexBuild{build, waiting}, now)
+	if m.Builds[0].Namespace != "keyhole.events" || m.Builds[0].ETA != -1 || m.Builds[1].ETA != 90 {
+		t.Fatal("expected ETA from elapsed time", m.Builds)
+	}
+	build.Done, build.Elapsed = 500, 35
+	failed := IndexBuild{Error: "server selection timeout", Host: "host3:27017", Indexes: []string{}}
+	m.setBuilds([]IndexBuild{build, waiting, failed}, now.Add(5*time.Second))
+	if m.Builds[2].ETA != 10 || m.Builds[0].Host != "host3:27017" || m.Builds[0].ETA != -1 {
+		t.Fatal("expected ETA from the rate since the last refresh", m.Builds)
+	}
+	str := m.printIndexBuildsSummary(now)
+	if !strings.Contains(str, "2 active") || !strings.Contains(str, "500/1000 (50%)") || !strings.Contains(str, "waiting for commit quorum") ||
+		!strings.Contains(str, "error: server selection timeout") {
+		t.Fatal("unexpected summary", str)
+	}
+	t.Log(str)
+}
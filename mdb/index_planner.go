@@ -0,0 +1,433 @@
+// Copyright 2020-present Kuei-chun Chen. All rights reserved.
+
+package mdb
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// index plan actions, in the order of execution
+const (
+	PlanCollMod = "collMod" // TTL, hidden, and prepareUnique are changed without rebuilding
+	PlanCreate  = "create"
+	PlanRebuild = "rebuild" // drops and creates an index of mismatched options
+	PlanDrop    = "drop"
+)
+
+const (
+	progressInterval = 5 * time.Second
+	rollingBuildSize = 10 * 1024 * 1024 * 1024 // bytes of an index to consider a rolling build
+)
+
+// IndexPlanStep stores an action of an index
+type IndexPlanStep struct {
+	Action        string   `bson:"action"`
+	Differences   []string `bson:"differences,omitempty"`
+	EstimatedSize int64    `bson:"estimatedSize"`
+	Index         Index    `bson:"index"` // source index, or target index to drop
+	Namespace     string   `bson:"ns"`
+	Rolling       bool     `bson:"rolling"`          // large enough to consider a rolling build
+	Target        string   `bson:"target,omitempty"` // name of the target index to modify or drop
+}
+
+// IndexPlanner compares index definitions of a source and a target and plans ordered builds
+type IndexPlanner struct {
+	Extra     int             `bson:"extra"`
+	Matched   int             `bson:"matched"`
+	Mismatch  int             `bson:"mismatch"`
+	Missing   int             `bson:"missing"`
+	Steps     []IndexPlanStep `bson:"steps"`
+	Unmanaged []string        `bson:"unmanaged"` // target namespaces not in the source
+
+	dropExtra bool
+	source    *IndexStats
+	target    *IndexStats
+}
+
+// NewIndexPlanner returns *IndexPlanner of source and target indexes
+func NewIndexPlanner(source *IndexStats, target *IndexStats) *IndexPlanner {
+	return &IndexPlanner{source: source, target: target}
+}
+
+// SetDropExtra sets to drop indexes not in the source, only of namespaces in the source
+func (ip *IndexPlanner) SetDropExtra(dropExtra bool) {
+	ip.dropExtra = dropExtra
+}
+
+// Plan compares indexes and returns ordered steps
+func (ip *IndexPlanner) Plan() []IndexPlanStep {
+	ip.Steps = []IndexPlanStep{}
+	ip.Extra, ip.Matched, ip.Mismatch, ip.Missing = 0, 0, 0, 0
+	ip.Unmanaged = []string{}
+	targets := getIndexesByNamespace(ip.target)
+	sources := getIndexesByNamespace(ip.source)
+	for _, ns := range getSortedKeys(sources) {
+		found := map[string]bool{}
+		for _, index := range sources[ns] {
+			if index.Name == "_id_" {
+				continue
+			}
+			other, ok := findIndex(index, targets[ns])
+			if !ok {
+				ip.Missing++
+				ip.Steps = append(ip.Steps, IndexPlanStep{Action: PlanCreate, Index: index, Namespace: ns})
+				continue
+			}
+			found[other.Name] = true
+			diffs := compareIndexes(index, other)
+			if other.Name != index.Name {
+				diffs = append(diffs, fmt.Sprintf("name %v, was %v", index.Name, other.Name))
+			}
+			if len(diffs) == 0 {
+				ip.Matched++
+				continue
+			}
+			ip.Mismatch++
+			action := PlanCollMod
+			for _, diff := range diffs {
+				if strings.HasPrefix(diff, "expireAfterSeconds") && (index.ExpireAfterSeconds < 0 || other.ExpireAfterSeconds < 0) {
+					action = PlanRebuild // collMod only changes TTL of an existing TTL index
+				} else if !strings.HasPrefix(diff, "expireAfterSeconds") && !strings.HasPrefix(diff, "hidden") &&
+					!strings.HasPrefix(diff, "prepareUnique") {
+					action = PlanRebuild
+				}
+			}
+			step := IndexPlanStep{Action: action, Differences: diffs, Index: index, Namespace: ns, Target: other.Name}
+			ip.Steps = append(ip.Steps, step)
+		}
+		for _, other := range targets[ns] {
+			if other.Name != "_id_" && !found[other.Name] {
+				ip.Extra++
+				if ip.dropExtra {
+					ip.Steps = append(ip.Steps, IndexPlanStep{Action: PlanDrop, Index: other, Namespace: ns, Target: other.Name})
+				}
+			}
+		}
+	}
+	for _, ns := range getSortedKeys(targets) { // collections not in the source are reported, never changed
+		if _, ok := sources[ns]; !ok {
+			ip.Unmanaged = append(ip.Unmanaged, ns)
+		}
+	}
+	ip.sortSteps()
+	return ip.Steps
+}
+
+// sortSteps orders steps by actions, collMod, create, rebuild, and drop, and then smaller indexes first
+func (ip *IndexPlanner) sortSteps() {
+	order := map[string]int{PlanCollMod: 0, PlanCreate: 1, PlanRebuild: 2, PlanDrop: 3}
+	sort.SliceStable(ip.Steps, func(i int, j int) bool {
+		x, y := ip.Steps[i], ip.Steps[j]
+		if order[x.Action] != order[y.Action] {
+			return order[x.Action] < order[y.Action]
+		} else if x.EstimatedSize != y.EstimatedSize {
+			return x.EstimatedSize < y.EstimatedSize
+		}
+		return x.Namespace+x.Index.Name < y.Namespace+y.Index.Name
+	})
+}
+
+// getIndexesByNamespace returns indexes by namespaces
+func getIndexesByNamespace(ix *IndexStats) map[string][]Index {
+	indexes := map[string][]Index{}
+	for _, db := range ix.Databases {
+		for _, coll := range db.Collections {
+			indexes[coll.NS] = coll.Indexes
+		}
+	}
+	return indexes
+}
+
+func getSortedKeys(m map[string][]Index) []string {
+	keys := []string{}
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// findIndex returns a target index of the same name, or of the same key if not found
+func findIndex(index Index, list []Index) (Index, bool) {
+	for _, other := range list {
+		if other.Name == index.Name {
+			return other, true
+		}
+	}
+	for _, other := range list {
+		if getKeyString(other.Key) == getKeyString(index.Key) && toExtJSON(other.Collation) == toExtJSON(index.Collation) {
+			return other, true
+		}
+	}
+	return Index{}, false
+}
+
+// compareIndexes returns differences of a source and a target index
+func compareIndexes(index Index, other Index) []string {
+	diffs := []string{}
+	if x, y := getKeyString(index.Key), getKeyString(other.Key); x != y {
+		diffs = append(diffs, fmt.Sprintf("key %v, was %v", x, y))
+	}
+	if index.Unique != other.Unique {
+		diffs = append(diffs, fmt.Sprintf("unique %v, was %v", index.Unique, other.Unique))
+	}
+	if index.Sparse != other.Sparse {
+		diffs = append(diffs, fmt.Sprintf("sparse %v, was %v", index.Sparse, other.Sparse))
+	}
+	if index.ExpireAfterSeconds != other.ExpireAfterSeconds {
+		diffs = append(diffs, fmt.Sprintf("expireAfterSeconds %v, was %v", getTTLString(index), getTTLString(other)))
+	}
+	if index.Hidden != other.Hidden {
+		diffs = append(diffs, fmt.Sprintf("hidden %v, was %v", index.Hidden, other.Hidden))
+	}
+	if index.PrepareUnique != other.PrepareUnique {
+		diffs = append(diffs, fmt.Sprintf("prepareUnique %v, was %v", index.PrepareUnique, other.PrepareUnique))
+	}
+	for _, opt := range []struct {
+		name string
+		x, y interface{}
+	}{{"bits", index.Bits, other.Bits}, {"min", getFloatString(index.Min), getFloatString(other.Min)},
+		{"max", getFloatString(index.Max), getFloatString(other.Max)},
+		{"2dsphereIndexVersion", index.SphereVersion, other.SphereVersion},
+		{"default_language", index.DefaultLanguage, other.DefaultLanguage},
+		{"language_override", index.LanguageOverride, other.LanguageOverride},
+		{"textIndexVersion", index.TextIndexVersion, other.TextIndexVersion}} {
+		if opt.x != opt.y {
+			diffs = append(diffs, fmt.Sprintf("%v %v, was %v", opt.name, opt.x, opt.y))
+		}
+	}
+	for _, opt := range []struct {
+		name string
+		x, y bson.D
+	}{{"collation", index.Collation, other.Collation},
+		{"columnstoreProjection", index.ColumnstoreProjection, other.ColumnstoreProjection},
+		{"partialFilterExpression", index.PartialFilterExpression, other.PartialFilterExpression},
+		{"storageEngine", index.StorageEngine, other.StorageEngine},
+		{"wildcardProjection", index.WildcardProjection, other.WildcardProjection},
+		{"weights", index.Weights, other.Weights}} {
+		if x, y := toExtJSON(opt.x), toExtJSON(opt.y); x != y {
+			diffs = append(diffs, fmt.Sprintf("%v %v, was %v", opt.name, x, y))
+		}
+	}
+	return diffs
+}
+
+func getFloatString(value *float64) string {
+	if value == nil {
+		return "default"
+	}
+	return fmt.Sprint(*value)
+}
+
+func getTTLString(index Index) string {
+	if index.ExpireAfterSeconds < 0 {
+		return "none"
+	}
+	return fmt.Sprint(index.ExpireAfterSeconds)
+}
+
+// toExtJSON returns relaxed extended JSON of a document, {} if empty
+func toExtJSON(doc bson.D) string {
+	if len(doc) == 0 {
+		return "{}"
+	}
+	data, err := bson.MarshalExtJSON(doc, false, false)
+	if err != nil {
+		return fmt.Sprint(doc)
+	}
+	return string(data)
+}
+
+// EstimateSizes estimates sizes of indexes to build from target collections
+func (ip *IndexPlanner) EstimateSizes(client *mongo.Client) error {
+	ctx := context.Background()
+	for i, step := range ip.Steps {
+		if step.Action != PlanCreate && step.Action != PlanRebuild {
+			continue
+		}
+		dbName, collName := SplitNamespace(step.Namespace)
+		coll := client.Database(dbName).Collection(collName)
+		count, err := coll.EstimatedDocumentCount(ctx)
+		if err != nil || count == 0 {
+			continue
+		}
+		cur, err := coll.Aggregate(ctx, MongoPipeline(fmt.Sprintf(`{"$sample": {"size": %d}}`, indexSizeSamples)))
+		if err != nil {
+			return err
+		}
+		docs := []bson.Raw{}
+		for cur.Next(ctx) {
+			docs = append(docs, append(bson.Raw{}, cur.Current...))
+		}
+		cur.Close(ctx)
+		ip.Steps[i].EstimatedSize = estimateIndexSize(step.Index.Key, count, docs)
+		ip.Steps[i].Rolling = ip.Steps[i].EstimatedSize >= rollingBuildSize
+	}
+	ip.sortSteps()
+	return nil
+}
+
+// Print prints the plan
+func (ip *IndexPlanner) Print() {
+	fmt.Println(ip.printPlanSummary())
+}
+
+// printPlanSummary returns index differences and ordered steps
+func (ip *IndexPlanner) printPlanSummary() string {
+	var buffer bytes.Buffer
+	var rolling bool
+	buffer.WriteString(fmt.Sprintf("\nIndex plan: %d matched, %d missing, %d mismatched, %d extra indexes\n",
+		ip.Matched, ip.Missing, ip.Mismatch, ip.Extra))
+	buffer.WriteString("+-----+---------+------------------------------+------------------------------------+---------+\n")
+	buffer.WriteString("|   # | Action  | Namespace                    | Index                              |    Size |\n")
+	buffer.WriteString("|-----+---------+------------------------------+------------------------------------+---------|\n")
+	for i, step := range ip.Steps {
+		size := "-"
+		if step.EstimatedSize > 0 {
+			size = getStorageSize(step.EstimatedSize)
+		}
+		if step.Rolling {
+			size = "*" + size
+			rolling = true
+		}
+		buffer.WriteString(fmt.Sprintf("| %3d | %-7v | %-28v | %-34v | %7v |\n", i+1, step.Action,
+			truncate(step.Namespace, 28), truncate(step.Index.Name+" "+getKeyString(step.Index.Key), 34), size))
+		for _, diff := range step.Differences {
+			buffer.WriteString(fmt.Sprintf("|     |         |   %-73v |\n", truncate(diff, 73)))
+		}
+	}
+	buffer.WriteString("+-----+---------+------------------------------+------------------------------------+---------+\n")
+	if !ip.dropExtra && ip.Extra > 0 {
+		buffer.WriteString(fmt.Sprintf("%d extra indexes are kept, use -drop to drop them\n", ip.Extra))
+	}
+	if len(ip.Unmanaged) > 0 {
+		buffer.WriteString(fmt.Sprintf("%d target namespaces not in the source are not changed, e.g. %v\n",
+			len(ip.Unmanaged), ip.Unmanaged[0]))
+	}
+	buffer.WriteString("Indexes build on all data bearing members simultaneously (4.4+); a rebuild leaves the collection without the index until the build completes.\n")
+	if rolling {
+		buffer.WriteString(fmt.Sprintf("* indexes of %v or larger, consider rolling builds on busy clusters, i.e. build on each secondary restarted as a standalone, then step down the primary and build on it.\n",
+			getStorageSize(rollingBuildSize)))
+	}
+	return buffer.String()
+}
+
+// Apply executes steps after confirmation, unless auto
+func (ip *IndexPlanner) Apply(client *mongo.Client, auto bool) error {
+	if len(ip.Steps) == 0 {
+		fmt.Println("Indexes are identical, nothing to apply")
+		return nil
+	}
+	if !auto {
+		reader := bufio.NewReader(os.Stdin)
+		fmt.Printf("Apply %d steps [y/N]: ", len(ip.Steps))
+		text, _ := reader.ReadString('\n')
+		text = strings.Replace(text, "\n", "", -1)
+		if text != "y" && text != "Y" {
+			return nil
+		}
+	}
+	ctx := context.Background()
+	for i, step := range ip.Steps {
+		dbName, collName := SplitNamespace(step.Namespace)
+		db := client.Database(dbName)
+		label := fmt.Sprintf("[%d/%d] %v %v %v", i+1, len(ip.Steps), step.Action, step.Namespace, step.Index.Name)
+		fmt.Println(label)
+		var err error
+		switch step.Action {
+		case PlanCollMod:
+			index := bson.D{{Key: "name", Value: step.Target}, {Key: "hidden", Value: step.Index.Hidden}}
+			if step.Index.PrepareUnique {
+				index = append(index, bson.E{Key: "prepareUnique", Value: true})
+			}
+			if step.Index.ExpireAfterSeconds >= 0 {
+				index = append(index, bson.E{Key: "expireAfterSeconds", Value: step.Index.ExpireAfterSeconds})
+			}
+			err = db.RunCommand(ctx, bson.D{{Key: "collMod", Value: collName}, {Key: "index", Value: index}}).Err()
+		case PlanDrop:
+			err = db.RunCommand(ctx, bson.D{{Key: "dropIndexes", Value: collName}, {Key: "index", Value: step.Target}}).Err()
+		case PlanRebuild:
+			if err = db.RunCommand(ctx, bson.D{{Key: "dropIndexes", Value: collName}, {Key: "index", Value: step.Target}}).Err(); err == nil {
+				err = createIndexWithProgress(client, step, label)
+			}
+		case PlanCreate:
+			err = createIndexWithProgress(client, step, label)
+		}
+		if err != nil {
+			return fmt.Errorf("%v: %v", label, err)
+		}
+	}
+	return nil
+}
+
+// createIndexWithProgress creates an index and prints progress of the build from $currentOp
+func createIndexWithProgress(client *mongo.Client, step IndexPlanStep, label string) error {
+	dbName, collName := SplitNamespace(step.Namespace)
+	cmd := bson.D{{Key: "createIndexes", Value: collName}, {Key: "indexes", Value: bson.A{getIndexSpec(step.Index)}}}
+	done := make(chan error, 1)
+	begin := time.Now()
+	go func() {
+		done <- client.Database(dbName).RunCommand(context.Background(), cmd).Err()
+	}()
+	ticker := time.NewTicker(progressInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case err := <-done:
+			if err == nil {
+				fmt.Printf("%v completed in %v\n", label, time.Since(begin).Truncate(time.Second))
+			}
+			return err
+		case <-ticker.C:
+			if msg := getIndexBuildProgress(client, step.Namespace, step.Index.Name); msg != "" {
+				fmt.Printf("%v %v, %v\n", label, msg, time.Since(begin).Truncate(time.Second))
+			}
+		}
+	}
+}
+
+// getIndexBuildProgress returns progress of an index build of all shards from $currentOp
+func getIndexBuildProgress(client *mongo.Client, ns string, name string) string {
+	ctx := context.Background()
+	pipeline := []bson.D{{{Key: "$currentOp", Value: bson.D{{Key: "allUsers", Value: true}}}},
+		{{Key: "$match", Value: bson.D{{Key: "ns", Value: ns}, {Key: "command.indexes.name", Value: name},
+			{Key: "progress", Value: bson.D{{Key: "$exists", Value: true}}}}}}}
+	cur, err := client.Database("admin").Aggregate(ctx, pipeline)
+	if err != nil {
+		return ""
+	}
+	defer cur.Close(ctx)
+	var done, total int64
+	var msg string
+	for cur.Next(ctx) {
+		var op struct {
+			Msg      string `bson:"msg"`
+			Progress struct {
+				Done  int64 `bson:"done"`
+				Total int64 `bson:"total"`
+			} `bson:"progress"`
+		}
+		if err = cur.Decode(&op); err == nil {
+			done += op.Progress.Done
+			total += op.Progress.Total
+			msg = op.Msg
+		}
+	}
+	if total == 0 {
+		return msg
+	}
+	if i := strings.Index(msg, ":"); i > 0 { // e.g. Index Build: scanning collection
+		msg = msg[:i]
+	}
+	return fmt.Sprintf("%v %d/%d (%.0f%%)", msg, done, total, 100*float64(done)/float64(total))
+}
@@ -0,0 +1,93 @@
+// Copyright 2020-present Kuei-chun Chen. All rights reserved.
+
+package mdb
+
+import (
+	"strings"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func getPlannerIndexStats(indexes ...Index) *IndexStats {
+	ix := NewIndexStats("utest-xxxxxx")
+	ix.Databases = []Database{{Name: "keyhole", Collections: []Collection{{NS: "keyhole.orders", Name: "orders",
+		Indexes: append([]Index{{Name: "_id_", Key: bson.D{{Key: "_id", Value: int32(1)}}, ExpireAfterSeconds: -1}}, indexes...)}}}}
+	return ix
+}
+
+func TestCompareIndexes(t *testing.T) {
+	key := bson.D{{Key: "email", Value: int32(1)}}
+	index := Index{Name: "email_1", Key: key, ExpireAfterSeconds: -1, Unique: true,
+		Collation: bson.D{{Key: "locale", Value: "en"}, {Key: "strength", Value: int32(2)}}}
+	if diffs := compareIndexes(index, index); len(diffs) != 0 {
+		t.Fatal("expected no differences, but got", diffs)
+	}
+	other := index
+	other.Unique = false
+	other.Collation = nil
+	other.WildcardProjection = bson.D{{Key: "a", Value: int32(1)}}
+	diffs := compareIndexes(index, other)
+	if len(diffs) != 3 || !strings.HasPrefix(diffs[0], "unique true") || !strings.HasPrefix(diffs[2], "wildcardProjection {}") {
+		t.Fatal("unexpected differences", diffs)
+	}
+	spec := getIndexSpec(index)
+	if len(spec) != 4 || spec[2].Key != "unique" || spec[3].Key != "collation" {
+		t.Fatal("unexpected index spec", spec)
+	}
+}
+
+func TestIndexPlanner(t *testing.T) {
+	email := Index{Name: "email_1", Key: bson.D{{Key: "email", Value: int32(1)}}, ExpireAfterSeconds: -1, Unique: true}
+	ts := Index{Name: "ts_1", Key: bson.D{{Key: "ts", Value: int32(1)}}, ExpireAfterSeconds: 3600}
+	status := Index{Name: "status_1", Key: bson.D{{Key: "status", Value: int32(1)}}, ExpireAfterSeconds: -1,
+		PartialFilterExpression: bson.D{{Key: "status", Value: "open"}}}
+	source := getPlannerIndexStats(email, ts, status)
+
+	nonUnique, ttl, extra := email, ts, status
+	nonUnique.Unique = false
+	nonUnique.Name = "email"
+	ttl.ExpireAfterSeconds = 60
+	ttl.Hidden = true
+	extra.Name = "status_open"
+	extra.Key = bson.D{{Key: "status", Value: int32(-1)}}
+	target := getPlannerIndexStats(nonUnique, ttl, extra)
+	target.Databases = append(target.Databases, Database{Name: "billing", Collections: []Collection{{NS: "billing.invoices",
+		Name: "invoices", Indexes: []Index{{Name: "due_1", Key: bson.D{{Key: "due", Value: int32(1)}}, ExpireAfterSeconds: -1}}}}})
+
+	planner := NewIndexPlanner(source, target)
+	steps := planner.Plan()
+	if planner.Missing != 1 || planner.Mismatch != 2 || planner.Extra != 1 || len(steps) != 3 {
+		t.Fatal("unexpected plan", planner.printPlanSummary())
+	}
+	if steps[0].Action != PlanCollMod || steps[0].Target != "ts_1" || len(steps[0].Differences) != 2 {
+		t.Fatal("expected collMod of TTL and hidden first, but got", steps[0])
+	}
+	if steps[1].Action != PlanCreate || steps[1].Index.Name != "status_1" {
+		t.Fatal("expected status_1 created, but got", steps[1])
+	}
+	if steps[2].Action != PlanRebuild || steps[2].Target != "email" || steps[2].Index.Name != "email_1" {
+		t.Fatal("expected email rebuilt as email_1, but got", steps[2])
+	}
+
+	planner.SetDropExtra(true)
+	steps = planner.Plan()
+	if len(steps) != 4 || steps[3].Action != PlanDrop || steps[3].Target != "status_open" {
+		t.Fatal("expected status_open dropped last", steps)
+	}
+	if len(planner.Unmanaged) != 1 || planner.Unmanaged[0] != "billing.invoices" {
+		t.Fatal("expected billing.invoices not changed", planner.Unmanaged)
+	}
+
+	renamed := getPlannerIndexStats(email)
+	renamed.Databases[0].Collections[0].Indexes[1].Name = "email"
+	rename := NewIndexPlanner(getPlannerIndexStats(email), renamed)
+	if steps := rename.Plan(); rename.Matched != 0 || rename.Mismatch != 1 || len(steps) != 1 || steps[0].Action != PlanRebuild {
+		t.Fatal("expected a renamed index mismatched", rename.printPlanSummary())
+	}
+	str := planner.printPlanSummary()
+	if !strings.Contains(str, "0 matched") || !strings.Contains(str, "unique true, was false") {
+		t.Fatal("unexpected summary", str)
+	}
+	t.Log(str)
+}
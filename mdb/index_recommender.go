@@ -0,0 +1,471 @@
+// Copyright 2020-present Kuei-chun Chen. All rights reserved.
+
+package mdb
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+const (
+	defaultCoverage       = 0.9 // of total milliseconds of query shapes
+	indexEntryOverhead    = 16  // bytes of a record id and key string overhead
+	indexSizeSamples      = 100
+	maxIndexesPerNS       = 5
+	unknownFieldSize      = 8
+	recommendedByExisting = "existing"
+)
+
+// QueryShape stores equality, sort, and range fields of an ops pattern
+type QueryShape struct {
+	Command    string   `bson:"command"`
+	CoveredBy  string   `bson:"coveredBy"` // key of an index satisfying the shape
+	Count      int      `bson:"count"`
+	Equality   []string `bson:"equality"`
+	Existing   bool     `bson:"existing"` // covered by an existing index
+	Filter     string   `bson:"filter"`
+	Namespace  string   `bson:"ns"`
+	Range      []string `bson:"range"`
+	Sort       bson.D   `bson:"sort"`
+	TotalMilli int64    `bson:"totalmilli"`
+}
+
+// IndexRecommendation stores a recommended index and shapes it satisfies
+type IndexRecommendation struct {
+	Count         int    `bson:"count"` // ops of satisfied shapes
+	EstimatedSize int64  `bson:"estimatedSize"`
+	Key           bson.D `bson:"key"`
+	KeyString     string `bson:"keyString"`
+	Namespace     string `bson:"ns"`
+	Shapes        int    `bson:"shapes"`
+	TotalMilli    int64  `bson:"totalmilli"` // milliseconds of satisfied shapes
+
+	shapes []QueryShape
+}
+
+// IndexRecommender proposes a minimal set of compound indexes for the heaviest query shapes of a workload
+type IndexRecommender struct {
+	Recommendations []IndexRecommendation `bson:"recommendations"`
+	Shapes          []QueryShape          `bson:"shapes"`
+	Skipped         int                   `bson:"skipped"` // unsupported shapes, e.g. $or, $text, and geo
+	TotalMilli      int64                 `bson:"totalmilli"`
+
+	coverage float64
+	ix       *IndexStats
+}
+
+// NewIndexRecommender returns *IndexRecommender with existing indexes collected by IndexStats
+func NewIndexRecommender(ix *IndexStats) *IndexRecommender {
+	return &IndexRecommender{coverage: defaultCoverage, ix: ix}
+}
+
+// SetCoverage sets the ratio of total milliseconds of the heaviest shapes to cover
+func (ir *IndexRecommender) SetCoverage(coverage float64) {
+	ir.coverage = coverage
+}
+
+// Recommend recommends indexes of ops patterns weighted by total milliseconds
+func (ir *IndexRecommender) Recommend(patterns []OpPattern) []IndexRecommendation {
+	ir.Shapes = []QueryShape{}
+	ir.Recommendations = []IndexRecommendation{}
+	ir.Skipped, ir.TotalMilli = 0, 0
+	for _, op := range patterns {
+		if op.Command == cmdInsert || op.Command == cmdCreateIndexes || op.Namespace == "" ||
+			op.Filter == "N/A" || (op.Filter == "{}" && op.Sort == "") {
+			continue
+		}
+		shape, err := getQueryShapeFields(op)
+		if err != nil {
+			ir.Skipped++
+			continue
+		}
+		ir.TotalMilli += op.TotalMilli
+		ir.Shapes = append(ir.Shapes, shape)
+	}
+	sort.Slice(ir.Shapes, func(i int, j int) bool { return ir.Shapes[i].TotalMilli > ir.Shapes[j].TotalMilli })
+
+	var covered int64
+	for i := range ir.Shapes {
+		if ir.TotalMilli > 0 && float64(covered) >= ir.coverage*float64(ir.TotalMilli) {
+			break
+		}
+		covered += ir.Shapes[i].TotalMilli
+		ir.satisfy(&ir.Shapes[i])
+	}
+	for i, rec := range ir.Recommendations {
+		ir.Recommendations[i].KeyString = getKeyString(rec.Key)
+		ir.Recommendations[i].Shapes = len(rec.shapes)
+		for _, shape := range rec.shapes {
+			ir.Recommendations[i].Count += shape.Count
+			ir.Recommendations[i].TotalMilli += shape.TotalMilli
+		}
+		for j := range ir.Shapes {
+			if ir.Shapes[j].CoveredBy == "" && !ir.Shapes[j].Existing && ir.Shapes[j].Namespace == rec.Namespace &&
+				isShapeSatisfied(rec.Key, ir.Shapes[j]) {
+				ir.Shapes[j].CoveredBy = ir.Recommendations[i].KeyString
+			}
+		}
+	}
+	sort.Slice(ir.Recommendations, func(i int, j int) bool {
+		return ir.Recommendations[i].TotalMilli > ir.Recommendations[j].TotalMilli
+	})
+	return ir.Recommendations
+}
+
+// satisfy marks a shape covered by an existing index, or adds it to a new or an extended recommendation
+func (ir *IndexRecommender) satisfy(shape *QueryShape) {
+	if contains(shape.Equality, "_id") {
+		shape.CoveredBy, shape.Existing = "{ _id: 1 }", true
+		return
+	}
+	for _, index := range ir.getIndexes(shape.Namespace) {
+		if isShapeSatisfied(index.Key, *shape) {
+			shape.CoveredBy, shape.Existing = index.KeyString, true
+			return
+		}
+	}
+	candidate := getESRKey(*shape)
+	count := 0
+	for i, rec := range ir.Recommendations {
+		if rec.Namespace != shape.Namespace {
+			continue
+		}
+		count++
+		if isShapeSatisfied(rec.Key, *shape) {
+			ir.Recommendations[i].shapes = append(rec.shapes, *shape)
+			return
+		}
+		if prefix, _ := isKeyPrefix(rec.Key, candidate); prefix && satisfiesAll(candidate, rec.shapes) {
+			ir.Recommendations[i].Key = candidate
+			ir.Recommendations[i].shapes = append(rec.shapes, *shape)
+			return
+		}
+	}
+	if count < maxIndexesPerNS {
+		ir.Recommendations = append(ir.Recommendations, IndexRecommendation{Key: candidate, Namespace: shape.Namespace,
+			shapes: []QueryShape{*shape}})
+	}
+}
+
+// getIndexes returns existing indexes of a namespace usable by any query, i.e. not hidden, partial, sparse,
+// nor of a collation other than the collection default of the _id index
+func (ir *IndexRecommender) getIndexes(ns string) []Index {
+	if ir.ix == nil {
+		return nil
+	}
+	for _, db := range ir.ix.Databases {
+		for _, coll := range db.Collections {
+			if coll.NS != ns {
+				continue
+			}
+			var collation bson.D
+			for _, index := range coll.Indexes {
+				if index.Name == "_id_" {
+					collation = index.Collation
+				}
+			}
+			indexes := []Index{}
+			for _, index := range coll.Indexes {
+				if index.Hidden || index.PartialFilterExpression != nil || index.Sparse ||
+					!reflect.DeepEqual(index.Collation, collation) {
+					continue
+				}
+				indexes = append(indexes, index)
+			}
+			return indexes
+		}
+	}
+	return nil
+}
+
+// satisfiesAll returns true if a key satisfies all shapes
+func satisfiesAll(key bson.D, shapes []QueryShape) bool {
+	for _, shape := range shapes {
+		if !isShapeSatisfied(key, shape) {
+			return false
+		}
+	}
+	return true
+}
+
+// getQueryShapeFields returns equality, sort, and range fields of an ops pattern
+func getQueryShapeFields(op OpPattern) (QueryShape, error) {
+	shape := QueryShape{Command: op.Command, Count: op.Count, Filter: op.Filter, Namespace: op.Namespace,
+		TotalMilli: op.TotalMilli}
+	filter, err := parseFilterShape(op.Filter)
+	if err != nil {
+		return shape, err
+	}
+	equality, ranges := []string{}, []string{}
+	if err = getESRFields(filter, "", &equality, &ranges); err != nil {
+		return shape, err
+	}
+	shape.Equality = unique(equality, nil)
+	shape.Range = unique(ranges, shape.Equality)
+	if op.Sort != "" {
+		var doc bson.D
+		if err = bson.UnmarshalExtJSON([]byte(op.Sort), false, &doc); err != nil {
+			return shape, err
+		}
+		sorted := []string{}
+		for _, e := range doc {
+			if !contains(shape.Equality, e.Key) { // equality fields are sorted already
+				shape.Sort = append(shape.Sort, e)
+				sorted = append(sorted, e.Key)
+			}
+		}
+		shape.Range = unique(shape.Range, sorted) // a range of a sort field is bounded by the sort
+	}
+	if len(shape.Equality)+len(shape.Sort)+len(shape.Range) == 0 {
+		return shape, fmt.Errorf("no fields")
+	}
+	return shape, nil
+}
+
+// filterRegexRegexp matches regular expressions of a filter pattern, e.g. /^.../i
+var filterRegexRegexp = regexp.MustCompile(`/\^?\.\.\./\w*`)
+
+// parseFilterShape parses a filter pattern, e.g. {"a":1,"b":{"$in":[...]},"c":/^.../i}
+func parseFilterShape(filter string) (bson.D, error) {
+	var doc bson.D
+	str := strings.ReplaceAll(filter, "[...]", "[1]")
+	str = filterRegexRegexp.ReplaceAllString(str, `{"$$gte":1}`) // regex as a range
+	err := bson.UnmarshalExtJSON([]byte(str), false, &doc)
+	return doc, err
+}
+
+// getESRFields classifies fields of a filter to equality and range fields
+func getESRFields(filter bson.D, prefix string, equality *[]string, ranges *[]string) error {
+	for _, e := range filter {
+		if e.Key == "$and" {
+			arr, _ := e.Value.(bson.A)
+			for _, elem := range arr {
+				if doc, ok := elem.(bson.D); ok {
+					if err := getESRFields(doc, prefix, equality, ranges); err != nil {
+						return err
+					}
+				}
+			}
+			continue
+		} else if strings.HasPrefix(e.Key, "$") { // $or, $nor, $expr, $text, $where, etc.
+			return fmt.Errorf("unsupported %v", e.Key)
+		}
+		field := prefix + e.Key
+		doc, ok := e.Value.(bson.D)
+		if !ok || len(doc) == 0 || !strings.HasPrefix(doc[0].Key, "$") {
+			*equality = append(*equality, field)
+			continue
+		}
+		isEquality, isElemMatch := true, false
+		for _, op := range doc {
+			switch op.Key {
+			case "$eq", "$in":
+			case "$elemMatch": // fields of array elements, e.g. {"items": {"$elemMatch": {"sku": 1}}}
+				sub, _ := op.Value.(bson.D)
+				if len(sub) > 0 && !strings.HasPrefix(sub[0].Key, "$") {
+					if err := getESRFields(sub, field+".", equality, ranges); err != nil {
+						return err
+					}
+					isElemMatch = true
+				}
+				isEquality = false
+			case "$near", "$nearSphere", "$geoWithin", "$geoIntersects":
+				return fmt.Errorf("unsupported %v", op.Key)
+			default:
+				isEquality = false
+			}
+		}
+		if isElemMatch {
+			continue
+		} else if isEquality {
+			*equality = append(*equality, field)
+		} else {
+			*ranges = append(*ranges, field)
+		}
+	}
+	return nil
+}
+
+// unique returns distinct fields excluding fields of another list
+func unique(fields []string, excluded []string) []string {
+	list := []string{}
+	for _, field := range fields {
+		if !contains(list, field) && !contains(excluded, field) {
+			list = append(list, field)
+		}
+	}
+	return list
+}
+
+// getESRKey returns an index key of equality, sort, and range fields
+func getESRKey(shape QueryShape) bson.D {
+	key := bson.D{}
+	for _, field := range shape.Equality {
+		key = append(key, bson.E{Key: field, Value: int32(1)})
+	}
+	for _, e := range shape.Sort {
+		direction, _ := getKeyDirection(e.Value)
+		key = append(key, bson.E{Key: e.Key, Value: int32(direction)})
+	}
+	for _, field := range shape.Range {
+		key = append(key, bson.E{Key: field, Value: int32(1)})
+	}
+	return key
+}
+
+// isShapeSatisfied returns true if an index key leads with equality fields in any order, followed by
+// sort fields in the same or all reversed directions, and then range fields in any order
+func isShapeSatisfied(key bson.D, shape QueryShape) bool {
+	n := len(shape.Equality)
+	if len(key) < n+len(shape.Sort)+len(shape.Range) {
+		return false
+	}
+	for _, e := range key[:n] {
+		if !contains(shape.Equality, e.Key) {
+			return false
+		}
+	}
+	reversed := false
+	for i, e := range shape.Sort {
+		x, _ := getKeyDirection(e.Value)
+		y, ok := getKeyDirection(key[n+i].Value)
+		if !ok || key[n+i].Key != e.Key {
+			return false
+		}
+		if i == 0 {
+			reversed = x != y
+		} else if (x != y) != reversed {
+			return false
+		}
+	}
+	n += len(shape.Sort)
+	for _, e := range key[n : n+len(shape.Range)] {
+		if !contains(shape.Range, e.Key) {
+			return false
+		}
+	}
+	return true
+}
+
+// getKeyString returns a key string of the same format of IndexStats, e.g. { a: 1, b: -1 }
+func getKeyString(key bson.D) string {
+	strs := []string{}
+	for _, e := range key {
+		strs = append(strs, fmt.Sprintf("%v: %v", e.Key, e.Value))
+	}
+	return "{ " + strings.Join(strs, ", ") + " }"
+}
+
+// EstimateSizes estimates sizes of recommended indexes from collection counts and sampled documents,
+// namespaces failed to sample are logged and skipped
+func (ir *IndexRecommender) EstimateSizes(client *mongo.Client) error {
+	ctx := context.Background()
+	for i, rec := range ir.Recommendations {
+		dbName, collName := SplitNamespace(rec.Namespace)
+		coll := client.Database(dbName).Collection(collName)
+		count, err := coll.EstimatedDocumentCount(ctx)
+		if err != nil { // e.g. a namespace of the logs not in this cluster
+			ir.ix.Logger.Warnf(`skip estimating index size of namespace '%v': %v`, rec.Namespace, err)
+			continue
+		}
+		cur, err := coll.Aggregate(ctx, MongoPipeline(fmt.Sprintf(`{"$sample": {"size": %d}}`, indexSizeSamples)))
+		if err != nil {
+			ir.ix.Logger.Warnf(`skip estimating index size of namespace '%v': %v`, rec.Namespace, err)
+			continue
+		}
+		docs := []bson.Raw{}
+		for cur.Next(ctx) {
+			docs = append(docs, append(bson.Raw{}, cur.Current...))
+		}
+		cur.Close(ctx)
+		ir.Recommendations[i].EstimatedSize = estimateIndexSize(rec.Key, count, docs)
+	}
+	return nil
+}
+
+// estimateIndexSize returns estimated bytes of an index from average sizes of key fields of sampled documents
+func estimateIndexSize(key bson.D, count int64, docs []bson.Raw) int64 {
+	entry := float64(indexEntryOverhead)
+	for _, e := range key {
+		var total, found int
+		for _, doc := range docs {
+			if value, err := doc.LookupErr(strings.Split(e.Key, ".")...); err == nil {
+				total += len(value.Value)
+				found++
+			}
+		}
+		if found == 0 {
+			entry += unknownFieldSize
+		} else {
+			entry += float64(total) / float64(found)
+		}
+	}
+	return int64(entry * float64(count))
+}
+
+// Print prints recommended indexes and covered shapes
+func (ir *IndexRecommender) Print() {
+	fmt.Println(ir.printRecommenderSummary())
+}
+
+// printRecommenderSummary returns recommended indexes and the heaviest shapes
+func (ir *IndexRecommender) printRecommenderSummary() string {
+	var buffer bytes.Buffer
+	buffer.WriteString(fmt.Sprintf("\nIndex recommendations of %d query shapes, %d unsupported shapes skipped\n", len(ir.Shapes), ir.Skipped))
+	buffer.WriteString("+------------------------------+------------------------------------------+--------+--------+---------+\n")
+	buffer.WriteString("| Namespace                    | Recommended Index                        | Shapes | Weight |    Size |\n")
+	buffer.WriteString("|------------------------------+------------------------------------------+--------+--------+---------|\n")
+	for _, rec := range ir.Recommendations {
+		size := "-"
+		if rec.EstimatedSize > 0 {
+			size = getStorageSize(rec.EstimatedSize)
+		}
+		buffer.WriteString(fmt.Sprintf("| %-28v | %-40v | %6d | %5.1f%% | %7v |\n", truncate(rec.Namespace, 28),
+			truncate(rec.KeyString, 40), rec.Shapes, ir.getWeight(rec.TotalMilli), size))
+	}
+	buffer.WriteString("+------------------------------+------------------------------------------+--------+--------+---------+\n")
+	buffer.WriteString("weight: percentage of total milliseconds of all query shapes\n")
+	buffer.WriteString("+------------------------------+------------------------------------------+--------+----------------------------+\n")
+	buffer.WriteString("| Namespace                    | Query Shape                              | Weight | Covered By                 |\n")
+	buffer.WriteString("|------------------------------+------------------------------------------+--------+----------------------------|\n")
+	for _, shape := range ir.Shapes {
+		coveredBy := shape.CoveredBy
+		if shape.Existing {
+			coveredBy = recommendedByExisting + " " + coveredBy
+		} else if coveredBy == "" {
+			coveredBy = "-"
+		}
+		filter := shape.Filter
+		if len(shape.Sort) > 0 {
+			filter += " sort " + getKeyString(shape.Sort)
+		}
+		buffer.WriteString(fmt.Sprintf("| %-28v | %-40v | %5.1f%% | %-26v |\n", truncate(shape.Namespace, 28),
+			truncate(filter, 40), ir.getWeight(shape.TotalMilli), truncate(coveredBy, 26)))
+	}
+	buffer.WriteString("+------------------------------+------------------------------------------+--------+----------------------------+\n")
+	return buffer.String()
+}
+
+// getWeight returns percentage of total milliseconds
+func (ir *IndexRecommender) getWeight(milli int64) float64 {
+	if ir.TotalMilli == 0 {
+		return 0
+	}
+	return 100 * float64(milli) / float64(ir.TotalMilli)
+}
+
+// truncate returns a string no longer than n characters
+func truncate(str string, n int) string {
+	if len(str) > n {
+		return str[:n-3] + "..."
+	}
+	return str
+}
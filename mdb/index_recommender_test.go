@@ -0,0 +1,86 @@
+// Copyright 2020-present Kuei-chun Chen. All rights reserved.
+
+package mdb
+
+import (
+	"strings"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestGetCommandSortShape(t *testing.T) {
+	str := `{"t":{"$date":"2021-06-01T12:00:00.000Z"},"s":"I","c":"COMMAND","id":51803,"msg":"Slow query","attr":{"type":"command","ns":"keyhole.orders","command":{"find":"orders","filter":{"status":"A","qty":1},"sort":{"ts":-1,"qty":1,"score":{"$meta":"textScore"}}}}}`
+	if sort := getCommandSortShape(getLogv2Command(str, false)); sort != `{"ts":-1,"qty":1}` {
+		t.Fatal("unexpected sort", sort)
+	}
+	str = `{"attr":{"command":{"aggregate":"orders","pipeline":[{"$match":{"a":{"b":1},"c":1}},{"$sort":{"c":1,"b":-1}}]}}}`
+	if sort := getCommandSortShape(getLogv2Command(str, false)); sort != `{"c":1,"b":-1}` {
+		t.Fatal("unexpected sort", sort)
+	}
+}
+
+func TestGetQueryShapeFields(t *testing.T) {
+	op := OpPattern{Command: "find", Namespace: "keyhole.orders", Filter: `{"status":1,"ts":{"$gte":1},"name":/^.../i,"tags":{"$in":[...]},"$and":[{"qty":{"$lt":1}}],"items":{"$elemMatch":{"sku":1}}}`,
+		Sort: `{"status":1,"ts":-1}`}
+	shape, err := getQueryShapeFields(op)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(shape.Equality, ",") != "status,tags,items.sku" || strings.Join(shape.Range, ",") != "name,qty" ||
+		len(shape.Sort) != 1 || shape.Sort[0].Key != "ts" {
+		t.Fatal("unexpected shape", shape)
+	}
+	if key := getKeyString(getESRKey(shape)); key != "{ status: 1, tags: 1, items.sku: 1, ts: -1, name: 1, qty: 1 }" {
+		t.Fatal("unexpected key", key)
+	}
+	for _, filter := range []string{`{"$or":[{"a":1},{"b":1}]}`, `{"loc":{"$near":1}}`} {
+		if _, err = getQueryShapeFields(OpPattern{Filter: filter}); err == nil {
+			t.Fatal("expected error", filter)
+		}
+	}
+}
+
+func TestIndexRecommender(t *testing.T) {
+	ix := NewIndexStats("utest-xxxxxx")
+	ix.Databases = []Database{{Name: "keyhole", Collections: []Collection{{Name: "orders", NS: "keyhole.orders",
+		Indexes: []Index{{Name: "_id_", Key: bson.D{{Key: "_id", Value: int32(1)}}, KeyString: "{ _id: 1 }"},
+			{Name: "cust_1", Key: bson.D{{Key: "cust", Value: int32(1)}, {Key: "ts", Value: int32(1)}}, KeyString: "{ cust: 1, ts: 1 }"},
+			{Name: "status_1", Key: bson.D{{Key: "status", Value: int32(1)}}, KeyString: "{ status: 1 }", Hidden: true},
+			{Name: "status_qty", Key: bson.D{{Key: "status", Value: int32(1)}, {Key: "qty", Value: int32(-1)}, {Key: "ts", Value: int32(1)}},
+				KeyString: "{ status: 1, qty: -1, ts: 1 }", PartialFilterExpression: bson.D{{Key: "qty", Value: bson.D{{Key: "$gt", Value: int32(0)}}}}}}}}}}
+	patterns := []OpPattern{
+		{Command: "find", Namespace: "keyhole.orders", Filter: `{"status":1}`, Count: 100, TotalMilli: 5000},
+		{Command: "find", Namespace: "keyhole.orders", Filter: `{"status":1,"ts":{"$gt":1}}`, Sort: `{"qty":-1}`, Count: 10, TotalMilli: 3000},
+		{Command: "find", Namespace: "keyhole.orders", Filter: `{"cust":1}`, Sort: `{"ts":-1}`, Count: 50, TotalMilli: 1500},
+		{Command: "update", Namespace: "keyhole.orders", Filter: `{"_id":1}`, Count: 500, TotalMilli: 400},
+		{Command: "find", Namespace: "keyhole.orders", Filter: `{"$or":[{"a":1},{"b":1}]}`, Count: 1, TotalMilli: 100},
+		{Command: "insert", Namespace: "keyhole.orders", Filter: "N/A", Count: 100, TotalMilli: 100},
+		{Command: "find", Namespace: "keyhole.orders", Filter: `{"region":1}`, Count: 1, TotalMilli: 10},
+	}
+	ir := NewIndexRecommender(ix)
+	recs := ir.Recommend(patterns)
+	if len(recs) != 1 || recs[0].KeyString != "{ status: 1, qty: -1, ts: 1 }" || recs[0].Shapes != 2 || ir.Skipped != 1 {
+		t.Fatal("unexpected recommendations", recs, ir.Skipped)
+	}
+	for _, shape := range ir.Shapes {
+		if shape.Filter == `{"cust":1}` && (!shape.Existing || shape.CoveredBy != "{ cust: 1, ts: 1 }") {
+			t.Fatal("expected an existing index", shape)
+		} else if shape.Filter == `{"status":1}` && shape.Existing {
+			t.Fatal("expected hidden and partial indexes not used", shape)
+		} else if shape.Filter == `{"region":1}` && shape.CoveredBy != "" {
+			t.Fatal("expected a shape beyond coverage", shape)
+		}
+	}
+
+	docs := []bson.Raw{}
+	for i := 0; i < 10; i++ {
+		data, _ := bson.Marshal(bson.M{"status": "ACTIVE", "qty": int32(i)})
+		docs = append(docs, data)
+	}
+	// status: 4 + 7 bytes, qty: 4 bytes, ts: unknown
+	if size := estimateIndexSize(recs[0].Key, 1000, docs); size != 1000*(indexEntryOverhead+11+4+unknownFieldSize) {
+		t.Fatal("unexpected size", size)
+	}
+	t.Log(ir.printRecommenderSummary())
+}
@@ -24,11 +24,14 @@ import (
 
 // IndexStats holder indexes reader struct
 type IndexStats struct {
-	Databases []Database  `bson:"databases"`
-	Logger    *gox.Logger `bson:"keyhole"`
+	Databases       []Database        `bson:"databases"`
+	Logger          *gox.Logger       `bson:"keyhole"`
+	Recommendations *IndexRecommender `bson:"recommendations,omitempty"`
 
 	fastMode bool
 	filename string
+	format   string
+	logInfo  *LogInfo
 	nocolor  bool
 	verbose  bool
 	version  string
@@ -48,18 +51,39 @@ type IndexUsage struct {
 	Shard    string   `json:"shard" bson:"shard"`
 }
 
+// SearchIndex stores an Atlas Search or Vector Search index definition
+type SearchIndex struct {
+	Definition bson.D `json:"latestDefinition" bson:"latestDefinition"`
+	Name       string `json:"name" bson:"name"`
+	Status     string `json:"status" bson:"status"`
+	Type       string `json:"type" bson:"type"` // search or vectorSearch
+}
+
 // Index stores indexes stats
 type Index struct {
-	Background              bool   `json:"background" bson:"background"`
-	Collation               bson.D `json:"collation" bson:"collation"`
-	ExpireAfterSeconds      int32  `json:"expireAfterSeconds" bson:"expireAfterSeconds,truncate,omitempty"`
-	Key                     bson.D `json:"key" bson:"key"`
-	Name                    string `json:"name" bson:"name,truncate"`
-	PartialFilterExpression bson.D `json:"partialFilterExpression" bson:"partialFilterExpression"`
-	Sparse                  bool   `json:"sparse" bson:"sparse"`
-	Unique                  bool   `json:"unique" bson:"unique"`
-	Version                 int32  `json:"v" bson:"v,truncate"`
-	Weights                 bson.D `json:"weights" bson:"weights"`
+	Background              bool     `json:"background" bson:"background"`
+	Bits                    int32    `json:"bits,omitempty" bson:"bits,truncate,omitempty"`
+	Clustered               bool     `json:"clustered,omitempty" bson:"clustered,omitempty"`
+	Collation               bson.D   `json:"collation" bson:"collation"`
+	ColumnstoreProjection   bson.D   `json:"columnstoreProjection,omitempty" bson:"columnstoreProjection,omitempty"`
+	DefaultLanguage         string   `json:"default_language,omitempty" bson:"default_language,omitempty"`
+	ExpireAfterSeconds      int32    `json:"expireAfterSeconds" bson:"expireAfterSeconds,truncate,omitempty"`
+	Hidden                  bool     `json:"hidden" bson:"hidden"`
+	Key                     bson.D   `json:"key" bson:"key"`
+	LanguageOverride        string   `json:"language_override,omitempty" bson:"language_override,omitempty"`
+	Max                     *float64 `json:"max,omitempty" bson:"max,omitempty"`
+	Min                     *float64 `json:"min,omitempty" bson:"min,omitempty"`
+	Name                    string   `json:"name" bson:"name,truncate"`
+	PartialFilterExpression bson.D   `json:"partialFilterExpression" bson:"partialFilterExpression"`
+	PrepareUnique           bool     `json:"prepareUnique,omitempty" bson:"prepareUnique,omitempty"`
+	SphereVersion           int32    `json:"2dsphereIndexVersion,omitempty" bson:"2dsphereIndexVersion,truncate,omitempty"`
+	Sparse                  bool     `json:"sparse" bson:"sparse"`
+	StorageEngine           bson.D   `json:"storageEngine,omitempty" bson:"storageEngine,omitempty"`
+	TextIndexVersion        int32    `json:"textIndexVersion,omitempty" bson:"textIndexVersion,truncate,omitempty"`
+	Unique                  bool     `json:"unique" bson:"unique"`
+	Version                 int32    `json:"v" bson:"v,truncate"`
+	Weights                 bson.D   `json:"weights" bson:"weights"`
+	WildcardProjection      bson.D   `json:"wildcardProjection" bson:"wildcardProjection"`
 
 	EffectiveKey string       `json:"effectiveKey" bson:"effectiveKey"`
 	Fields       []string     `json:"fields" bson:"fields"`
@@ -108,6 +132,16 @@ func (ix *IndexStats) SetClusterDetailsFromFile(filename string) error {
 	return bson.Unmarshal(data, &ix)
 }
 
+// SetFormat sets output format, json, csv, prom, or html
+func (ix *IndexStats) SetFormat(format string) {
+	ix.format = format
+}
+
+// SetLogInfo sets analyzed logs to recommend indexes of query shapes
+func (ix *IndexStats) SetLogInfo(logInfo *LogInfo) {
+	ix.logInfo = logInfo
+}
+
 // SetNoColor set nocolor flag
 func (ix *IndexStats) SetNoColor(nocolor bool) {
 	ix.nocolor = nocolor
@@ -163,10 +197,12 @@ func (ix *IndexStats) GetIndexesFromDB(client *mongo.Client, db string) ([]Colle
 	}
 	defer cur.Close(ctx)
 	collectionNames := []string{}
+	collOptions := map[string]collectionOptions{}
 	for cur.Next(ctx) {
 		var elem struct {
-			Name string `bson:"name"`
-			Type string `bson:"type"`
+			Name    string            `bson:"name"`
+			Options collectionOptions `bson:"options"`
+			Type    string            `bson:"type"`
 		}
 		if err = cur.Decode(&elem); err != nil {
 			continue
@@ -176,6 +212,7 @@ func (ix *IndexStats) GetIndexesFromDB(client *mongo.Client, db string) ([]Colle
 			continue
 		}
 		collectionNames = append(collectionNames, elem.Name)
+		collOptions[elem.Name] = elem.Options
 	}
 
 	sort.Strings(collectionNames)
@@ -184,11 +221,60 @@ func (ix *IndexStats) GetIndexesFromDB(client *mongo.Client, db string) ([]Colle
 		if collection.Indexes, err = ix.GetIndexesFromCollection(client, client.Database(db).Collection(v)); err != nil {
 			return collections, err
 		}
+		setClusteredIndexOptions(collection.Indexes, collOptions[v])
+		collection.SearchIndexes = ix.GetSearchIndexes(client.Database(db).Collection(v))
 		collections = append(collections, collection)
 	}
 	return collections, nil
 }
 
+// collectionOptions stores options of a clustered collection from listCollections
+type collectionOptions struct {
+	ClusteredIndex     interface{} `bson:"clusteredIndex"`
+	ExpireAfterSeconds interface{} `bson:"expireAfterSeconds"`
+}
+
+// setClusteredIndexOptions sets the TTL of a clustered collection, not in listIndexes, to its clustered index
+func setClusteredIndexOptions(indexes []Index, opts collectionOptions) {
+	if opts.ClusteredIndex == nil {
+		return
+	}
+	name := "_id_"
+	if spec, ok := opts.ClusteredIndex.(bson.D); ok && spec.Map()["name"] != nil {
+		name = getString(spec.Map()["name"])
+	}
+	for i, o := range indexes {
+		if o.Name != name {
+			continue
+		}
+		indexes[i].Clustered = true
+		if opts.ExpireAfterSeconds != nil {
+			indexes[i].ExpireAfterSeconds = int32(ToInt64(opts.ExpireAfterSeconds))
+		}
+	}
+}
+
+// GetSearchIndexes gets Atlas Search and Vector Search indexes of a collection, none if not supported
+func (ix *IndexStats) GetSearchIndexes(collection *mongo.Collection) []SearchIndex {
+	var ctx = context.Background()
+	list := []SearchIndex{}
+	cur, err := collection.Aggregate(ctx, MongoPipeline(`{"$listSearchIndexes": {}}`))
+	if err != nil {
+		ix.Logger.Debug("listSearchIndexes: ", err)
+		return list
+	}
+	defer cur.Close(ctx)
+	for cur.Next(ctx) {
+		o := SearchIndex{Type: "search"}
+		if err = cur.Decode(&o); err != nil {
+			ix.Logger.Error(err)
+			continue
+		}
+		list = append(list, o)
+	}
+	return list
+}
+
 // GetIndexesFromCollection gets indexes from a collection
 func (ix *IndexStats) GetIndexesFromCollection(client *mongo.Client, collection *mongo.Collection) ([]Index, error) {
 	var err error
@@ -288,6 +374,20 @@ func (ix *IndexStats) GetIndexesFromCollection(client *mongo.Client, collection
 	return list, nil
 }
 
+// RecommendIndexes recommends indexes of the heaviest query shapes of analyzed logs, if any
+func (ix *IndexStats) RecommendIndexes(client *mongo.Client) error {
+	if ix.logInfo == nil {
+		return nil
+	}
+	ix.Recommendations = NewIndexRecommender(ix)
+	ix.Recommendations.Recommend(ix.logInfo.OpPatterns)
+	if err := ix.Recommendations.EstimateSizes(client); err != nil {
+		return err
+	}
+	ix.Recommendations.Print()
+	return nil
+}
+
 // check if an index is a dup of others
 func checkIfDupped(doc Index, list []Index) bool {
 	if strings.Index(doc.KeyString, "2dsphere") > 0 {
@@ -400,12 +500,16 @@ func (ix *IndexStats) PrintIndexesOf(databases []Database) {
 				} else {
 					buffer.WriteString(fmt.Sprintf("  %v", o.KeyString))
 				}
+				buffer.WriteString(getIndexOptionsString(o))
 
 				for _, u := range o.Usage {
 					buffer.Write([]byte("\n\thost: " + u.Host + ", ops: " + fmt.Sprintf("%v", u.Accesses.Ops) + ", since: " + fmt.Sprintf("%v", u.Accesses.Since)))
 				}
 				buffer.WriteString("\n")
 			}
+			for _, o := range coll.SearchIndexes {
+				buffer.WriteString(fmt.Sprintf("  %v: %v (%v)\n", o.Type, o.Name, o.Status))
+			}
 			fmt.Println(buffer.String())
 		}
 	}
@@ -468,72 +572,140 @@ func (ix *IndexStats) CopyIndexesWithDest(client *mongo.Client, namespaces []Ind
 				cmd := bson.D{{Key: "dropIndexes", Value: collName}, {Key: "index", Value: "*"}}
 				client.Database(dbName).RunCommand(ctx, cmd).Decode(&doc)
 			}
-			collection := client.Database(dbName).Collection(collName)
-			indexes := []mongo.IndexModel{}
+			specs := bson.A{}
+			prepared := []string{}
 			for _, o := range coll.Indexes {
-				opt := options.Index()
-				// opt.SetVersion(o.Version)
-				opt.SetName(o.Name)
-				if o.Background {
-					opt.SetBackground(o.Background)
-				}
-				if o.ExpireAfterSeconds >= 0 {
-					opt.SetExpireAfterSeconds(o.ExpireAfterSeconds)
-				}
-				if o.Unique {
-					opt.SetUnique(o.Unique)
-				}
-				if o.Sparse {
-					opt.SetSparse(o.Sparse)
-				}
-				var collation *options.Collation
-				if o.Collation != nil {
-					data, err := bson.Marshal(o.Collation)
-					if err != nil {
-						return err
-					}
-					bson.Unmarshal(data, &collation)
-					opt.SetCollation(collation)
-				}
-				if o.PartialFilterExpression != nil {
-					opt.SetPartialFilterExpression(o.PartialFilterExpression)
-				}
-				if o.Weights != nil {
-					opt.SetWeights(o.Weights)
-				}
 				if ix.verbose {
 					ix.Logger.Info(fmt.Sprintf(`creating index %v on %v `, o.KeyString, ns))
 				}
-				indexes = append(indexes, mongo.IndexModel{Keys: o.Key, Options: opt})
 				if o.Key.Map()["_id"] != nil {
-					collNames, _ := client.Database(dbName).ListCollectionNames(ctx, bson.D{})
-					var exists bool
-					for _, name := range collNames {
-						if name == coll.Name {
-							exists = true
-							break
-						}
+					if err = ix.createCollection(client, dbName, collName, o); err != nil {
+						return err
 					}
-					if !exists {
-						collOpts := options.CreateCollection()
-						if collation != nil {
-							collOpts.SetCollation(collation)
-						}
-						if err = client.Database(dbName).CreateCollection(ctx, collName, collOpts); err != nil {
-							return err
-						}
-						if _, err = collection.Indexes().CreateOne(ctx, mongo.IndexModel{Keys: o.Key, Options: opt}); err != nil {
-							return err
-						}
+					if o.Clustered { // created with the collection
+						continue
 					}
 				}
+				specs = append(specs, getIndexSpec(o))
+				if o.PrepareUnique {
+					prepared = append(prepared, o.Name)
+				}
+			}
+			cmd := bson.D{{Key: "createIndexes", Value: collName}, {Key: "indexes", Value: specs}}
+			if len(specs) > 0 {
+				if err = client.Database(dbName).RunCommand(ctx, cmd).Err(); err != nil {
+					return err
+				}
 			}
-			if _, err = collection.Indexes().CreateMany(ctx, indexes); err != nil {
-				return err
+			for _, name := range prepared { // prepareUnique is only set by collMod
+				index := bson.D{{Key: "name", Value: name}, {Key: "prepareUnique", Value: true}}
+				if err = client.Database(dbName).RunCommand(ctx, bson.D{{Key: "collMod", Value: collName}, {Key: "index", Value: index}}).Err(); err != nil {
+					return err
+				}
+			}
+			for _, o := range coll.SearchIndexes {
+				index := bson.D{{Key: "name", Value: o.Name}, {Key: "type", Value: o.Type}, {Key: "definition", Value: o.Definition}}
+				cmd = bson.D{{Key: "createSearchIndexes", Value: collName}, {Key: "indexes", Value: bson.A{index}}}
+				if err = client.Database(dbName).RunCommand(ctx, cmd).Err(); err != nil {
+					ix.Logger.Warnf(`failed to create %v index %v on %v: %v`, o.Type, o.Name, ns, err)
+				}
 			}
 		}
 	}
-	return err
+	return nil
+}
+
+// createCollection creates a collection of the _id index if not exists, clustered by the index if it is
+func (ix *IndexStats) createCollection(client *mongo.Client, dbName string, collName string, o Index) error {
+	var ctx = context.Background()
+	collNames, _ := client.Database(dbName).ListCollectionNames(ctx, bson.D{{Key: "name", Value: collName}})
+	if len(collNames) > 0 {
+		return nil
+	}
+	collOpts := options.CreateCollection()
+	if o.Collation != nil {
+		var collation *options.Collation
+		data, err := bson.Marshal(o.Collation)
+		if err != nil {
+			return err
+		}
+		bson.Unmarshal(data, &collation)
+		collOpts.SetCollation(collation)
+	}
+	if o.Clustered {
+		collOpts.SetClusteredIndex(bson.D{{Key: "key", Value: o.Key}, {Key: "unique", Value: true}, {Key: "name", Value: o.Name}})
+		if o.ExpireAfterSeconds >= 0 {
+			collOpts.SetExpireAfterSeconds(int64(o.ExpireAfterSeconds))
+		}
+	}
+	return client.Database(dbName).CreateCollection(ctx, collName, collOpts)
+}
+
+// getIndexSpec returns an index specification of the createIndexes command
+func getIndexSpec(o Index) bson.D {
+	spec := bson.D{{Key: "key", Value: o.Key}, {Key: "name", Value: o.Name}}
+	for _, opt := range []bson.E{{Key: "background", Value: o.Background}, {Key: "unique", Value: o.Unique},
+		{Key: "sparse", Value: o.Sparse}, {Key: "hidden", Value: o.Hidden}} {
+		if opt.Value.(bool) {
+			spec = append(spec, opt)
+		}
+	}
+	if o.ExpireAfterSeconds >= 0 {
+		spec = append(spec, bson.E{Key: "expireAfterSeconds", Value: o.ExpireAfterSeconds})
+	}
+	for _, opt := range []bson.E{{Key: "bits", Value: o.Bits}, {Key: "2dsphereIndexVersion", Value: o.SphereVersion},
+		{Key: "textIndexVersion", Value: o.TextIndexVersion}} {
+		if opt.Value.(int32) > 0 {
+			spec = append(spec, opt)
+		}
+	}
+	if o.Min != nil {
+		spec = append(spec, bson.E{Key: "min", Value: *o.Min})
+	}
+	if o.Max != nil {
+		spec = append(spec, bson.E{Key: "max", Value: *o.Max})
+	}
+	if o.DefaultLanguage != "" {
+		spec = append(spec, bson.E{Key: "default_language", Value: o.DefaultLanguage})
+	}
+	if o.LanguageOverride != "" {
+		spec = append(spec, bson.E{Key: "language_override", Value: o.LanguageOverride})
+	}
+	for _, opt := range []bson.E{{Key: "collation", Value: o.Collation},
+		{Key: "columnstoreProjection", Value: o.ColumnstoreProjection},
+		{Key: "partialFilterExpression", Value: o.PartialFilterExpression},
+		{Key: "storageEngine", Value: o.StorageEngine},
+		{Key: "weights", Value: o.Weights}, {Key: "wildcardProjection", Value: o.WildcardProjection}} {
+		if doc := opt.Value.(bson.D); len(doc) > 0 {
+			spec = append(spec, opt)
+		}
+	}
+	return spec
+}
+
+// getIndexOptionsString returns index options to print, e.g. " (unique, ttl: 3600)"
+func getIndexOptionsString(o Index) string {
+	opts := []string{}
+	for _, opt := range []bson.E{{Key: "clustered", Value: o.Clustered}, {Key: "unique", Value: o.Unique},
+		{Key: "sparse", Value: o.Sparse}, {Key: "hidden", Value: o.Hidden}, {Key: "prepareUnique", Value: o.PrepareUnique},
+		{Key: "partial", Value: len(o.PartialFilterExpression) > 0}, {Key: "wildcardProjection", Value: len(o.WildcardProjection) > 0},
+		{Key: "columnstoreProjection", Value: len(o.ColumnstoreProjection) > 0}} {
+		if opt.Value.(bool) {
+			opts = append(opts, opt.Key)
+		}
+	}
+	if o.ExpireAfterSeconds >= 0 {
+		opts = append(opts, fmt.Sprintf("ttl: %v", o.ExpireAfterSeconds))
+	}
+	for _, opt := range o.Collation {
+		if opt.Key == "locale" {
+			opts = append(opts, fmt.Sprintf("collation: %v", opt.Value))
+		}
+	}
+	if len(opts) == 0 {
+		return ""
+	}
+	return " (" + strings.Join(opts, ", ") + ")"
 }
 
 // GetDatabaseNames gets all database names
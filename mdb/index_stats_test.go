@@ -38,6 +38,52 @@ func TestGetIndexes(t *testing.T) {
 	t.Log(str)
 }
 
+func TestGetIndexSpec(t *testing.T) {
+	spec := bson.D{{Key: "v", Value: int32(2)}, {Key: "key", Value: bson.D{{Key: "loc", Value: "2d"}}}, {Key: "name", Value: "loc_2d"},
+		{Key: "hidden", Value: true}, {Key: "bits", Value: int32(32)}, {Key: "min", Value: int32(0)}, {Key: "max", Value: 1000.0},
+		{Key: "prepareUnique", Value: true}, {Key: "wildcardProjection", Value: bson.D{{Key: "a", Value: int32(1)}}}}
+	data, _ := bson.Marshal(spec)
+	o := Index{ExpireAfterSeconds: -1}
+	if err := bson.Unmarshal(data, &o); err != nil {
+		t.Fatal(err)
+	}
+	if o.Bits != 32 || o.Min == nil || *o.Min != 0 || !o.Hidden || !o.PrepareUnique {
+		t.Fatal("unexpected index", o)
+	}
+	created := getIndexSpec(o)
+	if toExtJSON(created) != `{"key":{"loc":"2d"},"name":"loc_2d","hidden":true,"bits":32,"min":0.0,"max":1000.0,"wildcardProjection":{"a":1}}` {
+		t.Fatal("unexpected index spec", toExtJSON(created))
+	}
+	if str := getIndexOptionsString(o); str != " (hidden, prepareUnique, wildcardProjection)" {
+		t.Fatal("unexpected index options", str)
+	}
+	o.Clustered = true
+	o.ExpireAfterSeconds = 60
+	if str := getIndexOptionsString(o); str != " (clustered, hidden, prepareUnique, wildcardProjection, ttl: 60)" {
+		t.Fatal("unexpected index options", str)
+	}
+}
+
+func TestSetClusteredIndexOptions(t *testing.T) {
+	info := bson.D{{Key: "clusteredIndex", Value: bson.D{{Key: "v", Value: int32(2)}, {Key: "key", Value: bson.D{{Key: "_id", Value: int32(1)}}},
+		{Key: "name", Value: "_id_"}, {Key: "unique", Value: true}}}, {Key: "expireAfterSeconds", Value: int64(3600)}}
+	data, _ := bson.Marshal(info)
+	var opts collectionOptions
+	if err := bson.Unmarshal(data, &opts); err != nil {
+		t.Fatal(err)
+	}
+	indexes := []Index{{Name: "_id_", Key: bson.D{{Key: "_id", Value: int32(1)}}, ExpireAfterSeconds: -1},
+		{Name: "ts_1", Key: bson.D{{Key: "ts", Value: int32(1)}}, ExpireAfterSeconds: -1}}
+	setClusteredIndexOptions(indexes, opts)
+	if !indexes[0].Clustered || indexes[0].ExpireAfterSeconds != 3600 || indexes[1].Clustered || indexes[1].ExpireAfterSeconds != -1 {
+		t.Fatal("expected the TTL of the clustered index, but got", indexes)
+	}
+	setClusteredIndexOptions(indexes[1:], collectionOptions{})
+	if indexes[1].Clustered {
+		t.Fatal("expected a collection not clustered", indexes[1])
+	}
+}
+
 func seedNumbers(c *mongo.Collection) {
 	var err error
 	var ctx = context.Background()
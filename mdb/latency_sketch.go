@@ -0,0 +1,99 @@
+// Copyright 2020-present Kuei-chun Chen. All rights reserved.
+
+package mdb
+
+import (
+	"math"
+	"math/bits"
+)
+
+// sketchSubBuckets is the number of linear sub-buckets per power of 2, about 6% relative error
+const sketchSubBuckets = 16
+
+// LatencySketch is a mergeable log-linear histogram of milliseconds, similar to an HDR histogram
+type LatencySketch struct {
+	Counts []int64 `bson:"counts"`
+}
+
+// Add adds a value in milliseconds
+func (s *LatencySketch) Add(milli int) {
+	idx := sketchIndex(milli)
+	if idx >= len(s.Counts) {
+		counts := make([]int64, idx+1)
+		copy(counts, s.Counts)
+		s.Counts = counts
+	}
+	s.Counts[idx]++
+}
+
+// Clone returns a deep copy
+func (s LatencySketch) Clone() LatencySketch {
+	return LatencySketch{}.Merge(s)
+}
+
+// Merge returns a new sketch combining both sketches
+func (s LatencySketch) Merge(other LatencySketch) LatencySketch {
+	size := len(s.Counts)
+	if len(other.Counts) > size {
+		size = len(other.Counts)
+	}
+	merged := LatencySketch{Counts: make([]int64, size)}
+	for i, v := range s.Counts {
+		merged.Counts[i] += v
+	}
+	for i, v := range other.Counts {
+		merged.Counts[i] += v
+	}
+	return merged
+}
+
+// Total returns total number of values
+func (s LatencySketch) Total() int64 {
+	total := int64(0)
+	for _, v := range s.Counts {
+		total += v
+	}
+	return total
+}
+
+// Percentile returns an estimated value of a percentile, from 0 to 100
+func (s LatencySketch) Percentile(p float64) int {
+	total := s.Total()
+	if total == 0 {
+		return 0
+	}
+	rank := int64(math.Ceil(p / 100 * float64(total)))
+	if rank < 1 {
+		rank = 1
+	}
+	count := int64(0)
+	for i, v := range s.Counts {
+		count += v
+		if count >= rank {
+			return sketchValue(i)
+		}
+	}
+	return sketchValue(len(s.Counts) - 1)
+}
+
+// sketchIndex returns bucket index of a value
+func sketchIndex(v int) int {
+	if v < sketchSubBuckets {
+		if v < 0 {
+			return 0
+		}
+		return v
+	}
+	exp := bits.Len(uint(v)) - 5 // 2^4 sub-buckets
+	return (exp+1)*sketchSubBuckets + (v >> exp) - sketchSubBuckets
+}
+
+// sketchValue returns the middle value of a bucket
+func sketchValue(idx int) int {
+	if idx < sketchSubBuckets {
+		return idx
+	}
+	exp := idx/sketchSubBuckets - 1
+	lower := (idx%sketchSubBuckets + sketchSubBuckets) << exp
+	return lower + (1<<exp)/2
+}
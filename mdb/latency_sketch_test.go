@@ -0,0 +1,52 @@
+// Copyright 2020-present Kuei-chun Chen. All rights reserved.
+
+package mdb
+
+import (
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestLatencySketch(t *testing.T) {
+	var sketch LatencySketch
+	for i := 1; i <= 1000; i++ {
+		sketch.Add(i)
+	}
+	for _, p := range []float64{50, 95, 99} {
+		expected := int(p * 10)
+		value := sketch.Percentile(p)
+		if value < expected*94/100 || value > expected*106/100 {
+			t.Fatal("expected about", expected, "but got", value)
+		}
+	}
+	if sketch.Percentile(0) != 1 {
+		t.Fatal("expected 1 but got", sketch.Percentile(0))
+	}
+}
+
+func TestLatencySketchMerge(t *testing.T) {
+	var x, y LatencySketch
+	for i := 0; i < 99; i++ {
+		x.Add(10)
+	}
+	y.Add(5000)
+	merged := x.Merge(y)
+	if merged.Total() != 100 || x.Total() != 99 || y.Total() != 1 {
+		t.Fatal("expected 100, 99 and 1 but got", merged.Total(), x.Total(), y.Total())
+	}
+	if merged.Percentile(50) != 10 {
+		t.Fatal("expected 10 but got", merged.Percentile(50))
+	}
+	data, err := bson.Marshal(merged)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var sketch LatencySketch
+	if err = bson.Unmarshal(data, &sketch); err != nil {
+		t.Fatal(err)
+	}
+	if sketch.Percentile(100) < 4700 {
+		t.Fatal("expected about 5000 but got", sketch.Percentile(100))
+	}
+}
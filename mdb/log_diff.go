@@ -0,0 +1,162 @@
+// Copyright 2020-present Kuei-chun Chen. All rights reserved.
+
+package mdb
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/simagix/gox"
+)
+
+// diff status of a query pattern
+const (
+	DiffChanged  = "changed"
+	DiffNew      = "new"
+	DiffVanished = "vanished"
+)
+
+// OpPatternDiff stores changes of a query pattern between two periods
+type OpPatternDiff struct {
+	After          OpPattern `bson:"after"`
+	AfterCollscan  bool      `bson:"afterCollscan"`
+	Before         OpPattern `bson:"before"`
+	BeforeCollscan bool      `bson:"beforeCollscan"`
+	Command        string    `bson:"command"`
+	Filter         string    `bson:"filter"`
+	Namespace      string    `bson:"ns"`
+	Status         string    `bson:"status"`
+}
+
+// GetAvgMilli returns average milliseconds of before and after
+func (d OpPatternDiff) GetAvgMilli() (float64, float64) {
+	before, after := float64(0), float64(0)
+	if d.Before.Count > 0 {
+		before = float64(d.Before.TotalMilli) / float64(d.Before.Count)
+	}
+	if d.After.Count > 0 {
+		after = float64(d.After.TotalMilli) / float64(d.After.Count)
+	}
+	return before, after
+}
+
+// LogDiff compares query patterns of two log files or two -log.bson.gz files
+type LogDiff struct {
+	Diffs []OpPatternDiff `bson:"diffs"`
+
+	loginfo *LogInfo
+}
+
+// NewLogDiff returns *LogDiff
+func NewLogDiff(loginfo *LogInfo) *LogDiff {
+	return &LogDiff{loginfo: loginfo}
+}
+
+// Compare analyzes two files and compares query patterns
+func (ld *LogDiff) Compare(before string, after string) error {
+	x := ld.loginfo.clone()
+	if err := x.AnalyzeFile(before); err != nil {
+		return err
+	}
+	y := ld.loginfo.clone()
+	if err := y.AnalyzeFile(after); err != nil {
+		return err
+	}
+	ld.Diffs = DiffOpPatterns(x.OpPatterns, y.OpPatterns)
+	return nil
+}
+
+// DiffOpPatterns compares query patterns regardless of COLLSCAN, sorted by changes of total milliseconds
+func DiffOpPatterns(before []OpPattern, after []OpPattern) []OpPatternDiff {
+	diffMap := map[string]OpPatternDiff{}
+	for i, patterns := range [][]OpPattern{before, after} {
+		for _, value := range patterns {
+			key := getOpPatternKey(value.Command, value.Namespace, getShapeKey(value.QueryHash, value.Shape, value.Filter), "")
+			d, ok := diffMap[key]
+			if !ok {
+				d = OpPatternDiff{Command: value.Command, Filter: value.Filter, Namespace: value.Namespace}
+			}
+			if i == 0 {
+				d.Before = mergeDiffPattern(d.Before, value)
+				d.BeforeCollscan = d.BeforeCollscan || value.Scan == COLLSCAN
+			} else {
+				d.After = mergeDiffPattern(d.After, value)
+				d.AfterCollscan = d.AfterCollscan || value.Scan == COLLSCAN
+			}
+			diffMap[key] = d
+		}
+	}
+	diffs := make([]OpPatternDiff, 0, len(diffMap))
+	for _, d := range diffMap {
+		if d.Before.Count == 0 {
+			d.Status = DiffNew
+		} else if d.After.Count == 0 {
+			d.Status = DiffVanished
+		} else {
+			d.Status = DiffChanged
+		}
+		diffs = append(diffs, d)
+	}
+	sort.Slice(diffs, func(i, j int) bool {
+		x := diffs[i].After.TotalMilli - diffs[i].Before.TotalMilli
+		y := diffs[j].After.TotalMilli - diffs[j].Before.TotalMilli
+		if x == y {
+			return diffs[i].Filter < diffs[j].Filter
+		}
+		return x > y
+	})
+	return diffs
+}
+
+func mergeDiffPattern(x OpPattern, y OpPattern) OpPattern {
+	if x.Count == 0 {
+		y.Latency = y.Latency.Clone()
+		return y
+	}
+	return mergeOpPattern(x, y)
+}
+
+// Print prints diffs
+func (ld *LogDiff) Print() {
+	fmt.Println(ld.printDiffSummary())
+}
+
+// printDiffSummary prints diffs of query patterns
+func (ld *LogDiff) printDiffSummary() string {
+	var maxSize = 25
+	var buffer bytes.Buffer
+	buffer.WriteString("+--------+----------+-------------+---------------+-------------+---------+---------------------------------+------------------------------------------+\n")
+	buffer.WriteString(fmt.Sprintf("| Status | Command  |    Count    |    avg ms     |   max ms    |COLLSCAN | %-32s| %-40s |\n", "Namespace", "Query Pattern"))
+	buffer.WriteString("|--------+----------+-------------+---------------+-------------+---------+---------------------------------+------------------------------------------|\n")
+	changed := 0
+	for _, d := range ld.Diffs {
+		if d.Status == DiffChanged {
+			if changed >= maxSize {
+				continue
+			}
+			changed++
+		}
+		command := d.Command
+		if len(command) > 10 {
+			command = command[:10]
+		}
+		ns := d.Namespace
+		if len(ns) > 33 {
+			ns = ns[:1] + "*" + ns[(len(ns)-31):]
+		}
+		filter := d.Filter
+		if len(filter) > 42 {
+			filter = filter[:39] + "..."
+		}
+		before, after := d.GetAvgMilli()
+		scan := map[bool]string{true: "Y", false: "N"}
+		buffer.WriteString(fmt.Sprintf("|%-8s %-10s %5d->%-6d %6s->%-7s %5d->%-6d %3s->%-4s %-33s %-42s|\n", d.Status, command,
+			d.Before.Count, d.After.Count, strings.TrimSpace(gox.MilliToTimeString(before)), strings.TrimSpace(gox.MilliToTimeString(after)),
+			d.Before.MaxMilli, d.After.MaxMilli, scan[d.BeforeCollscan], scan[d.AfterCollscan], ns, filter))
+	}
+	buffer.WriteString("+--------+----------+-------------+---------------+-------------+---------+---------------------------------+------------------------------------------+\n")
+	buffer.WriteString(fmt.Sprintf(`all new and vanished, and top %d changed, of %v query patterns displayed.`, changed, len(ld.Diffs)))
+	return buffer.String()
+}
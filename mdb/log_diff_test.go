@@ -0,0 +1,54 @@
+// Copyright 2020-present Kuei-chun Chen. All rights reserved.
+
+package mdb
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLogDiff(t *testing.T) {
+	dir := t.TempDir()
+	line := `{"t":{"$date":"2020-11-05T09:%02d:50.680+00:00"},"s":"I","c":"COMMAND","id":51803,"ctx":"conn1","msg":"Slow query","attr":{"type":"command","ns":"keyhole.cars","command":{"find":"cars","filter":{"%v":"red"}},"planSummary":"%v","durationMillis":%d}}`
+	before := []string{fmt.Sprintf(line, 1, "color", "IXSCAN { color: 1 }", 100), fmt.Sprintf(line, 2, "make", "COLLSCAN", 100)}
+	after := []string{fmt.Sprintf(line, 1, "color", "COLLSCAN", 400), fmt.Sprintf(line, 2, "color", "COLLSCAN", 600),
+		fmt.Sprintf(line, 3, "year", "COLLSCAN", 50)}
+	filenames := []string{filepath.Join(dir, "before.log"), filepath.Join(dir, "after.log")}
+	for i, lines := range [][]string{before, after} {
+		if err := os.WriteFile(filenames[i], []byte(strings.Join(lines, "\n")), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	loginfo := NewLogInfo("utest-xxxxxx")
+	loginfo.SetSilent(true)
+	diff := NewLogDiff(loginfo)
+	if err := diff.Compare(filenames[0], filenames[1]); err != nil {
+		t.Fatal(err)
+	}
+	if len(diff.Diffs) != 3 {
+		t.Fatal("expected 3 diffs but got", len(diff.Diffs))
+	}
+	d := diff.Diffs[0]
+	if d.Status != DiffChanged || d.Before.Count != 1 || d.After.Count != 2 || d.BeforeCollscan || !d.AfterCollscan {
+		t.Fatal("unexpected diff", d)
+	}
+	if diff.Diffs[1].Status != DiffNew || diff.Diffs[2].Status != DiffVanished {
+		t.Fatal("expected new and vanished but got", diff.Diffs[1].Status, diff.Diffs[2].Status)
+	}
+	t.Log(diff.printDiffSummary())
+
+	from, _ := ParseTime("2020-11-05T09:02")
+	loginfo.SetTimeRange(from, from)
+	if err := loginfo.AnalyzeFile(filenames[1]); err != nil {
+		t.Fatal(err)
+	}
+	if len(loginfo.OpPatterns) != 1 || loginfo.OpPatterns[0].MaxMilli != 600 {
+		t.Fatal("expected 1 pattern within time range but got", loginfo.OpPatterns)
+	}
+	if err := diff.Compare(filepath.Join(dir, "before"+logExt), filepath.Join(dir, "after"+logExt)); err == nil {
+		t.Fatal("expected time range not supported with", logExt)
+	}
+}
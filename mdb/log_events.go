@@ -0,0 +1,342 @@
+// Copyright 2020-present Kuei-chun Chen. All rights reserved.
+
+package mdb
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// event categories
+const (
+	EventAssertion       = "assertion"
+	EventCheckpoint      = "slow checkpoint"
+	EventConnection      = "connection"
+	EventConnectionSpike = "connection spike"
+	EventElection        = "election"
+	EventError           = "error"
+	EventFatal           = "fatal"
+	EventIndexBuild      = "index build"
+	EventRollback        = "rollback"
+	EventStepDown        = "stepdown"
+	EventWarning         = "warning"
+	EventWriteConflict   = "write conflict"
+	EventWriteConflicts  = "write conflict storm"
+)
+
+// logv2 ids of events
+const (
+	idConnectionAccepted = 22943
+	idStateTransition    = 21358
+)
+
+// thresholds of spikes and storms in a minute
+const (
+	connectionSpikeMin     = 50  // min connections accepted
+	connectionSpikeRatio   = 3   // ratio of connections accepted to average
+	writeConflictsStormMin = 100 // min write conflicts
+)
+
+// notableEvents are displayed in the timeline regardless of counts
+var notableEvents = map[string]bool{EventCheckpoint: true, EventConnectionSpike: true, EventElection: true,
+	EventFatal: true, EventRollback: true, EventStepDown: true, EventWriteConflicts: true}
+
+// eventKeywords are used to filter lines before decoding json
+var eventKeywords = []string{`"s":"E"`, `"s":"F"`, `"s":"W"`, `"c":"ASSERT"`, `"c":"ELECTION"`, `"c":"INDEX"`,
+	`"c":"WTCHKPT"`, `ROLLBACK`, `Assertion`, `Checkpoint`, `WriteConflict`, `writeConflicts`,
+	fmt.Sprintf(`"id":%d`, idConnectionAccepted), fmt.Sprintf(`"id":%d`, idStateTransition)}
+
+// LogEvent stores an event type of a log id and a component
+type LogEvent struct {
+	Category  string `bson:"category"`
+	Component string `bson:"c"`
+	Count     int    `bson:"count"`
+	First     string `bson:"first"`
+	ID        int    `bson:"id"`
+	Last      string `bson:"last"`
+	Message   string `bson:"msg"`
+	Severity  string `bson:"s"`
+}
+
+// LogEvents stores event catalogue and timeline by minutes
+type LogEvents struct {
+	Catalogue []LogEvent  `bson:"catalogue"`
+	Timeline  []Histogram `bson:"timeline"`
+
+	catalogue map[string]LogEvent
+	inRange   func(utc string) bool
+	timeline  map[string]Histogram
+}
+
+// logv2Event stores logv2 attributes of events
+type logv2Event struct {
+	Attributes struct {
+		ConnectionCount int         `json:"connectionCount"`
+		Message         interface{} `json:"message"`
+		NewState        string      `json:"newState"`
+		OldState        string      `json:"oldState"`
+		WriteConflicts  int         `json:"writeConflicts"`
+	} `json:"attr"`
+	Component string            `json:"c"`
+	ID        int               `json:"id"`
+	Message   string            `json:"msg"`
+	Severity  string            `json:"s"`
+	Timestamp map[string]string `json:"t"`
+}
+
+// NewLogEvents returns *LogEvents
+func NewLogEvents() *LogEvents {
+	return &LogEvents{catalogue: map[string]LogEvent{}, timeline: map[string]Histogram{}}
+}
+
+// Add classifies a logv2 line and adds it to the catalogue and the timeline, returns the minute of the event
+func (le *LogEvents) Add(str string) string {
+	if le.catalogue == nil {
+		le.restore()
+	}
+	found := false
+	for _, keyword := range eventKeywords {
+		if strings.Contains(str, keyword) {
+			found = true
+			break
+		}
+	}
+	if !found {
+		return ""
+	}
+	var doc logv2Event
+	if err := json.Unmarshal([]byte(str), &doc); err != nil || len(doc.Timestamp["$date"]) < 16 {
+		return ""
+	}
+	category, count := classifyLogEvent(doc, str)
+	if category == "" {
+		return ""
+	}
+	utc := getUTCMinute(doc.Timestamp["$date"])
+	if le.inRange != nil && !le.inRange(utc) {
+		return ""
+	}
+	le.add(category, doc.Component, doc.ID, doc.Message, doc.Severity, utc, count)
+	return utc
+}
+
+// add adds counts of an event
+func (le *LogEvents) add(category string, component string, id int, message string, severity string, utc string, count int) {
+	key := fmt.Sprintf("%v.%d.%v", component, id, category)
+	event, ok := le.catalogue[key]
+	if !ok {
+		event = LogEvent{Category: category, Component: component, First: utc, ID: id, Last: utc, Message: message, Severity: severity}
+	}
+	event.Count += count
+	if utc < event.First {
+		event.First = utc
+	}
+	if utc > event.Last {
+		event.Last = utc
+	}
+	le.catalogue[key] = event
+	hist, ok := le.timeline[utc]
+	if !ok {
+		hist = Histogram{UTC: utc, Ops: map[string]int{}}
+	}
+	hist.Ops[category] += count
+	le.timeline[utc] = hist
+}
+
+// classifyLogEvent returns category and count of an event
+func classifyLogEvent(doc logv2Event, str string) (string, int) {
+	attr := doc.Attributes
+	if doc.Severity == "F" {
+		return EventFatal, 1
+	} else if doc.ID == idStateTransition {
+		if attr.NewState == "PRIMARY" {
+			return EventElection, 1
+		} else if attr.OldState == "PRIMARY" {
+			return EventStepDown, 1
+		}
+		return "", 0
+	} else if doc.Component == "ELECTION" {
+		return EventElection, 1
+	} else if strings.Contains(doc.Component, "ROLLBACK") {
+		return EventRollback, 1
+	} else if attr.WriteConflicts > 0 {
+		return EventWriteConflict, attr.WriteConflicts
+	} else if strings.Contains(str, "WriteConflict") {
+		return EventWriteConflict, 1
+	} else if doc.ID == idConnectionAccepted {
+		return EventConnection, 1
+	} else if doc.Component == "WTCHKPT" || strings.Contains(str, "Checkpoint has been running for") {
+		if message := fmt.Sprint(attr.Message); strings.Contains(message, "Checkpoint has been running for") ||
+			strings.Contains(message, "Checkpoint ran for") {
+			return EventCheckpoint, 1
+		}
+		return "", 0
+	} else if doc.Component == "ASSERT" || strings.Contains(doc.Message, "Assertion") {
+		return EventAssertion, 1
+	} else if doc.Component == "INDEX" && strings.HasPrefix(doc.Message, "Index build") {
+		return EventIndexBuild, 1
+	} else if doc.Severity == "E" {
+		return EventError, 1
+	} else if doc.Severity == "W" {
+		return EventWarning, 1
+	}
+	return "", 0
+}
+
+// Finalize detects connection spikes and write conflict storms, and sorts the catalogue and the timeline
+func (le *LogEvents) Finalize() {
+	total, minutes := 0, 0
+	for _, hist := range le.timeline {
+		if n := hist.Ops[EventConnection]; n > 0 {
+			total += n
+			minutes++
+		}
+	}
+	for utc, hist := range le.timeline {
+		if n := hist.Ops[EventConnection]; n >= connectionSpikeMin && n*minutes >= connectionSpikeRatio*total {
+			le.add(EventConnectionSpike, "NETWORK", idConnectionAccepted, "Connection accepted", "I", utc, 1)
+		}
+		if hist.Ops[EventWriteConflict] >= writeConflictsStormMin {
+			le.add(EventWriteConflicts, "", 0, "writeConflicts", "I", utc, 1)
+		}
+	}
+	le.Catalogue = make([]LogEvent, 0, len(le.catalogue))
+	for _, event := range le.catalogue {
+		le.Catalogue = append(le.Catalogue, event)
+	}
+	sort.Slice(le.Catalogue, func(i, j int) bool {
+		if le.Catalogue[i].Category == le.Catalogue[j].Category {
+			return le.Catalogue[i].Count > le.Catalogue[j].Count
+		}
+		return le.Catalogue[i].Category < le.Catalogue[j].Category
+	})
+	le.Timeline = make([]Histogram, 0, len(le.timeline))
+	for _, hist := range le.timeline {
+		le.Timeline = append(le.Timeline, hist)
+	}
+	sort.Slice(le.Timeline, func(i, j int) bool { return le.Timeline[i].UTC < le.Timeline[j].UTC })
+}
+
+// Merge merges events of another LogEvents
+func (le *LogEvents) Merge(other LogEvents) {
+	le.restore()
+	for _, event := range other.Catalogue {
+		if event.Category == EventConnectionSpike || event.Category == EventWriteConflicts {
+			continue // detected again
+		}
+		key := fmt.Sprintf("%v.%d.%v", event.Component, event.ID, event.Category)
+		if e, ok := le.catalogue[key]; ok {
+			e.Count += event.Count
+			if event.First < e.First {
+				e.First = event.First
+			}
+			if event.Last > e.Last {
+				e.Last = event.Last
+			}
+			event = e
+		}
+		le.catalogue[key] = event
+	}
+	for _, value := range other.Timeline {
+		hist, ok := le.timeline[value.UTC]
+		if !ok {
+			hist = Histogram{UTC: value.UTC, Ops: map[string]int{}}
+		}
+		for category, count := range value.Ops {
+			if category != EventConnectionSpike && category != EventWriteConflicts {
+				hist.Ops[category] += count
+			}
+		}
+		le.timeline[value.UTC] = hist
+	}
+	le.Finalize()
+}
+
+// restore rebuilds maps from the catalogue and the timeline, without detected spikes and storms
+func (le *LogEvents) restore() {
+	le.catalogue = map[string]LogEvent{}
+	le.timeline = map[string]Histogram{}
+	for _, event := range le.Catalogue {
+		if event.Category != EventConnectionSpike && event.Category != EventWriteConflicts {
+			le.catalogue[fmt.Sprintf("%v.%d.%v", event.Component, event.ID, event.Category)] = event
+		}
+	}
+	for _, value := range le.Timeline {
+		hist := Histogram{UTC: value.UTC, Ops: map[string]int{}}
+		for category, count := range value.Ops {
+			if category != EventConnectionSpike && category != EventWriteConflicts {
+				hist.Ops[category] += count
+			}
+		}
+		le.timeline[value.UTC] = hist
+	}
+}
+
+// GetNotableMinutes returns minutes of elections, stepdowns, rollbacks, fatal errors, slow checkpoints,
+// connection spikes, and write conflict storms
+func (le *LogEvents) GetNotableMinutes() []Histogram {
+	minutes := []Histogram{}
+	for _, hist := range le.Timeline {
+		for category := range hist.Ops {
+			if notableEvents[category] {
+				minutes = append(minutes, hist)
+				break
+			}
+		}
+	}
+	return minutes
+}
+
+// Print prints events summary
+func (le *LogEvents) Print() {
+	fmt.Println(le.printEventsSummary())
+}
+
+// printEventsSummary prints event catalogue and notable minutes
+func (le *LogEvents) printEventsSummary() string {
+	var maxSize = 25
+	var buffer bytes.Buffer
+	buffer.WriteString("+--------------------+----------+--------+-------+-------------------+-------------------+------------------------------------------+\n")
+	buffer.WriteString(fmt.Sprintf("| %-19s| %-9s|   id   | Count | %-18s| %-18s| %-40s |\n", "Event", "Component", "First", "Last", "Message"))
+	buffer.WriteString("|--------------------+----------+--------+-------+-------------------+-------------------+------------------------------------------|\n")
+	count := 0
+	for _, event := range le.Catalogue {
+		if count >= maxSize {
+			break
+		}
+		count++
+		component := event.Component
+		if len(component) > 10 {
+			component = component[:10]
+		}
+		message := event.Message
+		if len(message) > 42 {
+			message = message[:39] + "..."
+		}
+		buffer.WriteString(fmt.Sprintf("|%-20s %-10s %8d %7d %-19s %-19s %-42s|\n", event.Category, component, event.ID,
+			event.Count, strings.TrimSuffix(event.First, ":00Z"), strings.TrimSuffix(event.Last, ":00Z"), message))
+	}
+	buffer.WriteString("+--------------------+----------+--------+-------+-------------------+-------------------+------------------------------------------+\n")
+	buffer.WriteString(fmt.Sprintf("top %d of %v event types displayed.\n", count, len(le.Catalogue)))
+	minutes := le.GetNotableMinutes()
+	for i, hist := range minutes {
+		if i >= maxSize {
+			buffer.WriteString(fmt.Sprintf("... %d more minutes\n", len(minutes)-maxSize))
+			break
+		}
+		categories := []string{}
+		for category := range hist.Ops {
+			categories = append(categories, category)
+		}
+		sort.Strings(categories)
+		strs := []string{}
+		for _, category := range categories {
+			strs = append(strs, fmt.Sprintf("%v: %d", category, hist.Ops[category]))
+		}
+		buffer.WriteString(fmt.Sprintf("%v %v\n", hist.UTC, strings.Join(strs, ", ")))
+	}
+	return strings.TrimSuffix(buffer.String(), "\n")
+}
@@ -0,0 +1,69 @@
+// Copyright 2020-present Kuei-chun Chen. All rights reserved.
+
+package mdb
+
+import (
+	"bufio"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestLogEvents(t *testing.T) {
+	lines := []string{
+		`{"t":{"$date":"2021-06-01T10:00:01.000+00:00"},"s":"I","c":"REPL","id":21358,"ctx":"ReplCoord-0","msg":"Replica set state transition","attr":{"newState":"PRIMARY","oldState":"SECONDARY"}}`,
+		`{"t":{"$date":"2021-06-01T10:05:01.000+00:00"},"s":"I","c":"REPL","id":21358,"ctx":"ReplCoord-0","msg":"Replica set state transition","attr":{"newState":"SECONDARY","oldState":"PRIMARY"}}`,
+		`{"t":{"$date":"2021-06-01T10:06:01.000+00:00"},"s":"E","c":"STORAGE","id":22435,"ctx":"conn1","msg":"WiredTiger error","attr":{"error":28}}`,
+		`{"t":{"$date":"2021-06-01T10:07:01.000+00:00"},"s":"I","c":"WTCHKPT","id":22430,"ctx":"Checkpointer","msg":"WiredTiger message","attr":{"message":{"msg":"[WT_VERB_CHECKPOINT_PROGRESS] Checkpoint has been running for 20 seconds and wrote: 1000 pages"}}}`,
+		`{"t":{"$date":"2021-06-01T10:08:01.000+00:00"},"s":"I","c":"INDEX","id":20384,"ctx":"IndexBuildsCoordinator-0","msg":"Index build: starting","attr":{"namespace":"keyhole.cars"}}`,
+		`{"t":{"$date":"2021-06-01T10:09:01.000+00:00"},"s":"I","c":"WRITE","id":51803,"ctx":"conn2","msg":"Slow query","attr":{"type":"update","ns":"keyhole.cars","command":{"q":{"color":"red"},"u":{"$set":{"a":1}}},"planSummary":"COLLSCAN","writeConflicts":150,"durationMillis":200}}`,
+	}
+	for i := 0; i < 60; i++ {
+		lines = append(lines, fmt.Sprintf(`{"t":{"$date":"2021-06-01T10:10:%02d.000+00:00"},"s":"I","c":"NETWORK","id":22943,"ctx":"listener","msg":"Connection accepted","attr":{"remote":"10.0.0.1:%d","connectionCount":%d}}`, i, 50000+i, i))
+	}
+	for i := 0; i < 10; i++ {
+		lines = append(lines, fmt.Sprintf(`{"t":{"$date":"2021-06-01T10:%02d:00.000+00:00"},"s":"I","c":"NETWORK","id":22943,"ctx":"listener","msg":"Connection accepted","attr":{"remote":"10.0.0.2:%d","connectionCount":1}}`, 20+i, 40000+i))
+	}
+	loginfo := NewLogInfo("utest-xxxxxx")
+	loginfo.SetSilent(true)
+	if err := loginfo.Parse(bufio.NewReader(strings.NewReader(strings.Join(lines, "\n")))); err != nil {
+		t.Fatal(err)
+	}
+	counts := map[string]int{}
+	for _, event := range loginfo.Events.Catalogue {
+		counts[event.Category] += event.Count
+	}
+	expected := map[string]int{EventElection: 1, EventStepDown: 1, EventError: 1, EventCheckpoint: 1, EventIndexBuild: 1,
+		EventWriteConflict: 150, EventWriteConflicts: 1, EventConnection: 70, EventConnectionSpike: 1}
+	for category, count := range expected {
+		if counts[category] != count {
+			t.Fatal("expected", count, category, "but got", counts[category], counts)
+		}
+	}
+	if minutes := loginfo.Events.GetNotableMinutes(); len(minutes) != 5 || minutes[0].UTC != "2021-06-01T10:00:00Z" {
+		t.Fatal("expected 5 notable minutes but got", minutes)
+	}
+	str := loginfo.Events.printEventsSummary()
+	if !strings.Contains(str, "2021-06-01T10:10:00Z connection: 60, connection spike: 1") {
+		t.Fatal("unexpected summary", str)
+	}
+
+	other := NewLogInfo("utest-xxxxxx")
+	other.Merge(loginfo)
+	if len(other.Events.Catalogue) != len(loginfo.Events.Catalogue) {
+		t.Fatal("expected", len(loginfo.Events.Catalogue), "event types but got", len(other.Events.Catalogue))
+	}
+}
+
+func TestLogEventsUTC(t *testing.T) {
+	events := NewLogEvents()
+	str := `{"t":{"$date":"2021-06-01T06:00:01.000-04:00"},"s":"I","c":"REPL","id":21358,"ctx":"ReplCoord-0","msg":"Replica set state transition","attr":{"newState":"PRIMARY","oldState":"SECONDARY"}}`
+	if utc := events.Add(str); utc != "2021-06-01T10:00:00Z" {
+		t.Fatal("expected 2021-06-01T10:00:00Z but got", utc)
+	}
+	op := `{"t":{"$date":"2021-06-01T06:00:02.000-04:00"},"s":"I","c":"COMMAND","id":51803,"ctx":"conn1","msg":"Slow query","attr":{"type":"command","ns":"keyhole.cars","command":{"find":"cars","filter":{"color":"red"}},"planSummary":"COLLSCAN","durationMillis":100}}`
+	loginfo := NewLogInfo("utest-xxxxxx")
+	if stat, err := loginfo.ParseLogv2(op); err != nil || stat.utc != "2021-06-01T10:00:00Z" {
+		t.Fatal("expected events and ops in the same minute but got", stat.utc, err)
+	}
+}
@@ -0,0 +1,331 @@
+// Copyright 2020-present Kuei-chun Chen. All rights reserved.
+
+package mdb
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// clockSkew is the tolerance of matching mongos and shards ops times
+const clockSkew = time.Second
+
+// FanOut stores mongos fan-out stats of a query pattern
+type FanOut struct {
+	Command       string           `bson:"command"`
+	Count         int              `bson:"count"`       // number of mongos ops
+	Filter        string           `bson:"filter"`      // query pattern
+	MaxShards     int              `bson:"maxshards"`   // max shards contacted
+	Namespace     string           `bson:"ns"`          // database.collection
+	ScatterGather int              `bson:"scatter"`     // ops sent to more than one shard
+	ShardMillis   map[string]int64 `bson:"shardmillis"` // shard ops milliseconds by shard
+	Targeted      int              `bson:"targeted"`    // ops sent to one shard
+	TotalMilli    int64            `bson:"totalmilli"`  // total mongos milliseconds
+	TotalShards   int64            `bson:"totalshards"` // total shards contacted
+}
+
+// GetTopShard returns the shard contributing most latency
+func (fo FanOut) GetTopShard() (string, int64) {
+	shard := ""
+	milli := int64(0)
+	for k, v := range fo.ShardMillis {
+		if v > milli || (v == milli && k < shard) {
+			shard = k
+			milli = v
+		}
+	}
+	return shard, milli
+}
+
+// replSetNameRegexp matches the replica set name of startup options and replica set configurations logs
+var replSetNameRegexp = regexp.MustCompile(`"replSetName":"([^"]+)"`)
+
+// hostRegexp matches the host of the MongoDB starting log
+var hostRegexp = regexp.MustCompile(`"msg":"MongoDB starting".*"host":"([^"]+)"`)
+
+// LogFanOut correlates mongos and shards logs
+type LogFanOut struct {
+	FanOuts []FanOut `bson:"fanOuts"`
+
+	loginfo *LogInfo
+	mongos  []fanOutOp
+	names   map[string]string // shard names by log files
+	shards  []fanOutOp
+}
+
+// fanOutOp stores an op from either mongos or a shard
+type fanOutOp struct {
+	begin   time.Time
+	end     time.Time
+	keys    []string // correlation keys by priority, clientOperationKey, lsid, and mongos client
+	milli   int
+	nShards int
+	shard   string
+	stat    LogStats
+}
+
+// logv2FanOut stores logv2 attributes for correlating mongos and shards ops
+type logv2FanOut struct {
+	Attributes struct {
+		Command struct {
+			ClientOperationKey interface{} `json:"clientOperationKey"`
+			Client             struct {
+				Mongos struct {
+					Client string `json:"client"`
+					Host   string `json:"host"`
+				} `json:"mongos"`
+			} `json:"$client"`
+			FromMongos bool `json:"fromMongos"`
+			LSID       struct {
+				ID interface{} `json:"id"`
+			} `json:"lsid"`
+		} `json:"command"`
+		Milli   int    `json:"durationMillis"`
+		NShards int    `json:"nShards"`
+		Remote  string `json:"remote"`
+	} `json:"attr"`
+	Timestamp map[string]string `json:"t"`
+}
+
+// NewLogFanOut returns *LogFanOut
+func NewLogFanOut(loginfo *LogInfo) *LogFanOut {
+	return &LogFanOut{loginfo: loginfo, names: map[string]string{}}
+}
+
+// AnalyzeFiles reads mongos and shards logs and correlates ops
+func (lf *LogFanOut) AnalyzeFiles(filenames []string) error {
+	for _, filename := range filenames {
+		if err := lf.AnalyzeFile(filename); err != nil {
+			return err
+		}
+	}
+	lf.Correlate()
+	return nil
+}
+
+// AnalyzeFile reads a mongos or a mongod logv2 file. The shard is named after the replica set
+// name, or the host, found in the log, otherwise after the file.
+func (lf *LogFanOut) AnalyzeFile(filename string) error {
+	var err error
+	var reader *bufio.Reader
+	var source LogSource
+	if source, err = NewLogSource(filename); err != nil {
+		return err
+	}
+	defer source.Close()
+	if reader, err = source.Open(); err != nil {
+		return err
+	}
+	var host, replSet string
+	li := lf.loginfo.clone()
+	li.LogType = "logv2"
+	for {
+		var str string
+		if str, err = reader.ReadString('\n'); err != nil && str == "" {
+			break
+		}
+		if !strings.Contains(str, "durationMillis") {
+			if matches := replSetNameRegexp.FindStringSubmatch(str); len(matches) > 1 {
+				replSet = matches[1]
+			} else if matches = hostRegexp.FindStringSubmatch(str); len(matches) > 1 {
+				host = matches[1]
+			}
+		}
+		lf.Add(li, filename, strings.TrimRight(str, "\r\n"))
+	}
+	if replSet != "" {
+		lf.names[filename] = replSet
+	} else if host != "" {
+		lf.names[filename] = host
+	} else {
+		lf.names[filename] = strings.TrimSuffix(strings.TrimSuffix(filepath.Base(filename), ".gz"), ".log")
+	}
+	return nil
+}
+
+// Add parses a log line and adds it as a mongos op or a shard op
+func (lf *LogFanOut) Add(li *LogInfo, shard string, str string) {
+	if !strings.HasPrefix(str, "{") || !strings.Contains(str, "durationMillis") {
+		return
+	}
+	stat, err := li.ParseLogv2(str)
+	if err != nil || stat.op == "" || stat.op == dollarCmd {
+		return
+	}
+	var doc logv2FanOut
+	if err = json.Unmarshal([]byte(str), &doc); err != nil {
+		return
+	}
+	end, err := time.Parse(time.RFC3339, doc.Timestamp["$date"])
+	if err != nil {
+		return
+	}
+	op := fanOutOp{begin: end.Add(-time.Duration(doc.Attributes.Milli) * time.Millisecond), end: end,
+		milli: doc.Attributes.Milli, nShards: doc.Attributes.NShards, shard: shard, stat: stat}
+	command := doc.Attributes.Command
+	if command.ClientOperationKey != nil { // opId is a per-process counter and not correlated
+		data, _ := json.Marshal(command.ClientOperationKey)
+		op.keys = append(op.keys, "opKey:"+string(data))
+	}
+	if command.LSID.ID != nil {
+		data, _ := json.Marshal(command.LSID.ID)
+		op.keys = append(op.keys, "lsid:"+string(data))
+	}
+	if command.Client.Mongos.Client != "" || command.FromMongos { // sent from a mongos
+		if command.Client.Mongos.Client != "" {
+			op.keys = append(op.keys, "client:"+command.Client.Mongos.Client)
+		}
+		if len(op.keys) > 0 {
+			lf.shards = append(lf.shards, op)
+		}
+	} else if doc.Attributes.NShards > 0 { // mongos
+		if doc.Attributes.Remote != "" {
+			op.keys = append(op.keys, "client:"+doc.Attributes.Remote)
+		}
+		lf.mongos = append(lf.mongos, op)
+	}
+}
+
+// getShardName returns the shard name of a log file
+func (lf *LogFanOut) getShardName(filename string) string {
+	if name, ok := lf.names[filename]; ok {
+		return name
+	}
+	return filename
+}
+
+// Correlate matches shards ops to mongos ops by clientOperationKey, lsid, or client, in the order, namespace, and time
+func (lf *LogFanOut) Correlate() {
+	mongosMap := map[string][]int{}
+	for i, op := range lf.mongos {
+		for _, key := range op.keys {
+			mongosMap[key] = append(mongosMap[key], i)
+		}
+	}
+	shardMillisList := make([]map[string]int64, len(lf.mongos))
+	for _, sop := range lf.shards {
+		best := -1
+		for _, key := range sop.keys {
+			if best = lf.findMongosOp(sop, mongosMap[key]); best >= 0 {
+				break
+			}
+		}
+		if best < 0 {
+			continue
+		}
+		if shardMillisList[best] == nil {
+			shardMillisList[best] = map[string]int64{}
+		}
+		shardMillisList[best][lf.getShardName(sop.shard)] += int64(sop.milli)
+	}
+	fanOuts := map[string]FanOut{}
+	for i, op := range lf.mongos {
+		shardMillis := shardMillisList[i]
+		nShards := op.nShards
+		if len(shardMillis) > nShards {
+			nShards = len(shardMillis)
+		}
+		stat := op.stat
+		key := getOpPatternKey(stat.op, stat.ns, getShapeKey(stat.queryHash, stat.shape, stat.filter), "")
+		fo, ok := fanOuts[key]
+		if !ok {
+			fo = FanOut{Command: stat.op, Filter: stat.filter, Namespace: stat.ns, ShardMillis: map[string]int64{}}
+		}
+		fo.Count++
+		fo.TotalMilli += int64(op.milli)
+		fo.TotalShards += int64(nShards)
+		if nShards > fo.MaxShards {
+			fo.MaxShards = nShards
+		}
+		if nShards > 1 {
+			fo.ScatterGather++
+		} else {
+			fo.Targeted++
+		}
+		for shard, milli := range shardMillis {
+			fo.ShardMillis[shard] += milli
+		}
+		fanOuts[key] = fo
+	}
+	lf.FanOuts = make([]FanOut, 0, len(fanOuts))
+	for _, fo := range fanOuts {
+		lf.FanOuts = append(lf.FanOuts, fo)
+	}
+	sort.Slice(lf.FanOuts, func(i, j int) bool {
+		return lf.FanOuts[i].TotalMilli > lf.FanOuts[j].TotalMilli
+	})
+}
+
+// findMongosOp returns the index of the closest mongos op in time of the same namespace, or -1
+func (lf *LogFanOut) findMongosOp(sop fanOutOp, candidates []int) int {
+	best := -1
+	var distance time.Duration
+	for _, i := range candidates {
+		op := lf.mongos[i]
+		if op.stat.ns != sop.stat.ns || sop.end.Before(op.begin.Add(-clockSkew)) || sop.begin.After(op.end.Add(clockSkew)) {
+			continue
+		}
+		d := op.end.Sub(sop.end)
+		if d < 0 {
+			d = -d
+		}
+		if best < 0 || d < distance {
+			best = i
+			distance = d
+		}
+	}
+	return best
+}
+
+// Print prints fan-out summary
+func (lf *LogFanOut) Print() {
+	fmt.Println(lf.printFanOutSummary())
+}
+
+// printFanOutSummary prints fan-out by query patterns
+func (lf *LogFanOut) printFanOutSummary() string {
+	var maxSize = 10
+	var buffer bytes.Buffer
+	buffer.WriteString("+----------+------+-------+-------+------+------+------------------------------+---------------------------------+------------------------------------------+\n")
+	buffer.WriteString(fmt.Sprintf("| Command  | Count|target%%|scatter|shards|  max | %-29s| %-32s| %-40s |\n", "Top Shard (ms)", "Namespace", "Query Pattern"))
+	buffer.WriteString("|----------+------+-------+-------+------+------+------------------------------+---------------------------------+------------------------------------------|\n")
+	count := 0
+	for _, fo := range lf.FanOuts {
+		if count >= maxSize {
+			break
+		}
+		count++
+		command := fo.Command
+		if len(command) > 10 {
+			command = command[:10]
+		}
+		ns := fo.Namespace
+		if len(ns) > 33 {
+			ns = ns[:1] + "*" + ns[(len(ns)-31):]
+		}
+		filter := fo.Filter
+		if len(filter) > 42 {
+			filter = filter[:39] + "..."
+		}
+		top := ""
+		if shard, milli := fo.GetTopShard(); shard != "" {
+			top = fmt.Sprintf("%v (%d)", shard, milli)
+			if len(top) > 30 {
+				top = "*" + top[len(top)-29:]
+			}
+		}
+		buffer.WriteString(fmt.Sprintf("|%-10s %6d %6.1f%% %6.1f%% %6.1f %6d %-30s %-33s %-42s|\n", command, fo.Count,
+			100*float64(fo.Targeted)/float64(fo.Count), 100*float64(fo.ScatterGather)/float64(fo.Count),
+			float64(fo.TotalShards)/float64(fo.Count), fo.MaxShards, top, ns, filter))
+	}
+	buffer.WriteString("+----------+------+-------+-------+------+------+------------------------------+---------------------------------+------------------------------------------+\n")
+	buffer.WriteString(fmt.Sprintf(`top %d of %v mongos query patterns displayed.`, count, len(lf.FanOuts)))
+	return buffer.String()
+}
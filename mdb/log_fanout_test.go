@@ -0,0 +1,58 @@
+// Copyright 2020-present Kuei-chun Chen. All rights reserved.
+
+package mdb
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLogFanOut(t *testing.T) {
+	dir := t.TempDir()
+	mongos := []string{
+		`{"t":{"$date":"2020-11-05T09:30:51.000+00:00"},"s":"I","c":"COMMAND","id":51803,"ctx":"conn1","msg":"Slow query","attr":{"type":"command","ns":"keyhole.cars","command":{"find":"cars","filter":{"color":"red"},"lsid":{"id":{"$uuid":"4397f6ad-0e47-4555-a5cf-d2b58c5ecb85"}},"$db":"keyhole"},"nShards":2,"nreturned":10,"reslen":1000,"remote":"10.0.0.1:50000","durationMillis":500}}`,
+		`{"t":{"$date":"2020-11-05T09:30:52.000+00:00"},"s":"I","c":"COMMAND","id":51803,"ctx":"conn1","msg":"Slow query","attr":{"type":"command","ns":"keyhole.cars","command":{"find":"cars","filter":{"make":"ford"},"lsid":{"id":{"$uuid":"4397f6ad-0e47-4555-a5cf-d2b58c5ecb85"}},"$db":"keyhole"},"nShards":1,"nreturned":1,"reslen":100,"remote":"10.0.0.1:50000","durationMillis":100}}`,
+		`{"t":{"$date":"2020-11-05T09:30:53.000+00:00"},"s":"I","c":"COMMAND","id":51803,"ctx":"conn4","msg":"Slow query","attr":{"type":"command","ns":"keyhole.cars","command":{"find":"cars","filter":{"year":2020},"clientOperationKey":{"$uuid":"2b1e7b0c-5c5e-4a53-9a0e-1f0c2c1d3e4f"},"$db":"keyhole"},"nShards":1,"nreturned":1,"reslen":100,"remote":"10.0.0.2:50000","durationMillis":300}}`,
+	}
+	shard0 := []string{
+		`{"t":{"$date":"2020-11-05T09:00:00.000+00:00"},"s":"I","c":"CONTROL","id":21951,"ctx":"initandlisten","msg":"Options set by command line","attr":{"options":{"replication":{"replSetName":"shard0"},"sharding":{"clusterRole":"shardsvr"}}}}`,
+		`{"t":{"$date":"2020-11-05T09:30:50.900+00:00"},"s":"I","c":"COMMAND","id":51803,"ctx":"conn2","msg":"Slow query","attr":{"type":"command","ns":"keyhole.cars","command":{"find":"cars","filter":{"color":"red"},"lsid":{"id":{"$uuid":"4397f6ad-0e47-4555-a5cf-d2b58c5ecb85"}},"$client":{"mongos":{"host":"mongos:27017","client":"10.0.0.1:50000"}},"$db":"keyhole"},"planSummary":"COLLSCAN","durationMillis":400}}`,
+		`{"t":{"$date":"2020-11-05T09:30:51.990+00:00"},"s":"I","c":"COMMAND","id":51803,"ctx":"conn2","msg":"Slow query","attr":{"type":"command","ns":"keyhole.cars","command":{"find":"cars","filter":{"make":"ford"},"lsid":{"id":{"$uuid":"4397f6ad-0e47-4555-a5cf-d2b58c5ecb85"}},"$client":{"mongos":{"host":"mongos:27017","client":"10.0.0.1:50000"}},"$db":"keyhole"},"planSummary":"COLLSCAN","durationMillis":90}}`,
+	}
+	shard1 := []string{
+		`{"t":{"$date":"2020-11-05T09:00:00.000+00:00"},"s":"I","c":"CONTROL","id":4615611,"ctx":"initandlisten","msg":"MongoDB starting","attr":{"pid":1,"port":27018,"dbPath":"/data/db","architecture":"64-bit","host":"shard1-a"}}`,
+		`{"t":{"$date":"2020-11-05T09:30:52.950+00:00"},"s":"I","c":"COMMAND","id":51803,"ctx":"conn5","msg":"Slow query","attr":{"type":"command","ns":"keyhole.cars","command":{"find":"cars","filter":{"year":2020},"clientOperationKey":{"$uuid":"2b1e7b0c-5c5e-4a53-9a0e-1f0c2c1d3e4f"},"$client":{"mongos":{"host":"mongos:27017","client":"10.0.0.9:50000"}},"$db":"keyhole"},"planSummary":"COLLSCAN","durationMillis":250}}`,
+		`{"t":{"$date":"2020-11-05T09:30:50.800+00:00"},"s":"I","c":"COMMAND","id":51803,"ctx":"conn3","msg":"Slow query","attr":{"type":"command","ns":"keyhole.cars","command":{"find":"cars","filter":{"color":"red"},"lsid":{"id":{"$uuid":"4397f6ad-0e47-4555-a5cf-d2b58c5ecb85"}},"$client":{"mongos":{"host":"mongos:27017","client":"10.0.0.1:50000"}},"$db":"keyhole"},"planSummary":"COLLSCAN","durationMillis":200}}`,
+	}
+	filenames := []string{}
+	for name, lines := range map[string][]string{"mongos.log": mongos, "node-a.log": shard0, "node-b.log": shard1} {
+		filename := filepath.Join(dir, name)
+		if err := os.WriteFile(filename, []byte(strings.Join(lines, "\n")), 0644); err != nil {
+			t.Fatal(err)
+		}
+		filenames = append(filenames, filename)
+	}
+	fanout := NewLogFanOut(NewLogInfo("utest-xxxxxx"))
+	if err := fanout.AnalyzeFiles(filenames); err != nil {
+		t.Fatal(err)
+	}
+	if len(fanout.FanOuts) != 3 {
+		t.Fatal("expected 3 fan-outs but got", len(fanout.FanOuts))
+	}
+	fo := fanout.FanOuts[0]
+	if fo.ScatterGather != 1 || fo.Targeted != 0 || fo.MaxShards != 2 {
+		t.Fatal("unexpected fan-out", fo)
+	}
+	if shard, milli := fo.GetTopShard(); shard != "shard0" || milli != 400 {
+		t.Fatal("expected shard0 (400) but got", shard, milli)
+	}
+	if fo = fanout.FanOuts[1]; fo.Filter != `{"year":1}` || fo.ShardMillis["shard1-a"] != 250 {
+		t.Fatal("expected correlated by clientOperationKey, but got", fo)
+	}
+	if fo = fanout.FanOuts[2]; fo.Targeted != 1 || fo.ShardMillis["shard0"] != 90 {
+		t.Fatal("unexpected fan-out", fo)
+	}
+	t.Log(fanout.printFanOutSummary())
+}
@@ -0,0 +1,249 @@
+// Copyright 2020-present Kuei-chun Chen. All rights reserved.
+
+package mdb
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// LogFollower tails a live log file and keeps ops patterns of a rolling window
+type LogFollower struct {
+	buckets   map[string]map[string]OpPattern // ops patterns by minute
+	done      chan struct{}
+	fromStart bool
+	hists     map[string]Histogram
+	interval  time.Duration
+	latest    string
+	loginfo   *LogInfo
+	mutex     sync.Mutex
+	poll      time.Duration
+	slowOps   map[string][]RawLog // slowest ops by minute
+	window    time.Duration
+}
+
+// NewLogFollower returns *LogFollower
+func NewLogFollower(loginfo *LogInfo) *LogFollower {
+	return &LogFollower{loginfo: loginfo, buckets: map[string]map[string]OpPattern{}, done: make(chan struct{}),
+		hists: map[string]Histogram{}, interval: 30 * time.Second, poll: time.Second, slowOps: map[string][]RawLog{},
+		window: 10 * time.Minute}
+}
+
+// SetFromStart reads from the beginning of the file instead of the end
+func (lf *LogFollower) SetFromStart(fromStart bool) {
+	lf.fromStart = fromStart
+}
+
+// SetInterval sets interval of printing top slow query shapes
+func (lf *LogFollower) SetInterval(interval time.Duration) {
+	lf.interval = interval
+}
+
+// SetPollInterval sets interval of checking a file for new lines
+func (lf *LogFollower) SetPollInterval(poll time.Duration) {
+	lf.poll = poll
+}
+
+// SetWindow sets rolling window size
+func (lf *LogFollower) SetWindow(window time.Duration) {
+	lf.window = window
+}
+
+// Stop stops following
+func (lf *LogFollower) Stop() {
+	close(lf.done)
+}
+
+// Follow tails a log file, handles rotation and truncation, until stopped
+func (lf *LogFollower) Follow(filename string) error {
+	var err error
+	var file *os.File
+	var offset int64
+	if file, err = os.Open(filename); err != nil {
+		return err
+	}
+	defer func() { file.Close() }()
+	if !lf.fromStart {
+		if offset, err = file.Seek(0, io.SeekEnd); err != nil {
+			return err
+		}
+	}
+	reader := bufio.NewReader(file)
+	ticker := time.NewTicker(lf.interval)
+	defer ticker.Stop()
+	partial := ""
+	for {
+		select {
+		case <-lf.done:
+			lf.Refresh()
+			return nil
+		case <-ticker.C:
+			lf.Refresh()
+			lf.Print()
+		default:
+		}
+		var line string
+		line, err = reader.ReadString('\n')
+		offset += int64(len(line))
+		if err == nil {
+			lf.Add(strings.TrimRight(partial+line, "\r\n"))
+			partial = ""
+			continue
+		} else if err != io.EOF {
+			return err
+		}
+		partial += line
+		time.Sleep(lf.poll)
+		var info, finfo os.FileInfo
+		if info, err = os.Stat(filename); err != nil { // being rotated
+			continue
+		}
+		if finfo, err = file.Stat(); err != nil {
+			return err
+		}
+		if !os.SameFile(info, finfo) { // rotated, drains the old file and reopens
+			var nfile *os.File
+			if nfile, err = os.Open(filename); err != nil {
+				continue
+			}
+			lf.drain(reader, partial)
+			file.Close()
+			file = nfile
+			reader.Reset(file)
+			offset = 0
+			partial = ""
+		} else if info.Size() < offset { // truncated
+			if _, err = file.Seek(0, io.SeekStart); err != nil {
+				return err
+			}
+			reader.Reset(file)
+			offset = 0
+			partial = ""
+		}
+	}
+}
+
+// drain adds lines written to a rotated file after the last read
+func (lf *LogFollower) drain(reader *bufio.Reader, partial string) {
+	for {
+		line, err := reader.ReadString('\n')
+		partial += line
+		if err != nil {
+			break
+		}
+		lf.Add(strings.TrimRight(partial, "\r\n"))
+		partial = ""
+	}
+	lf.Add(strings.TrimRight(partial, "\r\n"))
+}
+
+// Add parses a log line and adds it to the per minute buckets
+func (lf *LogFollower) Add(str string) {
+	if str == "" {
+		return
+	}
+	lf.mutex.Lock()
+	defer lf.mutex.Unlock()
+	stat, err := lf.loginfo.ParseLine(str)
+	if err != nil {
+		return
+	}
+	if lf.buckets[stat.utc] == nil {
+		lf.buckets[stat.utc] = map[string]OpPattern{}
+	}
+	lf.loginfo.collect(lf.buckets[stat.utc], stat, str)
+	if stat.op != cmdInsert {
+		lf.slowOps[stat.utc] = addSlowOp(lf.slowOps[stat.utc], RawLog{Milli: stat.milli, Log: str})
+	}
+	hist, ok := lf.hists[stat.utc]
+	if !ok {
+		hist = Histogram{UTC: stat.utc, Ops: map[string]int{}}
+	}
+	hist.Ops[stat.op]++
+	lf.hists[stat.utc] = hist
+	if stat.utc > lf.latest {
+		lf.latest = stat.utc
+	}
+}
+
+// Refresh drops buckets outside of the window and recalculates ops patterns
+func (lf *LogFollower) Refresh() {
+	lf.mutex.Lock()
+	defer lf.mutex.Unlock()
+	if latest, err := time.Parse(time.RFC3339, lf.latest); err == nil {
+		for utc := range lf.buckets {
+			if t, err := time.Parse(time.RFC3339, utc); err != nil || latest.Sub(t) >= lf.window {
+				delete(lf.buckets, utc)
+				delete(lf.hists, utc)
+				delete(lf.slowOps, utc)
+			}
+		}
+	}
+	opsMap := map[string]OpPattern{}
+	for _, bucket := range lf.buckets {
+		for key, value := range bucket {
+			if op, ok := opsMap[key]; ok {
+				opsMap[key] = mergeOpPattern(op, value)
+			} else {
+				value.Latency = value.Latency.Clone()
+				opsMap[key] = value
+			}
+		}
+	}
+	lf.loginfo.setOpPatterns(opsMap)
+	lf.loginfo.Histograms = []Histogram{}
+	for _, hist := range lf.hists {
+		lf.loginfo.Histograms = append(lf.loginfo.Histograms, hist)
+	}
+	sort.Slice(lf.loginfo.Histograms, func(i, j int) bool {
+		return lf.loginfo.Histograms[i].UTC < lf.loginfo.Histograms[j].UTC
+	})
+	lf.loginfo.SlowOps = []RawLog{}
+	for _, list := range lf.slowOps {
+		for _, op := range list {
+			lf.loginfo.SlowOps = addSlowOp(lf.loginfo.SlowOps, op)
+		}
+	}
+	lf.loginfo.logs = nil
+}
+
+// Print prints top slow query shapes of the window
+func (lf *LogFollower) Print() {
+	lf.mutex.Lock()
+	defer lf.mutex.Unlock()
+	fmt.Printf("\n%v slow query shapes of last %v, up to %v\n", time.Now().Format(time.RFC3339), lf.window, lf.latest)
+	lf.loginfo.Print()
+}
+
+// Handler supports resetful calls
+func (lf *LogFollower) Handler(w http.ResponseWriter, r *http.Request) {
+	lf.mutex.Lock()
+	patterns := lf.loginfo.OpPatterns
+	if len(patterns) > topN {
+		patterns = patterns[:topN]
+	}
+	slowOps := lf.loginfo.SlowOps
+	if lf.loginfo.Redaction {
+		slowOps = []RawLog{}
+	}
+	doc := bson.M{"ok": 1, "window": lf.window.String(), "latest": lf.latest,
+		"opPatterns": patterns, "histogram": lf.loginfo.Histograms, "slowOps": slowOps}
+	data, err := bson.MarshalExtJSON(doc, false, false)
+	lf.mutex.Unlock()
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(data)
+}
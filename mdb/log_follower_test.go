@@ -0,0 +1,65 @@
+// Copyright 2020-present Kuei-chun Chen. All rights reserved.
+
+package mdb
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestLogFollower(t *testing.T) {
+	var err error
+	filename := filepath.Join(t.TempDir(), "mongod.log")
+	line := `{"t":{"$date":"2020-11-05T09:%02d:50.680+00:00"},"s":"I","c":"COMMAND","id":51803,"ctx":"conn1","msg":"Slow query","attr":{"type":"command","ns":"keyhole.cars","command":{"find":"cars","filter":{"color":"red"}},"planSummary":"COLLSCAN","reslen":100,"durationMillis":%d}}` + "\n"
+	if err = os.WriteFile(filename, []byte(fmt.Sprintf(line, 0, 100)), 0644); err != nil {
+		t.Fatal(err)
+	}
+	loginfo := NewLogInfo("utest-xxxxxx")
+	loginfo.SetSilent(true)
+	lf := NewLogFollower(loginfo)
+	lf.SetFromStart(true)
+	lf.SetInterval(time.Hour)
+	lf.SetPollInterval(10 * time.Millisecond)
+	lf.SetWindow(5 * time.Minute)
+	done := make(chan error)
+	go func() { done <- lf.Follow(filename) }()
+	time.Sleep(100 * time.Millisecond)
+
+	// truncated and rewritten
+	if err = os.WriteFile(filename, []byte(fmt.Sprintf(line, 8, 20)), 0644); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(100 * time.Millisecond)
+	// rotated, with a line written to the old file after the last read
+	os.Rename(filename, filename+".1")
+	var file *os.File
+	if file, err = os.OpenFile(filename+".1", os.O_APPEND|os.O_WRONLY, 0644); err != nil {
+		t.Fatal(err)
+	}
+	file.WriteString(fmt.Sprintf(line, 9, 50))
+	file.Close()
+	if err = os.WriteFile(filename, []byte(fmt.Sprintf(line, 9, 300)), 0644); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(100 * time.Millisecond)
+	lf.Stop()
+	if err = <-done; err != nil {
+		t.Fatal(err)
+	}
+	if len(loginfo.OpPatterns) != 1 {
+		t.Fatal("expected 1 op pattern but got", len(loginfo.OpPatterns))
+	}
+	op := loginfo.OpPatterns[0]
+	if op.Count != 3 || op.MaxMilli != 300 {
+		t.Fatal("expected count 3 and max 300 but got", op.Count, op.MaxMilli)
+	}
+	if len(loginfo.SlowOps) != 3 || loginfo.SlowOps[2].Milli != 20 {
+		t.Fatal("expected 3 slow ops of the window but got", loginfo.SlowOps)
+	}
+	if len(loginfo.Histograms) != 2 {
+		t.Fatal("expected 2 histograms but got", len(loginfo.Histograms))
+	}
+}
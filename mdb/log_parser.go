@@ -9,8 +9,24 @@ import (
 	"strings"
 
 	"github.com/simagix/gox"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
+// metricRegexps are precompiled patterns of name:value metrics of text logs
+var metricRegexps = map[string]*regexp.Regexp{}
+
+var (
+	planCacheKeyRegexp = regexp.MustCompile(`planCacheKey:(\w+)`)
+	queryHashRegexp    = regexp.MustCompile(`queryHash:(\w+)`)
+)
+
+func init() {
+	for _, name := range []string{"docsExamined", "keysExamined", "nMatched", "ndeleted", "nreturned", "numYields"} {
+		metricRegexps[name] = regexp.MustCompile(` ` + name + `:(\d+)`)
+	}
+}
+
 var hasFilters = map[string]bool{"count": true, "delete": true, "find": true, "remove": true, "update": true, "aggregate": true, "getMore": true, "getmore": true, "findAndModify": true, "distinct": true}
 
 // ParseLog - parses text message before v4.4
@@ -60,7 +76,7 @@ func (li *LogInfo) ParseLog(str string) (LogStats, error) {
 	}
 
 	re := regexp.MustCompile(`^(\w+) ({.*})$`)
-	utc := result[1][:16] + `:00Z`
+	utc := getUTCMinute(result[1])
 	op := result[4]
 	ns := result[5]
 	if strings.HasPrefix(ns, "admin.") || strings.HasPrefix(ns, "config.") || strings.HasPrefix(ns, "local.") {
@@ -71,6 +87,7 @@ func (li *LogInfo) ParseLog(str string) (LogStats, error) {
 		// return stat, errors.New("system command")
 	}
 	filter := body[:epos]
+	command := "" // raw command or query document for the canonical shape
 	ms := result[7]
 	if op == "command" {
 		idx := strings.Index(filter, "command: ")
@@ -83,7 +100,16 @@ func (li *LogInfo) ParseLog(str string) (LogStats, error) {
 		}
 		op = res[1]
 		filter = res[2]
-	} else if op == "query" {
+		command = filter
+	} else if s := getDocByField(filter, "query: "); s != "" { // legacy query, update, and remove
+		command = "{ filter: " + s + " }"
+	}
+	if op == "getMore" || op == "getmore" {
+		if s := getDocByField(body, "originatingCommand: "); s != "" {
+			command = s
+		}
+	}
+	if op == "query" {
 		op = "find"
 	}
 
@@ -242,9 +268,188 @@ func (li *LogInfo) ParseLog(str string) (LogStats, error) {
 	}
 	stat = LogStats{filter: filter, index: index, milli: milli, ns: ns, op: op,
 		reslen: resLength, scan: scan, utc: utc}
+	stat.docsExamined = getMetricByName(str, "docsExamined")
+	stat.keysExamined = getMetricByName(str, "keysExamined")
+	stat.nreturned = getMetricByName(str, "nreturned") + getMetricByName(str, "nMatched") + getMetricByName(str, "ndeleted")
+	stat.numYields = getMetricByName(str, "numYields")
+	if m := queryHashRegexp.FindStringSubmatch(str); len(m) > 1 {
+		stat.queryHash = m[1]
+	}
+	if m := planCacheKeyRegexp.FindStringSubmatch(str); len(m) > 1 {
+		stat.planCacheKey = m[1]
+	}
+	if stat.queryHash == "" {
+		stat.shape = getTextCommandShape(op, command)
+	}
 	return stat, nil
 }
 
+// getTextCommandShape returns a canonical shape of a command of a text log, or empty if it can't be parsed
+func getTextCommandShape(op string, str string) string {
+	doc, err := parseShellDoc(str)
+	if err != nil || len(doc) == 0 {
+		return ""
+	}
+	if op == cmdGetMore || op == "getmore" { // originating command
+		op = doc[0].Key
+	}
+	return getCommandShape(op, doc)
+}
+
+// shellParser parses documents of text logs written in the mongo shell syntax
+type shellParser struct {
+	pos int
+	str string
+}
+
+// parseShellDoc parses a document of a text log, e.g. { a: 1, b: /^x/i, c: ObjectId('...') }.
+// Values other than documents, arrays, and regular expressions are kept as strings.
+func parseShellDoc(str string) (bson.D, error) {
+	p := &shellParser{str: str}
+	value, err := p.parseValue()
+	if err != nil {
+		return nil, err
+	}
+	doc, ok := value.(bson.D)
+	if !ok {
+		return nil, errors.New("not a document")
+	}
+	return doc, nil
+}
+
+func (p *shellParser) skipSpaces() {
+	for p.pos < len(p.str) && p.str[p.pos] == ' ' {
+		p.pos++
+	}
+}
+
+func (p *shellParser) parseValue() (interface{}, error) {
+	p.skipSpaces()
+	if p.pos >= len(p.str) {
+		return nil, errors.New("unexpected end of document")
+	}
+	switch p.str[p.pos] {
+	case '{':
+		return p.parseDoc()
+	case '[':
+		return p.parseArray()
+	case '/':
+		return p.parseRegex()
+	default:
+		return p.parseScalar()
+	}
+}
+
+func (p *shellParser) parseDoc() (bson.D, error) {
+	doc := bson.D{}
+	p.pos++ // {
+	for {
+		p.skipSpaces()
+		if p.pos >= len(p.str) {
+			return nil, errors.New("unexpected end of document")
+		} else if p.str[p.pos] == '}' {
+			p.pos++
+			return doc, nil
+		} else if p.str[p.pos] == ',' {
+			p.pos++
+			continue
+		}
+		i := strings.IndexByte(p.str[p.pos:], ':')
+		if i < 0 {
+			return nil, errors.New("no value of field found")
+		}
+		key := strings.Trim(strings.TrimSpace(p.str[p.pos:p.pos+i]), `"`)
+		p.pos += i + 1
+		value, err := p.parseValue()
+		if err != nil {
+			return nil, err
+		}
+		doc = append(doc, bson.E{Key: key, Value: value})
+	}
+}
+
+func (p *shellParser) parseArray() (bson.A, error) {
+	arr := bson.A{}
+	p.pos++ // [
+	for {
+		p.skipSpaces()
+		if p.pos >= len(p.str) {
+			return nil, errors.New("unexpected end of array")
+		} else if p.str[p.pos] == ']' {
+			p.pos++
+			return arr, nil
+		} else if p.str[p.pos] == ',' {
+			p.pos++
+			continue
+		}
+		value, err := p.parseValue()
+		if err != nil {
+			return nil, err
+		}
+		arr = append(arr, value)
+	}
+}
+
+func (p *shellParser) parseRegex() (primitive.Regex, error) {
+	start := p.pos + 1
+	for p.pos++; p.pos < len(p.str) && p.str[p.pos] != '/'; p.pos++ {
+		if p.str[p.pos] == '\\' {
+			p.pos++
+		}
+	}
+	if p.pos >= len(p.str) {
+		return primitive.Regex{}, errors.New("unterminated regular expression")
+	}
+	pattern := p.str[start:p.pos]
+	start = p.pos + 1
+	for p.pos++; p.pos < len(p.str) && p.str[p.pos] >= 'a' && p.str[p.pos] <= 'z'; p.pos++ {
+	}
+	return primitive.Regex{Pattern: pattern, Options: p.str[start:p.pos]}, nil
+}
+
+// parseScalar returns a value as a string, e.g. "abc", 1.0, or BinData(0, ...), up to the next delimiter
+func (p *shellParser) parseScalar() (string, error) {
+	start := p.pos
+	depth := 0
+	var quote byte
+	for ; p.pos < len(p.str); p.pos++ {
+		c := p.str[p.pos]
+		if quote != 0 {
+			if c == '\\' {
+				p.pos++
+			} else if c == quote {
+				quote = 0
+			}
+		} else if c == '"' || c == '\'' {
+			quote = c
+		} else if c == '(' {
+			depth++
+		} else if c == ')' {
+			depth--
+		} else if depth == 0 && (c == ',' || c == '}' || c == ']') {
+			break
+		}
+	}
+	value := strings.TrimSpace(p.str[start:p.pos])
+	if value == "" {
+		return "", errors.New("no value found")
+	}
+	return value, nil
+}
+
+// getMetricByName returns value of a name:value metric, e.g. docsExamined:100
+func getMetricByName(str string, name string) int {
+	re := metricRegexps[name]
+	if re == nil {
+		re = regexp.MustCompile(` ` + name + `:(\d+)`)
+	}
+	m := re.FindStringSubmatch(str)
+	if len(m) < 2 {
+		return 0
+	}
+	return ToInt(m[1])
+}
+
 func getDocByField(str string, key string) string {
 	ml := gox.NewMongoLog(str)
 	return ml.Get(key)
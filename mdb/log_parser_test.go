@@ -15,6 +15,22 @@ func TestParseLogFind(t *testing.T) {
 		t.Fatal(err)
 	} else if stat.filter != `{tveUserId:1}, sort: { updated: -1 }` {
 		t.Fatal(stat.filter)
+	} else if stat.shape != `{"tveUserId":1},sort:{"updated":1}` {
+		t.Fatal(stat.shape)
+	}
+}
+
+func TestParseShellDoc(t *testing.T) {
+	str := `{ status: "A, B", $or: [ { qty: { $lt: 30.0 } }, { item: /^p\/x/i } ], user: ObjectId('59154269cfe1f2d40943d7f5'), uid: BinData(0, 8AF9A6), "a.b": [ 1, 2 ] }`
+	doc, err := parseShellDoc(str)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if shape := getQueryShape(doc); shape != `{"status":1,"$or":[{"qty":{"$lt":1}},{"item":/^.../i}],"user":1,"uid":1,"a.b":[...]}` {
+		t.Fatal("unexpected shape", shape)
+	}
+	if _, err = parseShellDoc(`{ a: { b: 1 }`); err == nil {
+		t.Fatal("expected an error of a truncated document")
 	}
 }
 
@@ -30,6 +46,9 @@ func TestParseLogWrite(t *testing.T) {
 	if stat.filter != `{_id:1}` {
 		t.Fatal(stat.filter)
 	}
+	if stat.shape != `{"_id":1}` {
+		t.Fatal(stat.shape)
+	}
 	if stat.ns != `testDB.test2Application` {
 		t.Fatal(stat.ns)
 	}
@@ -0,0 +1,313 @@
+// Copyright 2020-present Kuei-chun Chen. All rights reserved.
+
+package mdb
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// session, routing, and cluster fields of a logged command not to replay
+var replayIgnoredFields = map[string]bool{"$audit": true, "$client": true, "$clusterTime": true,
+	"$configServerState": true, "$configTime": true, "$db": true, "$readPreference": true,
+	"$topologyTime": true, "autocommit": true, "clientOperationKey": true, "databaseVersion": true,
+	"lsid": true, "mayBypassWriteBlocking": true, "shardVersion": true, "startTransaction": true,
+	"txnNumber": true}
+
+// LogReplay re-issues find, aggregate, update, delete, and insert commands of logv2
+// slow query logs against a cluster, preserving relative timing
+type LogReplay struct {
+	Shapes  []ReplayShape `bson:"shapes"`
+	Skipped int           `bson:"skipped"`
+
+	client *mongo.Client
+	conns  int
+	ops    []replayOp
+	speed  float64
+}
+
+// ReplayShape stores original and replayed latencies in milliseconds of a query shape
+type ReplayShape struct {
+	Command   string        `bson:"command"`
+	Count     int           `bson:"count"`
+	Errors    int           `bson:"errors"`
+	Namespace string        `bson:"ns"`
+	Original  LatencySketch `bson:"original"`
+	Replayed  LatencySketch `bson:"replayed"`
+	Shape     string        `bson:"shape"`
+}
+
+// replayOp is a logged command to replay
+type replayOp struct {
+	command bson.D
+	db      string
+	milli   int
+	ns      string
+	op      string
+	shape   string
+	ts      time.Time
+}
+
+// logv2Replay stores fields of a logv2 line to replay, with fields order preserved
+type logv2Replay struct {
+	Attributes struct {
+		Command bson.D `bson:"command"`
+		Milli   int    `bson:"durationMillis"`
+		NS      string `bson:"ns"`
+		Type    string `bson:"type"`
+	} `bson:"attr"`
+	Component string    `bson:"c"`
+	Timestamp time.Time `bson:"t"`
+}
+
+// NewLogReplay returns *LogReplay
+func NewLogReplay(client *mongo.Client) *LogReplay {
+	return &LogReplay{client: client, conns: runtime.NumCPU(), speed: 1}
+}
+
+// SetConcurrency sets number of concurrent connections
+func (r *LogReplay) SetConcurrency(conns int) {
+	if conns > 0 {
+		r.conns = conns
+	}
+}
+
+// SetSpeed sets the speed-up factor, e.g. 2 replays twice as fast, 0 without delays
+func (r *LogReplay) SetSpeed(speed float64) {
+	r.speed = speed
+}
+
+// ReadSource reads commands to replay from a log source
+func (r *LogReplay) ReadSource(source LogSource) error {
+	var err error
+	var reader *bufio.Reader
+	if reader, err = source.Open(); err != nil {
+		return err
+	}
+	for {
+		str, rerr := reader.ReadString('\n')
+		if str = strings.TrimSpace(str); len(str) > 0 && str[0] == '{' {
+			if op, perr := parseReplayOp(str); perr == nil {
+				r.ops = append(r.ops, op)
+			} else if strings.Contains(str, "durationMillis") {
+				r.Skipped++
+			}
+		}
+		if rerr != nil {
+			break
+		}
+	}
+	sort.SliceStable(r.ops, func(i int, j int) bool {
+		return r.ops[i].ts.Before(r.ops[j].ts)
+	})
+	if len(r.ops) == 0 {
+		return errors.New("no replayable commands found")
+	}
+	return nil
+}
+
+// parseReplayOp returns a command to replay from a logv2 line
+func parseReplayOp(str string) (replayOp, error) {
+	var err error
+	var doc logv2Replay
+	var op replayOp
+	if err = bson.UnmarshalExtJSON([]byte(str), false, &doc); err != nil {
+		return op, err
+	}
+	attr := doc.Attributes
+	if len(attr.Command) == 0 || attr.NS == "" {
+		return op, errors.New("no command found")
+	}
+	db, coll := SplitNamespace(attr.NS)
+	op.db, op.milli, op.ns, op.ts = db, attr.Milli, attr.NS, doc.Timestamp
+	if doc.Component == "WRITE" { // a statement of an update or a delete command before v5.0
+		if attr.Type == cmdUpdate {
+			attr.Command = bson.D{{Key: cmdUpdate, Value: coll}, {Key: "updates", Value: bson.A{attr.Command}}}
+		} else if attr.Type == cmdRemove {
+			attr.Command = bson.D{{Key: cmdDelete, Value: coll}, {Key: "deletes", Value: bson.A{attr.Command}}}
+		} else {
+			return op, errors.New("unsupported write " + attr.Type)
+		}
+	} else if doc.Component != "COMMAND" {
+		return op, errors.New("unsupported component " + doc.Component)
+	}
+	op.op = attr.Command[0].Key
+	for _, e := range attr.Command {
+		if e.Key == "$db" {
+			op.db, _ = e.Value.(string)
+		} else if !replayIgnoredFields[e.Key] {
+			op.command = append(op.command, e)
+		}
+	}
+	m := op.command.Map()
+	switch op.op {
+	case cmdAggregate, cmdFind:
+		op.shape = getCommandShape(op.op, op.command)
+	case cmdDelete, cmdUpdate:
+		if statements, ok := m[op.op+"s"].(bson.A); ok && len(statements) > 0 {
+			if statement, ok := statements[0].(bson.D); ok {
+				op.shape = getCommandShape(op.op, statement)
+			}
+		}
+	case cmdInsert:
+		if m["documents"] == nil { // not logged
+			return op, errors.New("no documents logged")
+		}
+		op.shape = "N/A"
+	default:
+		return op, errors.New("unsupported command " + op.op)
+	}
+	if rc, ok := m["readConcern"].(bson.D); ok { // cluster times of the source cluster
+		level := bson.D{}
+		for _, e := range rc {
+			if e.Key == "level" {
+				level = append(level, e)
+			}
+		}
+		for i := range op.command {
+			if op.command[i].Key == "readConcern" {
+				op.command[i].Value = level
+			}
+		}
+	}
+	return op, nil
+}
+
+// getDelay returns the delay of an operation from the beginning of a replay
+func (r *LogReplay) getDelay(op replayOp) time.Duration {
+	if r.speed <= 0 || len(r.ops) == 0 {
+		return 0
+	}
+	return time.Duration(float64(op.ts.Sub(r.ops[0].ts)) / r.speed)
+}
+
+// Replay re-issues commands with relative timing and concurrency
+func (r *LogReplay) Replay() error {
+	shapes := map[string]*ReplayShape{}
+	var mutex sync.Mutex
+	var wg sync.WaitGroup
+	queue := make(chan replayOp, r.conns)
+	for i := 0; i < r.conns; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for op := range queue {
+				milli, err := r.execute(op)
+				mutex.Lock()
+				r.record(shapes, op, milli, err)
+				mutex.Unlock()
+			}
+		}()
+	}
+	begin := time.Now()
+	for i, op := range r.ops {
+		if d := r.getDelay(op) - time.Since(begin); d > 0 {
+			time.Sleep(d)
+		}
+		queue <- op
+		if (i+1)%1000 == 0 {
+			fmt.Printf("\r%d of %d commands replayed", i+1, len(r.ops))
+		}
+	}
+	close(queue)
+	wg.Wait()
+	fmt.Printf("\r%d commands replayed in %v\n", len(r.ops), time.Since(begin).Round(time.Millisecond))
+	r.setShapes(shapes)
+	return nil
+}
+
+// execute runs a command and kills its cursor, returns milliseconds
+func (r *LogReplay) execute(op replayOp) (int, error) {
+	ctx := context.Background()
+	db := r.client.Database(op.db)
+	var doc struct {
+		Cursor struct {
+			ID int64  `bson:"id"`
+			NS string `bson:"ns"`
+		} `bson:"cursor"`
+	}
+	t := time.Now()
+	err := db.RunCommand(ctx, op.command).Decode(&doc)
+	milli := int(time.Since(t).Milliseconds())
+	if err == nil && doc.Cursor.ID != 0 {
+		_, coll := SplitNamespace(doc.Cursor.NS)
+		cmd := bson.D{{Key: "killCursors", Value: coll}, {Key: "cursors", Value: bson.A{doc.Cursor.ID}}}
+		db.RunCommand(ctx, cmd)
+	}
+	return milli, err
+}
+
+// record records latencies of a replayed command by shapes
+func (r *LogReplay) record(shapes map[string]*ReplayShape, op replayOp, milli int, err error) {
+	key := getOpPatternKey(op.op, op.ns, op.shape, "")
+	shape := shapes[key]
+	if shape == nil {
+		shape = &ReplayShape{Command: op.op, Namespace: op.ns, Shape: op.shape}
+		shapes[key] = shape
+	}
+	shape.Count++
+	shape.Original.Add(op.milli)
+	if err != nil {
+		shape.Errors++
+		return
+	}
+	shape.Replayed.Add(milli)
+}
+
+// setShapes sorts shapes by estimated original total milliseconds
+func (r *LogReplay) setShapes(shapes map[string]*ReplayShape) {
+	r.Shapes = []ReplayShape{}
+	for _, shape := range shapes {
+		r.Shapes = append(r.Shapes, *shape)
+	}
+	sort.Slice(r.Shapes, func(i int, j int) bool {
+		x, y := r.Shapes[i], r.Shapes[j]
+		return x.Count*x.Original.Percentile(50) > y.Count*y.Original.Percentile(50)
+	})
+}
+
+// Print prints replay summary
+func (r *LogReplay) Print() {
+	fmt.Println(r.printReplaySummary())
+}
+
+// printReplaySummary returns original and replayed latencies by query shapes
+func (r *LogReplay) printReplaySummary() string {
+	var buffer bytes.Buffer
+	buffer.WriteString(fmt.Sprintf("\nReplayed %d shapes, %d log lines skipped\n", len(r.Shapes), r.Skipped))
+	buffer.WriteString("+---------+-------+-------+--------+--------+--------+--------+-------+--------------------------------------------------+\n")
+	buffer.WriteString("| Command | Count | Errors| Orig50 | Orig95 | Rply50 | Rply95 | Ratio | Namespace / Query Shape                          |\n")
+	buffer.WriteString("|---------+-------+-------+--------+--------+--------+--------+-------+--------------------------------------------------|\n")
+	for _, shape := range r.Shapes {
+		orig, rply := shape.Original.Percentile(95), shape.Replayed.Percentile(95)
+		ratio := "-"
+		if shape.Replayed.Total() > 0 {
+			ratio = fmt.Sprintf("%.2f", float64(rply)/math.Max(float64(orig), 1))
+		}
+		command := shape.Command
+		if len(command) > 7 {
+			command = command[:7]
+		}
+		label := shape.Namespace + " " + shape.Shape
+		if len(label) > 48 {
+			label = label[:45] + "..."
+		}
+		buffer.WriteString(fmt.Sprintf("| %-7v | %5d | %5d | %6d | %6d | %6d | %6d | %5v | %-48v |\n", command, shape.Count,
+			shape.Errors, shape.Original.Percentile(50), orig, shape.Replayed.Percentile(50), rply, ratio, label))
+	}
+	buffer.WriteString("+---------+-------+-------+--------+--------+--------+--------+-------+--------------------------------------------------+\n")
+	buffer.WriteString("latencies in milliseconds, ratio: replayed p95 / original p95\n")
+	return buffer.String()
+}
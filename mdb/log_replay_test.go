@@ -0,0 +1,70 @@
+// Copyright 2020-present Kuei-chun Chen. All rights reserved.
+
+package mdb
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestParseReplayOp(t *testing.T) {
+	str := `{"t":{"$date":"2020-09-28T11:13:09.234+00:00"},"s":"I","c":"COMMAND","id":51803,"ctx":"conn4479","msg":"Slow query","attr":{"type":"command","ns":"keyhole.cars","command":{"find":"cars","filter":{"color":"red","year":{"$gt":2010}},"sort":{"year":-1},"readConcern":{"level":"majority","afterClusterTime":{"$timestamp":{"t":1601291589,"i":3}}},"lsid":{"id":{"$uuid":"fed35edb-a198-41d9-89f2-133141aa2e25"}},"$clusterTime":{"clusterTime":{"$timestamp":{"t":1601291589,"i":3}}},"$db":"keyhole"},"planSummary":"COLLSCAN","durationMillis":151}}`
+	op, err := parseReplayOp(str)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if op.db != "keyhole" || op.op != cmdFind || op.milli != 151 || op.shape != `{"color":1,"year":{"$gt":1}},sort:{"year":1}` {
+		t.Fatal("unexpected op", op.db, op.op, op.milli, op.shape)
+	}
+	m := op.command.Map()
+	if m["lsid"] != nil || m["$clusterTime"] != nil || m["$db"] != nil {
+		t.Fatal("expected session fields removed", op.command)
+	}
+	if rc := m["readConcern"].(bson.D); len(rc) != 1 || rc[0].Key != "level" {
+		t.Fatal("expected readConcern level only", rc)
+	}
+
+	str = `{"t":{"$date":"2020-11-05T09:30:50.680+00:00"},"s":"I","c":"WRITE","id":51803,"ctx":"conn851","msg":"Slow query","attr":{"type":"update","ns":"testcase.samplecollection","command":{"q":{"_id":1},"u":{"$set":{"a":1}},"multi":true,"upsert":false},"durationMillis":234}}`
+	if op, err = parseReplayOp(str); err != nil {
+		t.Fatal(err)
+	}
+	if op.op != cmdUpdate || op.command[0].Value != "samplecollection" || op.shape != `{"_id":1}` {
+		t.Fatal("unexpected update", op.command, op.shape)
+	}
+
+	str = `{"t":{"$date":"2020-11-05T09:30:50.680+00:00"},"s":"I","c":"COMMAND","id":51803,"ctx":"conn1","msg":"Slow query","attr":{"type":"command","ns":"keyhole.cars","command":{"insert":"cars","ordered":true,"$db":"keyhole"},"ninserted":1,"durationMillis":120}}`
+	if _, err = parseReplayOp(str); err == nil {
+		t.Fatal("expected error of inserts without documents")
+	}
+}
+
+func TestLogReplayShapes(t *testing.T) {
+	r := NewLogReplay(nil)
+	r.SetSpeed(2)
+	begin := time.Now()
+	shapes := map[string]*ReplayShape{}
+	for i := 0; i < 10; i++ {
+		op := replayOp{milli: 100, ns: "keyhole.cars", op: cmdFind, shape: `{"color":1}`, ts: begin.Add(time.Duration(i) * time.Second)}
+		r.ops = append(r.ops, op)
+		var err error
+		if i == 0 {
+			err = errors.New("ns not found")
+		}
+		r.record(shapes, op, 50, err)
+	}
+	r.record(shapes, replayOp{milli: 10, ns: "keyhole.cars", op: cmdAggregate, shape: "[]"}, 20, nil)
+	if d := r.getDelay(r.ops[9]); d != 4500*time.Millisecond {
+		t.Fatal("expected 4.5 seconds delay, but got", d)
+	}
+	r.setShapes(shapes)
+	if len(r.Shapes) != 2 || r.Shapes[0].Command != cmdFind || r.Shapes[0].Count != 10 || r.Shapes[0].Errors != 1 {
+		t.Fatal("unexpected shapes", r.Shapes)
+	}
+	if str := r.printReplaySummary(); !strings.Contains(str, "0.50") {
+		t.Fatal("expected ratio of 0.50", str)
+	}
+}
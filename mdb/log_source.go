@@ -0,0 +1,368 @@
+// Copyright 2020-present Kuei-chun Chen. All rights reserved.
+
+package mdb
+
+import (
+	"archive/tar"
+	"bufio"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/simagix/gox"
+)
+
+// LogSource provides log lines from a file, a directory, a bundle, stdin, or an HTTP endpoint
+type LogSource interface {
+	Close() error
+	Name() string
+	Open() (*bufio.Reader, error)
+}
+
+// NewLogSource returns a LogSource by name, - for stdin
+func NewLogSource(name string) (LogSource, error) {
+	if name == "-" {
+		return &StdinSource{}, nil
+	} else if strings.HasPrefix(name, "http://") || strings.HasPrefix(name, "https://") {
+		return &HTTPSource{url: name}, nil
+	} else if isTarFile(name) {
+		return &TarSource{filename: name}, nil
+	}
+	fi, err := os.Stat(name)
+	if err != nil {
+		return nil, err
+	}
+	if fi.IsDir() {
+		return &DirSource{dir: name}, nil
+	}
+	return &FileSource{filename: name}, nil
+}
+
+// isTarFile returns true if a file is a tar or a gzipped tar file
+func isTarFile(name string) bool {
+	return strings.HasSuffix(name, ".tar") || strings.HasSuffix(name, ".tar.gz") || strings.HasSuffix(name, ".tgz")
+}
+
+// isLogFile returns true if a file is a log file or a rotated log file, e.g. mongod.log.2021-06-01T00-00-00,
+// but not an audit log
+func isLogFile(name string) bool {
+	base := filepath.Base(name)
+	if strings.Contains(strings.ToLower(base), "audit") {
+		return false
+	}
+	return strings.HasSuffix(base, ".log") || strings.Contains(base, ".log.")
+}
+
+// FileSource reads a plain, gzipped, or snappy compressed file
+type FileSource struct {
+	file     *os.File
+	filename string
+}
+
+// Close closes the file
+func (s *FileSource) Close() error {
+	if s.file == nil {
+		return nil
+	}
+	err := s.file.Close()
+	s.file = nil
+	return err
+}
+
+// Name returns the file name
+func (s *FileSource) Name() string {
+	return s.filename
+}
+
+// Open opens, or reopens, the file
+func (s *FileSource) Open() (*bufio.Reader, error) {
+	var err error
+	s.Close()
+	if s.file, err = os.Open(s.filename); err != nil {
+		return nil, err
+	}
+	return gox.NewReader(s.file)
+}
+
+// DirSource reads rotated log files of a directory in timestamp order
+type DirSource struct {
+	dir   string
+	files []*os.File
+}
+
+// Close closes all files
+func (s *DirSource) Close() error {
+	var err error
+	for _, file := range s.files {
+		if e := file.Close(); e != nil {
+			err = e
+		}
+	}
+	s.files = nil
+	return err
+}
+
+// Name returns the directory name
+func (s *DirSource) Name() string {
+	return s.dir
+}
+
+// Open returns a reader of all log files, ordered by the timestamps of their first lines
+func (s *DirSource) Open() (*bufio.Reader, error) {
+	var err error
+	var filenames []string
+	s.Close()
+	if filenames, err = GetLogFilenames(s.dir); err != nil {
+		return nil, err
+	} else if len(filenames) == 0 {
+		return nil, fmt.Errorf("no log file found in %v", s.dir)
+	}
+	readers := []io.Reader{}
+	for _, filename := range filenames {
+		var file *os.File
+		var reader *bufio.Reader
+		if file, err = os.Open(filename); err != nil {
+			return nil, err
+		}
+		s.files = append(s.files, file)
+		if reader, err = gox.NewReader(file); err != nil && err != io.EOF { // io.EOF if less than 10 bytes
+			return nil, err
+		}
+		readers = append(readers, reader, strings.NewReader("\n"))
+	}
+	return bufio.NewReader(io.MultiReader(readers...)), nil
+}
+
+// GetLogFilenames returns log files of a directory, ordered by the timestamps of their first lines
+func GetLogFilenames(dir string) ([]string, error) {
+	var filenames []string
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() && isLogFile(path) {
+			filenames = append(filenames, path)
+		}
+		return nil
+	})
+	if err != nil {
+		return filenames, err
+	}
+	timestamps := map[string]time.Time{}
+	for _, filename := range filenames {
+		timestamps[filename] = getFirstTimestamp(filename)
+	}
+	sort.Slice(filenames, func(i, j int) bool {
+		x, y := timestamps[filenames[i]], timestamps[filenames[j]]
+		if x.Equal(y) {
+			return filenames[i] < filenames[j]
+		}
+		return x.Before(y)
+	})
+	return filenames, nil
+}
+
+// getFirstTimestamp returns the timestamp of the first line of a log file
+func getFirstTimestamp(filename string) time.Time {
+	var ts time.Time
+	reader, err := gox.NewFileReader(filename)
+	if err != nil {
+		return ts
+	}
+	str, _ := reader.ReadString('\n')
+	var doc struct {
+		Timestamp map[string]string `json:"t"`
+	}
+	if strings.HasPrefix(str, "{") && json.Unmarshal([]byte(str), &doc) == nil {
+		str = doc.Timestamp["$date"]
+	} else if fields := strings.Fields(str); len(fields) > 0 {
+		str = fields[0]
+	}
+	for _, layout := range []string{time.RFC3339, "2006-01-02T15:04:05.000-0700"} {
+		if ts, err = time.Parse(layout, str); err == nil {
+			return ts
+		}
+	}
+	return ts
+}
+
+// TarSource reads log files of a tar or a gzipped tar bundle in timestamp order
+type TarSource struct {
+	filename string
+	source   *DirSource
+	tmpdir   string
+}
+
+// Close closes files and removes the extracted files
+func (s *TarSource) Close() error {
+	if s.source != nil {
+		s.source.Close()
+	}
+	if s.tmpdir != "" {
+		return os.RemoveAll(s.tmpdir)
+	}
+	return nil
+}
+
+// Name returns the bundle name without extensions
+func (s *TarSource) Name() string {
+	name := strings.TrimSuffix(s.filename, ".gz")
+	name = strings.TrimSuffix(strings.TrimSuffix(name, ".tgz"), ".tar")
+	return name
+}
+
+// Open extracts log files to a temporary directory, once, and returns a reader of all log files
+func (s *TarSource) Open() (*bufio.Reader, error) {
+	var err error
+	if s.source == nil {
+		if s.tmpdir, err = os.MkdirTemp("", "keyhole-"); err != nil {
+			return nil, err
+		}
+		if err = s.extract(); err != nil {
+			return nil, err
+		}
+		s.source = &DirSource{dir: s.tmpdir}
+	}
+	return s.source.Open()
+}
+
+// extract extracts log files, flattening paths
+func (s *TarSource) extract() error {
+	var err error
+	var reader *bufio.Reader
+	if reader, err = gox.NewFileReader(s.filename); err != nil {
+		return err
+	}
+	tr := tar.NewReader(reader)
+	for {
+		var header *tar.Header
+		if header, err = tr.Next(); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		if header.Typeflag != tar.TypeReg || !isLogFile(header.Name) {
+			continue
+		}
+		name := strings.ReplaceAll(filepath.Clean(header.Name), string(filepath.Separator), "_")
+		var file *os.File
+		if file, err = os.Create(filepath.Join(s.tmpdir, name)); err != nil {
+			return err
+		}
+		_, err = io.Copy(file, tr)
+		file.Close()
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// StdinSource reads plain or gzipped logs from stdin, can be opened only once
+type StdinSource struct {
+	opened bool
+}
+
+// Close is a no-op
+func (s *StdinSource) Close() error {
+	return nil
+}
+
+// Name returns stdin
+func (s *StdinSource) Name() string {
+	return "stdin"
+}
+
+// Open returns a reader of stdin
+func (s *StdinSource) Open() (*bufio.Reader, error) {
+	if s.opened {
+		return nil, fmt.Errorf("stdin can be read only once")
+	}
+	s.opened = true
+	reader := bufio.NewReader(os.Stdin)
+	if buf, err := reader.Peek(2); err == nil && buf[0] == 31 && buf[1] == 139 {
+		zreader, err := gzip.NewReader(reader)
+		if err != nil {
+			return nil, err
+		}
+		return bufio.NewReader(zreader), nil
+	}
+	return reader, nil
+}
+
+// logHTTPClient downloads logs, with timeouts of connecting and waiting for responses, and of a download
+var logHTTPClient = &http.Client{
+	Timeout: 30 * time.Minute,
+	Transport: &http.Transport{
+		DialContext:           (&net.Dialer{Timeout: 30 * time.Second}).DialContext,
+		Proxy:                 http.ProxyFromEnvironment,
+		ResponseHeaderTimeout: time.Minute,
+		TLSHandshakeTimeout:   30 * time.Second,
+	},
+}
+
+// HTTPSource downloads a log file, a gzipped log file, or a bundle from an HTTP endpoint
+type HTTPSource struct {
+	source LogSource
+	tmpdir string
+	url    string
+}
+
+// Close closes the downloaded source and removes it
+func (s *HTTPSource) Close() error {
+	if s.source != nil {
+		s.source.Close()
+	}
+	if s.tmpdir != "" {
+		return os.RemoveAll(s.tmpdir)
+	}
+	return nil
+}
+
+// Name returns the base name of the url path
+func (s *HTTPSource) Name() string {
+	if u, err := url.Parse(s.url); err == nil && filepath.Base(u.Path) != "/" && filepath.Base(u.Path) != "." {
+		return filepath.Base(u.Path)
+	}
+	return "http"
+}
+
+// Open downloads, once, and returns a reader of the downloaded source
+func (s *HTTPSource) Open() (*bufio.Reader, error) {
+	var err error
+	if s.source == nil {
+		var resp *http.Response
+		if resp, err = logHTTPClient.Get(s.url); err != nil {
+			return nil, err
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("%v: %v", s.url, resp.Status)
+		}
+		if s.tmpdir, err = os.MkdirTemp("", "keyhole-"); err != nil {
+			return nil, err
+		}
+		filename := filepath.Join(s.tmpdir, s.Name())
+		var file *os.File
+		if file, err = os.Create(filename); err != nil {
+			return nil, err
+		}
+		_, err = io.Copy(file, resp.Body)
+		file.Close()
+		if err != nil {
+			return nil, err
+		}
+		if s.source, err = NewLogSource(filename); err != nil {
+			return nil, err
+		}
+	}
+	return s.source.Open()
+}
@@ -0,0 +1,100 @@
+// Copyright 2020-present Kuei-chun Chen. All rights reserved.
+
+package mdb
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+const logSourceLine = `{"t":{"$date":"2021-06-01T%02d:00:00.000+00:00"},"s":"I","c":"COMMAND","id":51803,"ctx":"conn1","msg":"Slow query","attr":{"type":"command","ns":"keyhole.cars","command":{"find":"cars","filter":{"color":"red"}},"planSummary":"COLLSCAN","reslen":100,"durationMillis":%d}}`
+
+func TestDirSource(t *testing.T) {
+	dir := t.TempDir()
+	// rotated file names don't sort by time
+	files := map[string]int{"mongod.log": 12, "mongod.log.b": 10, "mongod.log.a": 11, "metrics.2021-06-01": 9,
+		"mongodb-audit.log": 11, "node2/mongod.log": 11} // logs of another host overlap
+	os.Mkdir(filepath.Join(dir, "node2"), 0755)
+	for name, hour := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(fmt.Sprintf(logSourceLine, hour, hour)), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	filenames, err := GetLogFilenames(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{"mongod.log.b", "mongod.log.a", "node2/mongod.log", "mongod.log"}
+	if len(filenames) != len(expected) {
+		t.Fatal("expected", expected, "but got", filenames)
+	}
+	for i, name := range expected {
+		if filenames[i] != filepath.Join(dir, name) {
+			t.Fatal("expected", expected, "but got", filenames)
+		}
+	}
+	loginfo := NewLogInfo("utest-xxxxxx")
+	loginfo.SetSilent(true)
+	if err = loginfo.AnalyzeFile(dir); err != nil {
+		t.Fatal(err)
+	}
+	if len(loginfo.OpPatterns) != 1 || loginfo.OpPatterns[0].Count != 4 || len(loginfo.Histograms) != 3 ||
+		loginfo.Histograms[1].Ops["find"] != 2 {
+		t.Fatal("expected 4 ops in 3 minutes but got", loginfo.OpPatterns, loginfo.Histograms)
+	}
+}
+
+func TestGetUTCMinute(t *testing.T) {
+	for date, expected := range map[string]string{"2021-06-01T12:00:30.000-0400": "2021-06-01T16:00:00Z",
+		"2021-06-01T12:00:30.000+00:00": "2021-06-01T12:00:00Z", "2021-06-01T12:00:30.000Z": "2021-06-01T12:00:00Z"} {
+		if utc := getUTCMinute(date); utc != expected {
+			t.Fatal("expected", expected, "but got", utc)
+		}
+	}
+}
+
+func TestTarAndHTTPSource(t *testing.T) {
+	var buffer bytes.Buffer
+	zw := gzip.NewWriter(&buffer)
+	tw := tar.NewWriter(zw)
+	for i, name := range []string{"bundle/node1/mongod.log", "bundle/node1/diagnostic.data/metrics.1", "bundle/node2/mongod.log"} {
+		data := []byte(fmt.Sprintf(logSourceLine, 10+i, 100+i))
+		tw.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: int64(len(data)), Typeflag: tar.TypeReg})
+		tw.Write(data)
+	}
+	tw.Close()
+	zw.Close()
+	filename := filepath.Join(t.TempDir(), "bundle.tar.gz")
+	if err := os.WriteFile(filename, buffer.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+	loginfo := NewLogInfo("utest-xxxxxx")
+	loginfo.SetSilent(true)
+	if err := loginfo.AnalyzeFile(filename); err != nil {
+		t.Fatal(err)
+	}
+	if len(loginfo.OpPatterns) != 1 || loginfo.OpPatterns[0].Count != 2 {
+		t.Fatal("expected 2 ops but got", loginfo.OpPatterns)
+	}
+
+	server := httptest.NewServer(http.FileServer(http.Dir(filepath.Dir(filename))))
+	defer server.Close()
+	loginfo = NewLogInfo("utest-xxxxxx")
+	loginfo.SetSilent(true)
+	if err := loginfo.AnalyzeFile(server.URL + "/bundle.tar.gz"); err != nil {
+		t.Fatal(err)
+	}
+	if len(loginfo.OpPatterns) != 1 || loginfo.OpPatterns[0].Count != 2 {
+		t.Fatal("expected 2 ops but got", loginfo.OpPatterns)
+	}
+	if err := loginfo.AnalyzeFile(server.URL + "/missing.log"); err == nil {
+		t.Fatal("expected 404 error")
+	}
+}
@@ -5,6 +5,7 @@ package mdb
 import (
 	"bufio"
 	"bytes"
+	"errors"
 	"fmt"
 	"io"
 	"os"
@@ -12,6 +13,7 @@ import (
 	"regexp"
 	"sort"
 	"strings"
+	"time"
 
 	"go.mongodb.org/mongo-driver/bson"
 
@@ -25,6 +27,7 @@ const COLLSCAN = "COLLSCAN"
 type LogInfo struct {
 	Collscan   bool        `bson:"collscan"`
 	DBVersion  string      `bson:"version"`
+	Events     LogEvents   `bson:"events"`
 	Histograms []Histogram `bson:"histogram"`
 	Logger     *gox.Logger `bson:"keyhole"`
 	LogType    string      `bson:"type"`
@@ -34,24 +37,62 @@ type LogInfo struct {
 	SlowOps    []RawLog    `bson:"slowOps"`
 
 	filename string
+	format   string
+	from     time.Time
 	logs     []string
 	regex    string
 	regexp   *regexp.Regexp
 	silent   bool
+	to       time.Time
 	verbose  bool
 }
 
 // OpPattern stores performance data
 type OpPattern struct {
-	Command     string `bson:"command"`     // count, delete, find, remove, and update
-	Count       int    `bson:"count"`       // number of ops
-	Filter      string `bson:"filter"`      // query pattern
-	MaxMilli    int    `bson:"maxmilli"`    // max millisecond
-	Namespace   string `bson:"ns"`          // database.collectin
-	Scan        string `bson:"scan"`        // COLLSCAN
-	TotalMilli  int64  `bson:"totalmilli"`  // total milliseconds
-	TotalReslen int64  `bson:"totalreslen"` // total reslen
-	Index       string `bson:"index"`       // index used
+	Command     string        `bson:"command"`     // count, delete, find, remove, and update
+	Count       int           `bson:"count"`       // number of ops
+	Filter      string        `bson:"filter"`      // query pattern
+	MaxMilli    int           `bson:"maxmilli"`    // max millisecond
+	Namespace   string        `bson:"ns"`          // database.collectin
+	Scan        string        `bson:"scan"`        // COLLSCAN
+	TotalMilli  int64         `bson:"totalmilli"`  // total milliseconds
+	TotalReslen int64         `bson:"totalreslen"` // total reslen
+	Index       string        `bson:"index"`       // index used
+	Latency     LatencySketch `bson:"latency"`     // latency distribution
+
+	PlanCacheKey           string `bson:"planCacheKey"`           // latest planCacheKey
+	QueryHash              string `bson:"queryHash"`              // queryHash or planCacheShapeHash
+	Shape                  string `bson:"shape"`                  // canonical shape if no queryHash
+	Sort                   string `bson:"sort,omitempty"`         // sort with directions
+	TotalBytesRead         int64  `bson:"totalbytesread"`         // total storage bytes read
+	TotalDocsExamined      int64  `bson:"totaldocsexamined"`      // total docsExamined
+	TotalKeysExamined      int64  `bson:"totalkeysexamined"`      // total keysExamined
+	TotalLockWaitMicros    int64  `bson:"totallockwaitmicros"`    // total lock acquisition wait
+	TotalReturned          int64  `bson:"totalreturned"`          // total nreturned, nMatched, or ndeleted
+	TotalStorageWaitMicros int64  `bson:"totalstoragewaitmicros"` // total storage reading time
+	TotalYields            int64  `bson:"totalyields"`            // total numYields
+}
+
+// ScanRatio returns ratio of examined docs, or keys if no docs examined, to returned docs
+func (op OpPattern) ScanRatio() float64 {
+	examined := op.TotalDocsExamined
+	if examined == 0 {
+		examined = op.TotalKeysExamined
+	}
+	returned := op.TotalReturned
+	if returned == 0 {
+		returned = 1
+	}
+	return float64(examined) / float64(returned)
+}
+
+// Percentile returns estimated milliseconds of a percentile, from 0 to 100
+func (op OpPattern) Percentile(p float64) int {
+	milli := op.Latency.Percentile(p)
+	if milli > op.MaxMilli {
+		return op.MaxMilli
+	}
+	return milli
 }
 
 // RawLog holds slow ops log and time
@@ -70,6 +111,18 @@ type LogStats struct {
 	reslen int
 	scan   string
 	utc    string
+
+	bytesRead         int64
+	docsExamined      int
+	keysExamined      int
+	lockWaitMicros    int64
+	nreturned         int
+	numYields         int
+	planCacheKey      string
+	queryHash         string
+	shape             string
+	sort              string
+	storageWaitMicros int64
 }
 
 // Histogram stores ops info
@@ -93,6 +146,11 @@ func (li *LogInfo) SetCollscan(collscan bool) {
 	li.Collscan = collscan
 }
 
+// SetFormat sets output format, json, csv, prom, or html
+func (li *LogInfo) SetFormat(format string) {
+	li.format = format
+}
+
 // SetRedaction sets redaction
 func (li *LogInfo) SetRedaction(redaction bool) {
 	li.Redaction = redaction
@@ -108,6 +166,12 @@ func (li *LogInfo) SetVerbose(verbose bool) {
 	li.verbose = verbose
 }
 
+// SetTimeRange sets time bounds, either can be zero
+func (li *LogInfo) SetTimeRange(from time.Time, to time.Time) {
+	li.from = from
+	li.to = to
+}
+
 // SetRegexPattern sets Regex patthen
 func (li *LogInfo) SetRegexPattern(regex string) {
 	if regex != "" {
@@ -128,6 +192,9 @@ func (li *LogInfo) AnalyzeFile(filename string) error {
 		var data []byte
 		var err error
 		var fd *bufio.Reader
+		if !li.from.IsZero() || !li.to.IsZero() { // histograms and patterns are already aggregated
+			return fmt.Errorf("-from and -to are not supported with %v files, analyze log files instead", logExt)
+		}
 		if fd, err = gox.NewFileReader(filename); err != nil {
 			return err
 		}
@@ -138,30 +205,33 @@ func (li *LogInfo) AnalyzeFile(filename string) error {
 			return err
 		}
 	} else {
-		li.LogType = ""
-		var file *os.File
-		var reader *bufio.Reader
-		li.filename = filename
-		if file, err = os.Open(filename); err != nil {
-			return err
-		}
-		defer file.Close()
-		if reader, err = gox.NewReader(file); err != nil {
-			return err
-		}
-		var lineCounts int
-		if !li.silent {
-			lineCounts, _ = gox.CountLines(reader)
-		}
-		file.Seek(0, 0)
-		if reader, err = gox.NewReader(file); err != nil {
+		var source LogSource
+		if source, err = NewLogSource(filename); err != nil {
 			return err
 		}
-		if err = li.Parse(reader, lineCounts); err != nil {
+		defer source.Close()
+		return li.AnalyzeSource(source)
+	}
+	return nil
+}
+
+// AnalyzeSource analyze logs from a source
+func (li *LogInfo) AnalyzeSource(source LogSource) error {
+	var err error
+	var reader *bufio.Reader
+	li.LogType = ""
+	li.filename = source.Name()
+	var lineCounts int
+	if _, ok := source.(*StdinSource); !ok && !li.silent {
+		if reader, err = source.Open(); err != nil {
 			return err
 		}
+		lineCounts, _ = gox.CountLines(reader)
 	}
-	return nil
+	if reader, err = source.Open(); err != nil {
+		return err
+	}
+	return li.Parse(reader, lineCounts)
 }
 
 // Parse parse text or json
@@ -179,6 +249,8 @@ func (li *LogInfo) Parse(reader *bufio.Reader, counts ...int) error {
 	index := 0
 	var ts string
 	var hist = Histogram{Ops: map[string]int{}}
+	events := NewLogEvents()
+	events.inRange = li.isInTimeRange
 	li.regexp = regexp.MustCompile(li.regex)
 	for {
 		if lineCounts > 0 && !li.silent && index%50 == 0 {
@@ -199,48 +271,10 @@ func (li *LogInfo) Parse(reader *bufio.Reader, counts ...int) error {
 			}
 			str += string(bbuf)
 		}
-		if li.LogType == "" { //examine the log logType
-			if regexp.MustCompile("^{.*}$").MatchString(str) {
-				li.LogType = "logv2"
-				if stat, err = li.ParseLogv2(str); err != nil {
-					continue
-				}
-			} else {
-				li.LogType = "text"
-				if stat, err = li.ParseLog(str); err != nil {
-					continue
-				}
-			}
-		} else if li.LogType == "logv2" || str[0:1] == "{" {
-			if li.DBVersion == "" && strings.Index(str, `"Build Info"`) > 0 {
-				label := `"version":"`
-				idx := strings.Index(str, label)
-				if idx > 0 {
-					li.DBVersion = str[idx+len(label):]
-					idx = strings.Index(li.DBVersion, `"`)
-					li.DBVersion = "v" + li.DBVersion[:idx]
-				}
-			} else if stat, err = li.ParseLogv2(str); err != nil {
-				continue
-			}
-			li.LogType = "logv2"
-		} else {
-			if li.DBVersion == "" && strings.Index(str, " CONTROL ") > 0 {
-				label := "db version"
-				idx := strings.Index(str, label)
-				if idx > 0 {
-					li.DBVersion = str[idx+len(label)+1:]
-				}
-			} else if stat, err = li.ParseLog(str); err != nil {
-				continue
-			}
+		if str[0] == '{' {
+			events.Add(str)
 		}
-		if stat.op == "" {
-			if li.verbose {
-				fmt.Println(str)
-			}
-			continue
-		} else if stat.op == dollarCmd {
+		if stat, err = li.ParseLine(str); err != nil {
 			continue
 		}
 		if stat.utc != ts { //	push
@@ -251,38 +285,182 @@ func (li *LogInfo) Parse(reader *bufio.Reader, counts ...int) error {
 			ts = stat.utc
 			hist = Histogram{UTC: ts, Ops: map[string]int{}}
 		}
-		cnt := hist.Ops[stat.op]
-		cnt++
-		hist.Ops[stat.op] = cnt
-		key := stat.op + "." + stat.ns + "." + stat.filter + "." + stat.scan
-		_, ok := opsMap[key]
-		if stat.op != "insert" && (len(li.SlowOps) < topN || stat.milli > li.SlowOps[topN-1].Milli) {
-			li.SlowOps = append(li.SlowOps, RawLog{Milli: stat.milli, Log: str})
-			sort.Slice(li.SlowOps, func(i, j int) bool {
-				return li.SlowOps[i].Milli > li.SlowOps[j].Milli
-			})
-			if len(li.SlowOps) > topN {
-				li.SlowOps = li.SlowOps[:topN]
+		hist.Ops[stat.op]++
+		li.collect(opsMap, stat, str)
+	}
+	li.Histograms = mergeHistograms(append(li.Histograms, hist)) // logs of hosts may overlap
+	li.setOpPatterns(opsMap)
+	events.Finalize()
+	li.Events = *events
+	if !li.silent {
+		fmt.Fprintf(os.Stderr, "\r                         \r")
+	}
+	return nil
+}
+
+// mergeHistograms merges histograms of the same minutes, sorted by minutes
+func mergeHistograms(lists ...[]Histogram) []Histogram {
+	histMap := map[string]Histogram{}
+	for _, hists := range lists {
+		for _, value := range hists {
+			hist, ok := histMap[value.UTC]
+			if !ok {
+				hist = Histogram{UTC: value.UTC, Ops: map[string]int{}}
 			}
+			for op, count := range value.Ops {
+				hist.Ops[op] += count
+			}
+			histMap[value.UTC] = hist
 		}
+	}
+	histograms := make([]Histogram, 0, len(histMap))
+	for _, hist := range histMap {
+		histograms = append(histograms, hist)
+	}
+	sort.Slice(histograms, func(i, j int) bool {
+		return histograms[i].UTC < histograms[j].UTC
+	})
+	return histograms
+}
 
-		if ok {
-			max := opsMap[key].MaxMilli
-			if stat.milli > max {
-				max = stat.milli
+// getUTCMinute returns the minute of a log timestamp in UTC, e.g. 2021-06-01T16:00:00Z of 2021-06-01T12:00:30.000-0400
+func getUTCMinute(date string) string {
+	for _, layout := range []string{time.RFC3339, "2006-01-02T15:04:05.000-0700"} {
+		if t, err := time.Parse(layout, date); err == nil {
+			return t.UTC().Truncate(time.Minute).Format(time.RFC3339)
+		}
+	}
+	if len(date) < 16 {
+		return date
+	}
+	return date[:16] + `:00Z`
+}
+
+// ParseLine parses a line of text or json and returns stats of a slow op
+func (li *LogInfo) ParseLine(str string) (LogStats, error) {
+	var err error
+	var stat LogStats
+	if li.regexp == nil {
+		li.regexp = regexp.MustCompile(li.regex)
+	}
+	if li.LogType == "" { //examine the log logType
+		if regexp.MustCompile("^{.*}$").MatchString(str) {
+			li.LogType = "logv2"
+			if stat, err = li.ParseLogv2(str); err != nil {
+				return stat, err
 			}
-			x := opsMap[key].TotalMilli + int64(stat.milli)
-			y := opsMap[key].Count + 1
-			z := opsMap[key].TotalReslen + int64(stat.reslen)
-			opsMap[key] = OpPattern{Command: opsMap[key].Command, Namespace: stat.ns, Filter: opsMap[key].Filter,
-				MaxMilli: max, TotalMilli: x, Count: y, Scan: stat.scan, Index: stat.index, TotalReslen: z}
 		} else {
-			opsMap[key] = OpPattern{Command: stat.op, Namespace: stat.ns, Filter: stat.filter, TotalMilli: int64(stat.milli),
-				MaxMilli: stat.milli, Count: 1, Scan: stat.scan, Index: stat.index, TotalReslen: int64(stat.reslen)}
-			li.logs = append(li.logs, str) // append a sample
+			li.LogType = "text"
+			if stat, err = li.ParseLog(str); err != nil {
+				return stat, err
+			}
+		}
+	} else if li.LogType == "logv2" || str[0:1] == "{" {
+		if li.DBVersion == "" && strings.Index(str, `"Build Info"`) > 0 {
+			label := `"version":"`
+			idx := strings.Index(str, label)
+			if idx > 0 {
+				li.DBVersion = str[idx+len(label):]
+				idx = strings.Index(li.DBVersion, `"`)
+				li.DBVersion = "v" + li.DBVersion[:idx]
+			}
+		} else if stat, err = li.ParseLogv2(str); err != nil {
+			return stat, err
+		}
+		li.LogType = "logv2"
+	} else {
+		if li.DBVersion == "" && strings.Index(str, " CONTROL ") > 0 {
+			label := "db version"
+			idx := strings.Index(str, label)
+			if idx > 0 {
+				li.DBVersion = str[idx+len(label)+1:]
+			}
+		} else if stat, err = li.ParseLog(str); err != nil {
+			return stat, err
+		}
+	}
+	if stat.op == "" {
+		if li.verbose {
+			fmt.Println(str)
 		}
+		return stat, errors.New("no op found")
+	} else if stat.op == dollarCmd {
+		return stat, errors.New("system command")
+	} else if !li.isInTimeRange(stat.utc) {
+		return stat, errors.New("out of time range")
+	}
+	return stat, nil
+}
+
+// isInTimeRange returns true if the minute of a log line is within time bounds
+func (li *LogInfo) isInTimeRange(utc string) bool {
+	if li.from.IsZero() && li.to.IsZero() {
+		return true
+	}
+	t, err := time.Parse(time.RFC3339, utc)
+	if err != nil {
+		return false
+	}
+	if !li.from.IsZero() && t.Before(li.from.Truncate(time.Minute)) {
+		return false
+	} else if !li.to.IsZero() && t.After(li.to) {
+		return false
+	}
+	return true
+}
+
+// addSlowOp adds an op to a list of the slowest ops, sorted by milliseconds and up to topN
+func addSlowOp(list []RawLog, op RawLog) []RawLog {
+	if len(list) >= topN && op.Milli <= list[topN-1].Milli {
+		return list
+	}
+	list = append(list, op)
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Milli > list[j].Milli
+	})
+	if len(list) > topN {
+		list = list[:topN]
+	}
+	return list
+}
+
+// collect adds a slow op to the ops patterns map and the slowest ops list
+func (li *LogInfo) collect(opsMap map[string]OpPattern, stat LogStats, str string) {
+	key := getOpPatternKey(stat.op, stat.ns, getShapeKey(stat.queryHash, stat.shape, stat.filter), stat.scan)
+	if stat.op != "insert" {
+		li.SlowOps = addSlowOp(li.SlowOps, RawLog{Milli: stat.milli, Log: str})
+	}
+
+	op, ok := opsMap[key]
+	if !ok {
+		op = OpPattern{Command: stat.op, Filter: stat.filter, QueryHash: stat.queryHash, Shape: stat.shape, Sort: stat.sort}
+		li.logs = append(li.logs, str) // append a sample
+	}
+	if stat.milli > op.MaxMilli {
+		op.MaxMilli = stat.milli
+	}
+	op.Count++
+	op.Index = stat.index
+	op.Namespace = stat.ns
+	op.Scan = stat.scan
+	op.TotalMilli += int64(stat.milli)
+	op.TotalReslen += int64(stat.reslen)
+	op.Latency.Add(stat.milli)
+	op.TotalBytesRead += stat.bytesRead
+	op.TotalDocsExamined += int64(stat.docsExamined)
+	op.TotalKeysExamined += int64(stat.keysExamined)
+	op.TotalLockWaitMicros += stat.lockWaitMicros
+	op.TotalReturned += int64(stat.nreturned)
+	op.TotalStorageWaitMicros += stat.storageWaitMicros
+	op.TotalYields += int64(stat.numYields)
+	if stat.planCacheKey != "" {
+		op.PlanCacheKey = stat.planCacheKey
 	}
-	li.Histograms = append(li.Histograms, hist)
+	opsMap[key] = op
+}
+
+// setOpPatterns sets ops patterns from a map, sorted by average milliseconds
+func (li *LogInfo) setOpPatterns(opsMap map[string]OpPattern) {
 	li.OpPatterns = make([]OpPattern, 0, len(opsMap))
 	for _, value := range opsMap {
 		li.OpPatterns = append(li.OpPatterns, value)
@@ -290,12 +468,105 @@ func (li *LogInfo) Parse(reader *bufio.Reader, counts ...int) error {
 	sort.Slice(li.OpPatterns, func(i, j int) bool {
 		return float64(li.OpPatterns[i].TotalMilli)/float64(li.OpPatterns[i].Count) > float64(li.OpPatterns[j].TotalMilli)/float64(li.OpPatterns[j].Count)
 	})
-	if !li.silent {
-		fmt.Fprintf(os.Stderr, "\r                         \r")
+}
+
+// mergeOpPattern merges stats of the same ops pattern
+func mergeOpPattern(x OpPattern, y OpPattern) OpPattern {
+	if y.MaxMilli > x.MaxMilli {
+		x.MaxMilli = y.MaxMilli
+	}
+	x.Count += y.Count
+	x.TotalMilli += y.TotalMilli
+	x.TotalReslen += y.TotalReslen
+	x.Scan = y.Scan
+	x.Index = y.Index
+	x.Latency = x.Latency.Merge(y.Latency)
+	x.TotalBytesRead += y.TotalBytesRead
+	x.TotalDocsExamined += y.TotalDocsExamined
+	x.TotalKeysExamined += y.TotalKeysExamined
+	x.TotalLockWaitMicros += y.TotalLockWaitMicros
+	x.TotalReturned += y.TotalReturned
+	x.TotalStorageWaitMicros += y.TotalStorageWaitMicros
+	x.TotalYields += y.TotalYields
+	if y.PlanCacheKey != "" {
+		x.PlanCacheKey = y.PlanCacheKey
+	}
+	if x.Sort == "" {
+		x.Sort = y.Sort
+	}
+	return x
+}
+
+func getOpPatternKey(op string, ns string, shape string, scan string) string {
+	return op + "." + ns + "." + shape + "." + scan
+}
+
+// getShapeKey returns queryHash if available, otherwise the canonical shape or the filter
+func getShapeKey(queryHash string, shape string, filter string) string {
+	if queryHash != "" {
+		return "#" + queryHash
+	} else if shape != "" {
+		return shape
+	}
+	return filter
+}
+
+// MergeFiles analyzes files, either logs or -log.bson.gz, separately and merges results
+func (li *LogInfo) MergeFiles(filenames []string) error {
+	for i, filename := range filenames {
+		other := li.clone()
+		if err := other.AnalyzeFile(filename); err != nil {
+			return err
+		}
+		if i == 0 {
+			li.filename = filename
+		}
+		li.Merge(other)
 	}
 	return nil
 }
 
+// clone returns a new LogInfo with the same settings
+func (li *LogInfo) clone() *LogInfo {
+	return &LogInfo{Collscan: li.Collscan, Logger: li.Logger, Redaction: li.Redaction,
+		from: li.from, regex: li.regex, silent: li.silent, to: li.to, verbose: li.verbose}
+}
+
+// Merge merges results of another analysis, e.g. from a separately analyzed file
+func (li *LogInfo) Merge(other *LogInfo) {
+	opsMap := map[string]OpPattern{}
+	for _, patterns := range [][]OpPattern{li.OpPatterns, other.OpPatterns} {
+		for _, value := range patterns {
+			key := getOpPatternKey(value.Command, value.Namespace, getShapeKey(value.QueryHash, value.Shape, value.Filter), value.Scan)
+			if op, ok := opsMap[key]; ok {
+				opsMap[key] = mergeOpPattern(op, value)
+			} else {
+				value.Latency = value.Latency.Clone()
+				opsMap[key] = value
+			}
+		}
+	}
+	li.setOpPatterns(opsMap)
+
+	li.Histograms = mergeHistograms(li.Histograms, other.Histograms)
+
+	li.SlowOps = append(li.SlowOps, other.SlowOps...)
+	sort.Slice(li.SlowOps, func(i, j int) bool {
+		return li.SlowOps[i].Milli > li.SlowOps[j].Milli
+	})
+	if len(li.SlowOps) > topN {
+		li.SlowOps = li.SlowOps[:topN]
+	}
+	li.Events.Merge(other.Events)
+	li.logs = append(li.logs, other.logs...)
+	if li.DBVersion == "" {
+		li.DBVersion = other.DBVersion
+	}
+	if li.LogType == "" {
+		li.LogType = other.LogType
+	}
+}
+
 // OutputBSON writes loginfo bson data
 func (li *LogInfo) OutputBSON() (string, []byte, error) {
 	var err error
@@ -364,11 +635,15 @@ func (li *LogInfo) OutputBSON() (string, []byte, error) {
 
 	// output TSV file
 	re := regexp.MustCompile(`\r?\n`)
-	lines := []string{fmt.Sprintf("%v\t%v\t%v\t%v\t%v\t%v\t%v\t%v\t%v\t%v\t%v", "Row", "Category", "Avg Time", "Max Time", "Count", "Total Time", "Total Reslen", "Namespace", "COLLSCAN", "Index(es) Used", "Query Pattern")}
+	lines := []string{strings.Join([]string{"Row", "Category", "Avg Time", "P50 Time", "P95 Time", "P99 Time", "Max Time", "Count",
+		"Total Time", "Total Reslen", "Docs Examined", "Keys Examined", "Returned", "Scan Ratio", "Yields", "Query Hash",
+		"Namespace", "COLLSCAN", "Index(es) Used", "Query Pattern"}, "\t")}
 	for i, doc := range li.OpPatterns {
 		avg := float64(doc.TotalMilli) / float64(doc.Count)
-		lines = append(lines, fmt.Sprintf("%v\t%v\t%v\t%v\t%v\t%v\t%v\t%v\t%v\t%v\t%v", i+1, doc.Command, gox.MilliToTimeString(avg), doc.MaxMilli, doc.Count,
-			doc.TotalMilli, doc.TotalReslen, doc.Namespace, doc.Scan, re.ReplaceAllString(doc.Index, " "), doc.Filter))
+		lines = append(lines, fmt.Sprintf("%v\t%v\t%v\t%v\t%v\t%v\t%v\t%v\t%v\t%v\t%v\t%v\t%v\t%.1f\t%v\t%v\t%v\t%v\t%v\t%v", i+1, doc.Command, gox.MilliToTimeString(avg),
+			doc.Percentile(50), doc.Percentile(95), doc.Percentile(99), doc.MaxMilli, doc.Count,
+			doc.TotalMilli, doc.TotalReslen, doc.TotalDocsExamined, doc.TotalKeysExamined, doc.TotalReturned, doc.ScanRatio(),
+			doc.TotalYields, doc.QueryHash, doc.Namespace, doc.Scan, re.ReplaceAllString(doc.Index, " "), doc.Filter))
 	}
 
 	idx = strings.Index(tsvf, ".tsv")
@@ -406,6 +681,65 @@ func (li *LogInfo) OutputJSON() error {
 // Print prints indexes
 func (li *LogInfo) Print() {
 	fmt.Println(li.printLogsSummary())
+	if str := li.printScanEfficiency(); str != "" {
+		fmt.Println(str)
+	}
+	if len(li.Events.Catalogue) > 0 {
+		li.Events.Print()
+	}
+}
+
+// GetScanEfficiencyPatterns returns ops patterns sorted by examined-to-returned ratio
+func (li *LogInfo) GetScanEfficiencyPatterns() []OpPattern {
+	patterns := []OpPattern{}
+	for _, value := range li.OpPatterns {
+		if value.TotalDocsExamined > 0 || value.TotalKeysExamined > 0 {
+			patterns = append(patterns, value)
+		}
+	}
+	sort.Slice(patterns, func(i, j int) bool {
+		if patterns[i].ScanRatio() == patterns[j].ScanRatio() {
+			return patterns[i].TotalMilli > patterns[j].TotalMilli
+		}
+		return patterns[i].ScanRatio() > patterns[j].ScanRatio()
+	})
+	return patterns
+}
+
+// printScanEfficiency prints ops patterns of the worst scan efficiency
+func (li *LogInfo) printScanEfficiency() string {
+	var maxSize = 10
+	patterns := li.GetScanEfficiencyPatterns()
+	if len(patterns) == 0 {
+		return ""
+	}
+	if len(patterns) > maxSize {
+		patterns = patterns[:maxSize]
+	}
+	var buffer bytes.Buffer
+	buffer.WriteString("+----------+----------+----------+----------+----------+---------------------------------+--------------------------------------------------------------+\n")
+	buffer.WriteString(fmt.Sprintf("| Command  |scan ratio| docs/op  | keys/op  |  ret/op  | %-32s| %-60s |\n", "Namespace", "Query Pattern"))
+	buffer.WriteString("|----------+----------+----------+----------+----------+---------------------------------+--------------------------------------------------------------|\n")
+	for _, value := range patterns {
+		command := value.Command
+		if len(command) > 10 {
+			command = command[:10]
+		}
+		ns := value.Namespace
+		if len(ns) > 33 {
+			ns = ns[:1] + "*" + ns[(len(ns)-31):]
+		}
+		filter := value.Filter
+		if len(filter) > 60 {
+			filter = filter[:57] + "..."
+		}
+		count := float64(value.Count)
+		buffer.WriteString(fmt.Sprintf("|%-10s %10.1f %10.1f %10.1f %10.1f %-33s %-62s|\n", command, value.ScanRatio(),
+			float64(value.TotalDocsExamined)/count, float64(value.TotalKeysExamined)/count, float64(value.TotalReturned)/count, ns, filter))
+	}
+	buffer.WriteString("+----------+----------+----------+----------+----------+---------------------------------+--------------------------------------------------------------+\n")
+	buffer.WriteString(fmt.Sprintf(`top %d of %v lines by examined-to-returned ratio displayed.`, len(patterns), len(li.OpPatterns)))
+	return buffer.String()
 }
 
 // printLogsSummary prints loginfo summary
@@ -421,9 +755,9 @@ func (li *LogInfo) printLogsSummary() string {
 	}
 	summaries := []string{}
 	var buffer bytes.Buffer
-	buffer.WriteString("\r+----------+--------+------+--------+------+---------------------------------+--------------------------------------------------------------+\n")
-	buffer.WriteString(fmt.Sprintf("| Command  |COLLSCAN|avg ms| max ms | Count| %-32s| %-60s |\n", "Namespace", "Query Pattern"))
-	buffer.WriteString("|----------+--------+------+--------+------+---------------------------------+--------------------------------------------------------------|\n")
+	buffer.WriteString("\r+----------+--------+------+------+------+------+--------+------+---------------------------------+--------------------------------------------------------------+\n")
+	buffer.WriteString(fmt.Sprintf("| Command  |COLLSCAN|avg ms|p50 ms|p95 ms|p99 ms| max ms | Count| %-32s| %-60s |\n", "Namespace", "Query Pattern"))
+	buffer.WriteString("|----------+--------+------+------+------+------+--------+------+---------------------------------+--------------------------------------------------------------|\n")
 	count := 0
 	for _, value := range li.OpPatterns {
 		count++
@@ -448,12 +782,15 @@ func (li *LogInfo) printLogsSummary() string {
 		output := ""
 		avg := float64(value.TotalMilli) / float64(value.Count)
 		avgstr := gox.MilliToTimeString(avg)
+		p50str := gox.MilliToTimeString(float64(value.Percentile(50)))
+		p95str := gox.MilliToTimeString(float64(value.Percentile(95)))
+		p99str := gox.MilliToTimeString(float64(value.Percentile(99)))
 		if value.Scan == COLLSCAN {
-			output = fmt.Sprintf("|%-10s %v%8s%v %6s %8d %6d %-33s %v%-62s%v|\n", value.Command, red, value.Scan, tail,
-				avgstr, value.MaxMilli, value.Count, value.Namespace, red, str, tail)
+			output = fmt.Sprintf("|%-10s %v%8s%v %6s %6s %6s %6s %8d %6d %-33s %v%-62s%v|\n", value.Command, red, value.Scan, tail,
+				avgstr, p50str, p95str, p99str, value.MaxMilli, value.Count, value.Namespace, red, str, tail)
 		} else {
-			output = fmt.Sprintf("|%-10s %8s %6s %8d %6d %-33s %-62s|\n", value.Command, value.Scan,
-				avgstr, value.MaxMilli, value.Count, value.Namespace, str)
+			output = fmt.Sprintf("|%-10s %8s %6s %6s %6s %6s %8d %6d %-33s %-62s|\n", value.Command, value.Scan,
+				avgstr, p50str, p95str, p99str, value.MaxMilli, value.Count, value.Namespace, str)
 		}
 		buffer.WriteString(output)
 		if len(value.Filter) > 60 {
@@ -476,20 +813,20 @@ func (li *LogInfo) printLogsSummary() string {
 					}
 				}
 				if value.Scan == COLLSCAN {
-					output = fmt.Sprintf("|%74s   %v%-62s%v|\n", " ", red, pstr, tail)
+					output = fmt.Sprintf("|%95s   %v%-62s%v|\n", " ", red, pstr, tail)
 					buffer.WriteString(output)
 				} else {
-					output = fmt.Sprintf("|%74s   %-62s|\n", " ", pstr)
+					output = fmt.Sprintf("|%95s   %-62s|\n", " ", pstr)
 					buffer.WriteString(output)
 				}
 			}
 		}
 		if value.Index != "" {
-			output = fmt.Sprintf("|...index:  %v%-128s%v|\n", green, value.Index, tail)
+			output = fmt.Sprintf("|...index:  %v%-149s%v|\n", green, value.Index, tail)
 			buffer.WriteString(output)
 		}
 	}
-	buffer.WriteString("+----------+--------+------+--------+------+---------------------------------+--------------------------------------------------------------+\n")
+	buffer.WriteString("+----------+--------+------+------+------+------+--------+------+---------------------------------+--------------------------------------------------------------+\n")
 	summaries = append(summaries, buffer.String())
 	summaries = append(summaries, fmt.Sprintf(`top %d of %v lines displayed; see HTML report for details.`, count, len(li.OpPatterns)))
 	return strings.Join(summaries, "\n")
@@ -4,6 +4,7 @@ package mdb
 
 import (
 	"bufio"
+	"fmt"
 	"strings"
 	"testing"
 )
@@ -33,3 +34,53 @@ func TestLoginfoParse(t *testing.T) {
 		t.Fatal(err)
 	}
 }
+
+func TestLogInfoMerge(t *testing.T) {
+	line := `{"t":{"$date":"2020-11-05T09:%02d:50.680+00:00"},"s":"I","c":"COMMAND","id":51803,"ctx":"conn1","msg":"Slow query","attr":{"type":"command","ns":"keyhole.cars","command":{"find":"cars","filter":{"color":"red"}},"planSummary":"COLLSCAN","reslen":100,"durationMillis":%d}}`
+	var lines []string
+	for i := 1; i <= 100; i++ {
+		lines = append(lines, fmt.Sprintf(line, i%2, i))
+	}
+	x := NewLogInfo("utest-xxxxxx")
+	x.SetSilent(true)
+	if err := x.Parse(bufio.NewReader(strings.NewReader(strings.Join(lines[:50], "\n")))); err != nil {
+		t.Fatal(err)
+	}
+	y := NewLogInfo("utest-xxxxxx")
+	y.SetSilent(true)
+	if err := y.Parse(bufio.NewReader(strings.NewReader(strings.Join(lines[50:], "\n")))); err != nil {
+		t.Fatal(err)
+	}
+	x.Merge(y)
+	if len(x.OpPatterns) != 1 || x.OpPatterns[0].Count != 100 || x.OpPatterns[0].MaxMilli != 100 {
+		t.Fatal("expected 1 pattern of 100 ops but got", x.OpPatterns)
+	}
+	if p95 := x.OpPatterns[0].Percentile(95); p95 < 90 || p95 > 100 {
+		t.Fatal("expected p95 about 95 but got", p95)
+	}
+	if len(x.Histograms) != 2 || x.Histograms[0].Ops["find"] != 50 {
+		t.Fatal("expected 2 histograms but got", x.Histograms)
+	}
+	t.Log(x.printLogsSummary())
+}
+
+func TestGetScanEfficiencyPatterns(t *testing.T) {
+	str := `2020-05-12T12:48:14.398-0400 I COMMAND [conn6800] command arlmd01p.defaultCollectionAccount command: getMore { getMore: 78661681062, collection: "defaultCollectionAccount", $db: "arlmd01p" } originatingCommand: { find: "defaultCollectionAccount", filter: { $and: [ { dataLoadDate: new Date(1589169600000) }, { sourceSystem: "MSP" } ] }, sort: {}, skip: 0, $readPreference: { mode: "secondaryPreferred" }, $db: "arlmd01p" } planSummary: COLLSCAN cursorid:78661681062 keysExamined:0 docsExamined:11485 numYields:133 nreturned:2498 reslen:16771175 locks:{ Global: { acquireCount: { r: 268 } }, Database: { acquireCount: { r: 134 } }, Collection: { acquireCount: { r: 134 } } } protocol:op_query 2352ms`
+	loginfo := NewLogInfo("utest-xxxxxx")
+	loginfo.SetSilent(true)
+	if err := loginfo.Parse(bufio.NewReader(strings.NewReader(str))); err != nil {
+		t.Fatal(err)
+	}
+	patterns := loginfo.GetScanEfficiencyPatterns()
+	if len(patterns) != 1 {
+		t.Fatal("expected 1 pattern but got", len(patterns))
+	}
+	op := patterns[0]
+	if op.TotalDocsExamined != 11485 || op.TotalReturned != 2498 || op.TotalYields != 133 {
+		t.Fatal("unexpected examined stats", op.TotalDocsExamined, op.TotalReturned, op.TotalYields)
+	}
+	if ratio := op.ScanRatio(); ratio < 4.5 || ratio > 4.7 {
+		t.Fatal("expected ratio about 4.6 but got", ratio)
+	}
+	t.Log(loginfo.printScanEfficiency())
+}
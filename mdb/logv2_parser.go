@@ -16,12 +16,28 @@ import (
 type Logv2 struct {
 	Attributes struct {
 		Command            map[string]interface{} `json:"command" bson:"command"`
+		DocsExamined       int                    `json:"docsExamined" bson:"docsExamined"`
+		KeysExamined       int                    `json:"keysExamined" bson:"keysExamined"`
+		Locks              map[string]interface{} `json:"locks" bson:"locks"`
 		Milli              int                    `json:"durationMillis" bson:"durationMillis"`
+		NDeleted           int                    `json:"ndeleted" bson:"ndeleted"`
+		NMatched           int                    `json:"nMatched" bson:"nMatched"`
+		NReturned          int                    `json:"nreturned" bson:"nreturned"`
 		NS                 string                 `json:"ns" bson:"ns"`
+		NumYields          int                    `json:"numYields" bson:"numYields"`
 		OriginatingCommand map[string]interface{} `json:"originatingCommand" bson:"originatingCommand"`
+		PlanCacheKey       string                 `json:"planCacheKey" bson:"planCacheKey"`
+		PlanCacheShapeHash string                 `json:"planCacheShapeHash" bson:"planCacheShapeHash"`
 		PlanSummary        string                 `json:"planSummary" bson:"planSummary"`
+		QueryHash          string                 `json:"queryHash" bson:"queryHash"`
 		Reslen             int                    `json:"reslen" bson:"reslen"`
-		Type               string                 `json:"type" bson:"type"`
+		Storage            struct {
+			Data struct {
+				BytesRead         int64 `json:"bytesRead" bson:"bytesRead"`
+				TimeReadingMicros int64 `json:"timeReadingMicros" bson:"timeReadingMicros"`
+			} `json:"data" bson:"data"`
+		} `json:"storage" bson:"storage"`
+		Type string `json:"type" bson:"type"`
 	} `json:"attr" bson:"attr"`
 	Component string            `json:"c" bson:"c"`
 	ID        int               `json:"id" bson:"id"`
@@ -87,6 +103,18 @@ func (li *LogInfo) ParseLogv2(str string) (LogStats, error) {
 		}
 	}
 	stat.reslen = doc.Attributes.Reslen
+	stat.docsExamined = doc.Attributes.DocsExamined
+	stat.keysExamined = doc.Attributes.KeysExamined
+	stat.nreturned = doc.Attributes.NReturned + doc.Attributes.NMatched + doc.Attributes.NDeleted
+	stat.numYields = doc.Attributes.NumYields
+	stat.planCacheKey = doc.Attributes.PlanCacheKey
+	stat.queryHash = doc.Attributes.QueryHash
+	if stat.queryHash == "" { // renamed since v8.0
+		stat.queryHash = doc.Attributes.PlanCacheShapeHash
+	}
+	stat.bytesRead = doc.Attributes.Storage.Data.BytesRead
+	stat.storageWaitMicros = doc.Attributes.Storage.Data.TimeReadingMicros
+	stat.lockWaitMicros = getLockWaitMicros(doc.Attributes.Locks)
 
 	if li.Collscan && stat.scan != COLLSCAN {
 		return stat, errors.New("skip, -collscan")
@@ -200,14 +228,35 @@ func (li *LogInfo) ParseLogv2(str string) (LogStats, error) {
 	stat.filter = re.ReplaceAllString(stat.filter, `{$1:...}`)
 	re = regexp.MustCompile(`{"\$oid":1}`)
 	stat.filter = re.ReplaceAllString(stat.filter, `1`)
+	ordered := getLogv2Command(str, isGetMore)
+	if stat.queryHash == "" {
+		stat.shape = getCommandShape(stat.op, ordered)
+	}
+	stat.sort = getCommandSortShape(ordered)
 	if isGetMore {
 		stat.op = cmdGetMore
 	}
-	utc := doc.Timestamp["$date"][:16] + `:00Z`
-	stat.utc = utc
+	stat.utc = getUTCMinute(doc.Timestamp["$date"])
 	return stat, nil
 }
 
+// getLockWaitMicros sums timeAcquiringMicros of all lock resources
+func getLockWaitMicros(locks map[string]interface{}) int64 {
+	micros := int64(0)
+	for _, v := range locks {
+		lock, ok := v.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		if waits, ok := lock["timeAcquiringMicros"].(map[string]interface{}); ok {
+			for _, wait := range waits {
+				micros += ToInt64(wait)
+			}
+		}
+	}
+	return micros
+}
+
 func isRegex(doc map[string]interface{}) bool {
 	if buf, err := json.Marshal(doc); err != nil {
 		return false
@@ -85,3 +85,21 @@ func TestParseLogv2BSON(t *testing.T) {
 		t.Fatal(`expected COMMAND but got`, doc.Component)
 	}
 }
+
+func TestParseLogv2ExecStats(t *testing.T) {
+	str := `{"t":{"$date":"2020-11-05T09:30:50.680+00:00"},"s":"I","c":"COMMAND","id":51803,"ctx":"conn851","msg":"Slow query","attr":{"type":"command","ns":"keyhole.cars","command":{"find":"cars","filter":{"color":"red"},"$db":"keyhole"},"planSummary":"COLLSCAN","keysExamined":0,"docsExamined":5000,"cursorExhausted":true,"numYields":39,"nreturned":10,"queryHash":"4B53BE76","planCacheKey":"4B53BE76","reslen":2315,"locks":{"Global":{"acquireCount":{"r":40},"timeAcquiringMicros":{"r":120}},"Collection":{"acquireCount":{"r":40},"timeAcquiringMicros":{"r":30}}},"storage":{"data":{"bytesRead":1048576,"timeReadingMicros":2500}},"protocol":"op_msg","durationMillis":52}}`
+	loginfo := NewLogInfo("utest-xxxxxx")
+	stat, err := loginfo.ParseLogv2(str)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stat.docsExamined != 5000 || stat.keysExamined != 0 || stat.nreturned != 10 || stat.numYields != 39 {
+		t.Fatal("unexpected examined stats", stat.docsExamined, stat.keysExamined, stat.nreturned, stat.numYields)
+	}
+	if stat.queryHash != "4B53BE76" || stat.planCacheKey != "4B53BE76" {
+		t.Fatal("unexpected hashes", stat.queryHash, stat.planCacheKey)
+	}
+	if stat.lockWaitMicros != 150 || stat.bytesRead != 1048576 || stat.storageWaitMicros != 2500 {
+		t.Fatal("unexpected wait stats", stat.lockWaitMicros, stat.bytesRead, stat.storageWaitMicros)
+	}
+}
@@ -0,0 +1,151 @@
+// Copyright 2020-present Kuei-chun Chen. All rights reserved.
+
+package mdb
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// logv2Command stores commands of a logv2 line with fields order preserved
+type logv2Command struct {
+	Attributes struct {
+		Command            bson.D `bson:"command"`
+		OriginatingCommand bson.D `bson:"originatingCommand"`
+	} `bson:"attr"`
+}
+
+// getLogv2Command returns the command, or the originating command of a getMore, of a logv2 line
+// with fields order preserved because decoded maps don't keep orders
+func getLogv2Command(str string, isGetMore bool) bson.D {
+	var doc logv2Command
+	if err := bson.UnmarshalExtJSON([]byte(str), false, &doc); err != nil {
+		return nil
+	}
+	if isGetMore {
+		return doc.Attributes.OriginatingCommand
+	}
+	return doc.Attributes.Command
+}
+
+// getCommandSortShape returns the sort of a command, or of the first $sort stage of its pipeline
+func getCommandSortShape(command bson.D) string {
+	m := command.Map()
+	if m["sort"] != nil {
+		return getSortShape(m["sort"])
+	}
+	pipeline, _ := m["pipeline"].(bson.A)
+	for _, v := range pipeline {
+		if stage, ok := v.(bson.D); ok && len(stage) > 0 && stage[0].Key == "$sort" {
+			return getSortShape(stage[0].Value)
+		}
+	}
+	return ""
+}
+
+// getSortShape returns a sort document keeping directions, e.g. {"a":1,"b":-1}
+func getSortShape(v interface{}) string {
+	doc, ok := v.(bson.D)
+	if !ok || len(doc) == 0 {
+		return ""
+	}
+	strs := []string{}
+	for _, e := range doc {
+		direction, ok := getKeyDirection(e.Value)
+		if !ok { // e.g. {"$meta": "textScore"}
+			continue
+		}
+		name, _ := json.Marshal(e.Key)
+		strs = append(strs, fmt.Sprintf("%v:%d", string(name), direction))
+	}
+	if len(strs) == 0 {
+		return ""
+	}
+	return "{" + strings.Join(strs, ",") + "}"
+}
+
+// getCommandShape returns a canonical shape of filter, sort, and pipeline of a command
+func getCommandShape(op string, command bson.D) string {
+	if op == cmdInsert || op == cmdCreateIndexes {
+		return "N/A"
+	}
+	m := command.Map()
+	if op == cmdAggregate {
+		return getQueryShape(m["pipeline"])
+	}
+	if statements, ok := m[op+"s"].(bson.A); ok && len(statements) > 0 { // updates or deletes
+		if statement, ok := statements[0].(bson.D); ok {
+			m = statement.Map()
+		}
+	}
+	shape := ""
+	for _, name := range []string{"filter", "query", "q"} {
+		if m[name] != nil {
+			shape = getQueryShape(m[name])
+			break
+		}
+	}
+	if op == cmdDistinct && m["key"] != nil {
+		shape = `{"key":"` + getString(m["key"]) + `"},` + shape
+	}
+	if m["sort"] != nil {
+		shape += `,sort:` + getQueryShape(m["sort"])
+	}
+	return shape
+}
+
+// getQueryShape returns a deterministic, order-preserving shape of a document.
+// Values are replaced by 1, regular expressions by /.../, arrays by [...] except
+// arrays of $and, $or, and $nor of which elements are kept.
+func getQueryShape(v interface{}) string {
+	return getShape("", v)
+}
+
+func getShape(key string, v interface{}) string {
+	switch x := v.(type) {
+	case bson.D:
+		if len(x) == 0 {
+			return "{}"
+		}
+		strs := []string{}
+		for _, e := range x {
+			name, _ := json.Marshal(e.Key)
+			strs = append(strs, string(name)+":"+getShape(e.Key, e.Value))
+		}
+		return "{" + strings.Join(strs, ",") + "}"
+	case bson.A:
+		return getArrayShape(key, []interface{}(x))
+	case []interface{}:
+		return getArrayShape(key, x)
+	case primitive.Regex:
+		prefix := ""
+		if strings.HasPrefix(x.Pattern, "^") {
+			prefix = "^"
+		}
+		return "/" + prefix + ".../" + x.Options
+	default:
+		return "1"
+	}
+}
+
+func getArrayShape(key string, arr []interface{}) string {
+	if key != "$and" && key != "$or" && key != "$nor" && key != "" {
+		return "[...]"
+	}
+	strs := []string{}
+	for _, v := range arr {
+		strs = append(strs, getShape("", v))
+	}
+	return "[" + strings.Join(strs, ",") + "]"
+}
+
+func getString(v interface{}) string {
+	if s, ok := v.(string); ok {
+		return s
+	}
+	return ""
+}
@@ -0,0 +1,86 @@
+// Copyright 2020-present Kuei-chun Chen. All rights reserved.
+
+package mdb
+
+import (
+	"bufio"
+	"strings"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestGetQueryShape(t *testing.T) {
+	var doc bson.D
+	str := `{"status":"A","$or":[{"qty":{"$lt":30}},{"item":{"$regex":"^p","$options":"i"}}],"tags":{"$in":["a","b","c"]},"user":{"$oid":"59154269cfe1f2d40943d7f5"}}`
+	if err := bson.UnmarshalExtJSON([]byte(str), false, &doc); err != nil {
+		t.Fatal(err)
+	}
+	shape := getQueryShape(doc)
+	expected := `{"status":1,"$or":[{"qty":{"$lt":1}},{"item":{"$regex":1,"$options":1}}],"tags":{"$in":[...]},"user":1}`
+	if shape != expected {
+		t.Fatal("expected", expected, "but got", shape)
+	}
+	str = `{"item":{"$regularExpression":{"pattern":"^p","options":"i"}}}`
+	if err := bson.UnmarshalExtJSON([]byte(str), false, &doc); err != nil {
+		t.Fatal(err)
+	}
+	if shape = getQueryShape(doc); shape != `{"item":/^.../i}` {
+		t.Fatal(`expected {"item":/^.../i} but got`, shape)
+	}
+}
+
+func TestGetCommandShape(t *testing.T) {
+	var doc bson.D
+	str := `{"find":"cars","filter":{"color":"red","year":{"$gt":2020}},"sort":{"year":-1},"$db":"keyhole"}`
+	if err := bson.UnmarshalExtJSON([]byte(str), false, &doc); err != nil {
+		t.Fatal(err)
+	}
+	if shape := getCommandShape(cmdFind, doc); shape != `{"color":1,"year":{"$gt":1}},sort:{"year":1}` {
+		t.Fatal("unexpected shape", shape)
+	}
+	str = `{"aggregate":"cars","pipeline":[{"$match":{"color":"red"}},{"$group":{"_id":"$year","n":{"$sum":1}}}]}`
+	if err := bson.UnmarshalExtJSON([]byte(str), false, &doc); err != nil {
+		t.Fatal(err)
+	}
+	if shape := getCommandShape(cmdAggregate, doc); shape != `[{"$match":{"color":1}},{"$group":{"_id":1,"n":{"$sum":1}}}]` {
+		t.Fatal("unexpected shape", shape)
+	}
+}
+
+func TestGetLogv2Command(t *testing.T) {
+	str := `{"attr":{"command":{"find":"cars","filter":{"c":{"b":1},"a":1,"b":1,"$or":[{"b":1,"a":2},{"a":3,"b":4}],"color":{"$regularExpression":{"pattern":"^r","options":"i"}},"user":{"$oid":"59154269cfe1f2d40943d7f5"}}}}}`
+	shape := getCommandShape(cmdFind, getLogv2Command(str, false))
+	if shape != `{"c":{"b":1},"a":1,"b":1,"$or":[{"b":1,"a":1},{"a":1,"b":1}],"color":/^.../i,"user":1}` {
+		t.Fatal("unexpected shape", shape)
+	}
+	str = `{"attr":{"command":{"getMore":1,"collection":"cars"},"originatingCommand":{"find":"cars","filter":{"b":{"a":1},"a":1}}}}`
+	if shape = getCommandShape(cmdFind, getLogv2Command(str, true)); shape != `{"b":{"a":1},"a":1}` {
+		t.Fatal("unexpected getMore shape", shape)
+	}
+}
+
+func TestGroupByQueryHash(t *testing.T) {
+	lines := []string{
+		`{"t":{"$date":"2020-11-05T09:30:50.680+00:00"},"s":"I","c":"COMMAND","id":51803,"ctx":"conn1","msg":"Slow query","attr":{"type":"command","ns":"keyhole.cars","command":{"find":"cars","filter":{"color":"red","year":2020}},"planSummary":"COLLSCAN","queryHash":"4B53BE76","durationMillis":100}}`,
+		`{"t":{"$date":"2020-11-05T09:30:51.680+00:00"},"s":"I","c":"COMMAND","id":51803,"ctx":"conn1","msg":"Slow query","attr":{"type":"command","ns":"keyhole.cars","command":{"find":"cars","filter":{"year":2021,"color":"blue"}},"planSummary":"COLLSCAN","queryHash":"4B53BE76","durationMillis":200}}`,
+		`{"t":{"$date":"2020-11-05T09:30:52.680+00:00"},"s":"I","c":"COMMAND","id":51803,"ctx":"conn1","msg":"Slow query","attr":{"type":"command","ns":"keyhole.cars","command":{"find":"cars","filter":{"year":2021,"color":"blue"}},"planSummary":"COLLSCAN","durationMillis":300}}`,
+		`{"t":{"$date":"2020-11-05T09:30:53.680+00:00"},"s":"I","c":"COMMAND","id":51803,"ctx":"conn1","msg":"Slow query","attr":{"type":"command","ns":"keyhole.cars","command":{"find":"cars","filter":{"year":2022,"color":"white"}},"planSummary":"COLLSCAN","durationMillis":400}}`,
+		`{"t":{"$date":"2020-11-05T09:30:54.680+00:00"},"s":"I","c":"COMMAND","id":51803,"ctx":"conn1","msg":"Slow query","attr":{"type":"command","ns":"keyhole.cars","command":{"find":"cars","filter":{"color":"white","year":2022}},"planSummary":"COLLSCAN","durationMillis":500}}`,
+	}
+	loginfo := NewLogInfo("utest-xxxxxx")
+	loginfo.SetSilent(true)
+	if err := loginfo.Parse(bufio.NewReader(strings.NewReader(strings.Join(lines, "\n")))); err != nil {
+		t.Fatal(err)
+	}
+	if len(loginfo.OpPatterns) != 3 {
+		t.Fatal("expected 3 patterns but got", len(loginfo.OpPatterns))
+	}
+	for _, op := range loginfo.OpPatterns {
+		if op.QueryHash == "4B53BE76" && op.Count != 2 {
+			t.Fatal("expected 2 ops of queryHash 4B53BE76 but got", op.Count)
+		} else if op.Shape == `{"year":1,"color":1}` && op.Count != 2 {
+			t.Fatal("expected 2 ops of shape {year,color} but got", op.Count)
+		}
+	}
+}
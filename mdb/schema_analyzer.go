@@ -0,0 +1,571 @@
+// Copyright 2020-present Kuei-chun Chen. All rights reserved.
+
+package mdb
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/bsontype"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	defaultSampleSize = 1000
+	hugeDocumentSize  = 2 * 1024 * 1024 // 2MB
+	maxDistinctValues = 1000
+	maxEnumValues     = 20
+	minEnumRepeats    = 5 // an enum value is repeated 5 times on average
+	minZipfSkew       = 0.5
+	tooManyFields     = 200
+	unboundedArrayLen = 1000
+)
+
+var (
+	arrayLengthBuckets = []int{0, 10, 100, 1000}
+	docSizeBuckets     = []int{1024, 4 * 1024, 16 * 1024, 64 * 1024, 256 * 1024, 1024 * 1024, 4 * 1024 * 1024}
+)
+
+// stringFormats detects well-known string formats, in order
+var stringFormats = []struct {
+	name string
+	re   *regexp.Regexp
+}{
+	{"objectId", regexp.MustCompile(`^[a-fA-F0-9]{24}$`)},
+	{"uuid", regexp.MustCompile(`^[a-fA-F0-9]{8}-[a-fA-F0-9]{4}-[a-fA-F0-9]{4}-[a-fA-F0-9]{4}-[a-fA-F0-9]{12}$`)},
+	{"email", regexp.MustCompile(`^[a-zA-Z0-9_.+-]+@[a-zA-Z0-9-]+\.[a-zA-Z0-9-.]+$`)},
+	{"ip", regexp.MustCompile(`^(\d{1,3}\.){3}\d{1,3}$`)},
+	{"date", regexp.MustCompile(`^\d{4}-\d{2}-\d{2}T\d{2}:\d{2}`)},
+	{"hex", regexp.MustCompile(`^([a-fA-F0-9]{2})+$`)},
+}
+
+// bsonTypeNames maps BSON types to $type aliases
+var bsonTypeNames = map[bsontype.Type]string{
+	bsontype.Array: "array", bsontype.Binary: "binData", bsontype.Boolean: "bool", bsontype.DateTime: "date",
+	bsontype.DBPointer: "dbPointer", bsontype.Decimal128: "decimal", bsontype.Double: "double",
+	bsontype.EmbeddedDocument: "object", bsontype.Int32: "int", bsontype.Int64: "long",
+	bsontype.JavaScript: "javascript", bsontype.MaxKey: "maxKey", bsontype.MinKey: "minKey", bsontype.Null: "null",
+	bsontype.ObjectID: "objectId", bsontype.Regex: "regex", bsontype.String: "string", bsontype.Symbol: "symbol",
+	bsontype.Timestamp: "timestamp", bsontype.Undefined: "undefined"}
+
+// numericTypes are number types of which mixes, e.g. int and double, are not polymorphic
+var numericTypes = map[string]bool{"decimal": true, "double": true, "int": true, "long": true}
+
+// Schema stores inferred schema of sampled documents
+type Schema struct {
+	AvgSize   int64          `bson:"avgSize"`
+	DocSizes  []SchemaBucket `bson:"docSizes"`
+	Fields    []SchemaField  `bson:"fields"`
+	MaxDepth  int            `bson:"maxDepth"`
+	MaxFields int            `bson:"maxFields"`
+	MaxSize   int64          `bson:"maxSize"`
+	Namespace string         `bson:"namespace"`
+	Samples   int64          `bson:"samples"`
+	Warnings  []string       `bson:"warnings"`
+}
+
+// SchemaField stores stats of a field path, elements of arrays of scalars are under path[]
+type SchemaField struct {
+	ArrayLengths   []SchemaBucket   `bson:"arrayLengths,omitempty"`
+	AvgArrayLength float64          `bson:"avgArrayLength,omitempty"`
+	Count          int64            `bson:"count"`
+	MaxArrayLength int              `bson:"maxArrayLength,omitempty"`
+	MinArrayLength int              `bson:"minArrayLength,omitempty"`
+	Path           string           `bson:"path"`
+	Polymorphic    bool             `bson:"polymorphic"`
+	Presence       float64          `bson:"presence"`
+	Types          map[string]int64 `bson:"types"`
+	Values         *SchemaValues    `bson:"values,omitempty"`
+}
+
+// SchemaValues stores value distribution of a field path, dates are in milliseconds since epoch
+type SchemaValues struct {
+	Cardinality int64            `bson:"cardinality"` // distinct values, up to maxDistinctValues
+	Count       int64            `bson:"count"`
+	Enum        []interface{}    `bson:"enum,omitempty"`
+	Formats     map[string]int64 `bson:"formats,omitempty"`
+	Max         float64          `bson:"max"`
+	MaxLength   int              `bson:"maxLength,omitempty"`
+	Min         float64          `bson:"min"`
+	MinLength   int              `bson:"minLength,omitempty"`
+	Overflow    bool             `bson:"overflow,omitempty"` // more than maxDistinctValues distinct values
+	Skew        float64          `bson:"skew,omitempty"`     // zipf exponent of value frequencies
+	Weights     []int64          `bson:"weights,omitempty"`
+}
+
+// valueStats accumulates values of a field path
+type valueStats struct {
+	count     int64
+	distinct  map[string]int64
+	formats   map[string]int64
+	hasLength bool
+	hasRange  bool
+	max       float64
+	maxLength int
+	min       float64
+	minLength int
+	overflow  bool
+	values    map[string]interface{}
+}
+
+// SchemaBucket stores a histogram bucket
+type SchemaBucket struct {
+	Count int64  `bson:"count"`
+	Label string `bson:"label"`
+}
+
+// SchemaAnalyzer infers schema from sampled documents
+type SchemaAnalyzer struct {
+	arrays     map[string][]int64 // counts by arrayLengthBuckets
+	arrayMax   map[string]int
+	arrayMin   map[string]int
+	arrayTotal map[string]int64
+	counts     map[string]int64
+	docSizes   []int64 // counts by docSizeBuckets
+	maxDepth   int
+	maxFields  int
+	maxSize    int64
+	redaction  bool
+	samples    int64
+	sampleSize int
+	totalSize  int64
+	types      map[string]map[string]int64
+	values     map[string]*valueStats
+}
+
+// NewSchemaAnalyzer returns *SchemaAnalyzer
+func NewSchemaAnalyzer() *SchemaAnalyzer {
+	return &SchemaAnalyzer{arrays: map[string][]int64{}, arrayMax: map[string]int{}, arrayMin: map[string]int{},
+		arrayTotal: map[string]int64{}, counts: map[string]int64{}, docSizes: make([]int64, len(docSizeBuckets)+1),
+		sampleSize: defaultSampleSize, types: map[string]map[string]int64{}, values: map[string]*valueStats{}}
+}
+
+// SetRedaction sets redaction, string values are not kept as enums
+func (p *SchemaAnalyzer) SetRedaction(redaction bool) {
+	p.redaction = redaction
+}
+
+// SetSampleSize sets number of sampled documents
+func (p *SchemaAnalyzer) SetSampleSize(sampleSize int) {
+	p.sampleSize = sampleSize
+}
+
+// Analyze samples documents of a collection and returns inferred schema
+func (p *SchemaAnalyzer) Analyze(c *mongo.Collection) (*Schema, error) {
+	var err error
+	var cursor *mongo.Cursor
+	ctx := context.Background()
+	pipeline := mongo.Pipeline{{{Key: "$sample", Value: bson.D{{Key: "size", Value: p.sampleSize}}}}}
+	opts := options.Aggregate().SetAllowDiskUse(true)
+	if cursor, err = c.Aggregate(ctx, pipeline, opts); err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+	for cursor.Next(ctx) {
+		p.AddDocument(cursor.Current)
+	}
+	schema := p.GetSchema()
+	schema.Namespace = c.Database().Name() + "." + c.Name()
+	return schema, cursor.Err()
+}
+
+// AddDocument adds a document to the analysis
+func (p *SchemaAnalyzer) AddDocument(doc bson.Raw) {
+	size := len(doc)
+	p.samples++
+	p.totalSize += int64(size)
+	if int64(size) > p.maxSize {
+		p.maxSize = int64(size)
+	}
+	p.docSizes[getBucketIndex(docSizeBuckets, size)]++
+	seen := map[string]bool{}
+	if depth := p.walkDocument("", doc, 1, seen); depth > p.maxDepth {
+		p.maxDepth = depth
+	}
+	if len(seen) > p.maxFields {
+		p.maxFields = len(seen)
+	}
+}
+
+// walkDocument adds fields of a document and returns its nesting depth
+func (p *SchemaAnalyzer) walkDocument(prefix string, doc bson.Raw, depth int, seen map[string]bool) int {
+	maxDepth := depth
+	elems, err := doc.Elements()
+	if err != nil {
+		return maxDepth
+	}
+	for _, elem := range elems {
+		if d := p.addValue(prefix+elem.Key(), elem.Value(), depth, seen); d > maxDepth {
+			maxDepth = d
+		}
+	}
+	return maxDepth
+}
+
+// addValue adds a value of a field path and returns its nesting depth
+func (p *SchemaAnalyzer) addValue(path string, value bson.RawValue, depth int, seen map[string]bool) int {
+	if !seen[path] {
+		seen[path] = true
+		p.counts[path]++
+	}
+	if p.types[path] == nil {
+		p.types[path] = map[string]int64{}
+	}
+	p.types[path][getBSONTypeName(value.Type)]++
+	maxDepth := depth
+	if value.Type == bsontype.EmbeddedDocument {
+		return p.walkDocument(path+".", value.Document(), depth+1, seen)
+	} else if value.Type != bsontype.Array {
+		p.addScalar(path, value)
+		return maxDepth
+	}
+	values, _ := value.Array().Values()
+	if p.arrays[path] == nil {
+		p.arrays[path] = make([]int64, len(arrayLengthBuckets)+1)
+		p.arrayMin[path] = len(values)
+	}
+	if len(values) < p.arrayMin[path] {
+		p.arrayMin[path] = len(values)
+	}
+	p.arrays[path][getBucketIndex(arrayLengthBuckets, len(values))]++
+	p.arrayTotal[path] += int64(len(values))
+	if len(values) > p.arrayMax[path] {
+		p.arrayMax[path] = len(values)
+	}
+	for _, v := range values {
+		var d int
+		if v.Type == bsontype.EmbeddedDocument {
+			d = p.walkDocument(path+".", v.Document(), depth+1, seen)
+		} else {
+			d = p.addValue(path+"[]", v, depth+1, seen)
+		}
+		if d > maxDepth {
+			maxDepth = d
+		}
+	}
+	return maxDepth
+}
+
+// addScalar adds a scalar value to value stats of a field path
+func (p *SchemaAnalyzer) addScalar(path string, value bson.RawValue) {
+	var key string
+	var num float64
+	var v interface{} // nil if not counted as a distinct value
+	isNumber := true
+	switch value.Type {
+	case bsontype.Boolean:
+		isNumber = false
+		v = value.Boolean()
+		key = strconv.FormatBool(value.Boolean())
+	case bsontype.DateTime:
+		num = float64(value.DateTime())
+	case bsontype.Decimal128:
+		num, _ = strconv.ParseFloat(value.Decimal128().String(), 64)
+		v, key = num, value.Decimal128().String()
+	case bsontype.Double:
+		num = value.Double()
+		v, key = num, strconv.FormatFloat(num, 'g', -1, 64)
+	case bsontype.Int32:
+		num = float64(value.Int32())
+		v, key = value.Int32(), strconv.Itoa(int(value.Int32()))
+	case bsontype.Int64:
+		num = float64(value.Int64())
+		v, key = value.Int64(), strconv.FormatInt(value.Int64(), 10)
+	case bsontype.String:
+		isNumber = false
+		v, key = value.StringValue(), value.StringValue()
+	default:
+		return
+	}
+	stats := p.values[path]
+	if stats == nil {
+		stats = &valueStats{distinct: map[string]int64{}, formats: map[string]int64{}, values: map[string]interface{}{}}
+		p.values[path] = stats
+	}
+	stats.count++
+	if isNumber {
+		if !stats.hasRange || num < stats.min {
+			stats.min = num
+		}
+		if !stats.hasRange || num > stats.max {
+			stats.max = num
+		}
+		stats.hasRange = true
+	} else if value.Type == bsontype.String {
+		if n := len(key); !stats.hasLength || n < stats.minLength {
+			stats.minLength = n
+		}
+		if len(key) > stats.maxLength {
+			stats.maxLength = len(key)
+		}
+		stats.hasLength = true
+		for _, format := range stringFormats {
+			if format.re.MatchString(key) {
+				stats.formats[format.name]++
+				break
+			}
+		}
+	}
+	if v == nil { // dates are not counted as distinct values
+		return
+	}
+	key = value.Type.String() + ":" + key
+	if _, ok := stats.distinct[key]; ok {
+		stats.distinct[key]++
+	} else if len(stats.distinct) < maxDistinctValues {
+		stats.distinct[key] = 1
+		stats.values[key] = v
+	} else {
+		stats.overflow = true
+	}
+}
+
+// getSchemaValues returns value distribution of a field path
+func (p *SchemaAnalyzer) getSchemaValues(path string) *SchemaValues {
+	stats := p.values[path]
+	if stats == nil {
+		return nil
+	}
+	values := &SchemaValues{Cardinality: int64(len(stats.distinct)), Count: stats.count, Max: stats.max,
+		MaxLength: stats.maxLength, Min: stats.min, MinLength: stats.minLength, Overflow: stats.overflow}
+	if len(stats.formats) > 0 {
+		values.Formats = stats.formats
+	}
+	if stats.overflow || len(stats.distinct) == 0 {
+		return values
+	}
+	keys := []string{}
+	for key := range stats.distinct {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if stats.distinct[keys[i]] == stats.distinct[keys[j]] {
+			return keys[i] < keys[j]
+		}
+		return stats.distinct[keys[i]] > stats.distinct[keys[j]]
+	})
+	counts := []int64{}
+	for _, key := range keys {
+		counts = append(counts, stats.distinct[key])
+	}
+	values.Skew = getZipfSkew(counts)
+	hasString := false
+	for _, key := range keys {
+		if _, ok := stats.values[key].(string); ok {
+			hasString = true
+		}
+	}
+	if len(keys) <= maxEnumValues && int64(len(keys)*minEnumRepeats) <= stats.count && !(p.redaction && hasString) {
+		for _, key := range keys {
+			values.Enum = append(values.Enum, stats.values[key])
+		}
+		values.Weights = counts
+	}
+	return values
+}
+
+// getZipfSkew returns the exponent of a log-log fit of frequencies by rank, 0 if not skewed
+func getZipfSkew(counts []int64) float64 {
+	if len(counts) < 3 || counts[0] < 3 {
+		return 0
+	}
+	var sx, sy, sxx, sxy float64
+	for i, count := range counts {
+		x, y := math.Log(float64(i+1)), math.Log(float64(count))
+		sx, sy, sxx, sxy = sx+x, sy+y, sxx+x*x, sxy+x*y
+	}
+	n := float64(len(counts))
+	skew := -(n*sxy - sx*sy) / (n*sxx - sx*sx)
+	if skew < minZipfSkew {
+		return 0
+	}
+	return math.Round(skew*100) / 100
+}
+
+// GetSchema returns inferred schema and anti-patterns
+func (p *SchemaAnalyzer) GetSchema() *Schema {
+	schema := &Schema{MaxDepth: p.maxDepth, MaxFields: p.maxFields, MaxSize: p.maxSize, Samples: p.samples,
+		Warnings: []string{}}
+	if p.samples == 0 {
+		return schema
+	}
+	schema.AvgSize = p.totalSize / p.samples
+	schema.DocSizes = getSchemaBuckets(docSizeBuckets, p.docSizes, formatBytes)
+	paths := []string{}
+	for path := range p.counts {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	for _, path := range paths {
+		field := SchemaField{Count: p.counts[path], Path: path, Types: p.types[path],
+			Presence: 100 * float64(p.counts[path]) / float64(p.samples), Values: p.getSchemaValues(path)}
+		if types := getNonNullTypes(field.Types); isPolymorphic(types) {
+			field.Polymorphic = true
+			schema.Warnings = append(schema.Warnings, fmt.Sprintf("polymorphic field %v: %v", path, strings.Join(types, ", ")))
+		}
+		if counts := p.arrays[path]; counts != nil {
+			var n int64
+			for _, count := range counts {
+				n += count
+			}
+			field.ArrayLengths = getSchemaBuckets(arrayLengthBuckets, counts, func(n int) string { return fmt.Sprint(n) })
+			field.AvgArrayLength = float64(p.arrayTotal[path]) / float64(n)
+			field.MaxArrayLength = p.arrayMax[path]
+			field.MinArrayLength = p.arrayMin[path]
+			if field.MaxArrayLength > unboundedArrayLen {
+				schema.Warnings = append(schema.Warnings, fmt.Sprintf("unbounded array %v: up to %d elements", path, field.MaxArrayLength))
+			}
+		}
+		schema.Fields = append(schema.Fields, field)
+	}
+	if p.maxSize > hugeDocumentSize {
+		schema.Warnings = append(schema.Warnings, fmt.Sprintf("huge documents: up to %v", formatBytes(int(p.maxSize))))
+	}
+	if p.maxFields > tooManyFields {
+		schema.Warnings = append(schema.Warnings, fmt.Sprintf("too many fields: up to %d fields in a document", p.maxFields))
+	}
+	return schema
+}
+
+// Print prints schema summary
+func (s *Schema) Print() {
+	fmt.Println(s.printSchemaSummary())
+}
+
+// printSchemaSummary returns a table of field paths followed by histograms and warnings
+func (s *Schema) printSchemaSummary() string {
+	var buffer bytes.Buffer
+	buffer.WriteString(fmt.Sprintf("\n%v: %d sampled documents, avg %v, max %v, max depth %d, max fields %d\n",
+		s.Namespace, s.Samples, formatBytes(int(s.AvgSize)), formatBytes(int(s.MaxSize)), s.MaxDepth, s.MaxFields))
+	buffer.WriteString("+--------------------------------------------------+--------+----------------------------------------+---------------+\n")
+	buffer.WriteString("| Field Path                                       |presence| Types                                  | array avg/max |\n")
+	buffer.WriteString("|--------------------------------------------------+--------+----------------------------------------+---------------|\n")
+	for _, field := range s.Fields {
+		path := field.Path
+		if len(path) > 48 {
+			path = path[:45] + "..."
+		}
+		flag := " "
+		if field.Polymorphic {
+			flag = "*"
+		}
+		types := getTypeMix(field.Types)
+		if len(types) > 38 {
+			types = types[:35] + "..."
+		}
+		arrays := ""
+		if field.ArrayLengths != nil {
+			arrays = fmt.Sprintf("%.1f/%d", field.AvgArrayLength, field.MaxArrayLength)
+		}
+		buffer.WriteString(fmt.Sprintf("|%v%-48v %7.1f%% %-40v %13v |\n", flag, path, field.Presence, types, arrays))
+	}
+	buffer.WriteString("+--------------------------------------------------+--------+----------------------------------------+---------------+\n")
+	buffer.WriteString("* polymorphic field\n")
+	buffer.WriteString("document sizes:")
+	for _, bucket := range s.DocSizes {
+		if bucket.Count > 0 {
+			buffer.WriteString(fmt.Sprintf(" %v: %d", bucket.Label, bucket.Count))
+		}
+	}
+	buffer.WriteString("\n")
+	for _, warning := range s.Warnings {
+		buffer.WriteString(fmt.Sprintf("warning: %v\n", warning))
+	}
+	return buffer.String()
+}
+
+// getBucketIndex returns index of the first bucket upper bound (inclusive) not less than n
+func getBucketIndex(buckets []int, n int) int {
+	for i, bound := range buckets {
+		if n <= bound {
+			return i
+		}
+	}
+	return len(buckets)
+}
+
+// getSchemaBuckets returns labeled buckets, e.g. <=10 and >1000
+func getSchemaBuckets(buckets []int, counts []int64, format func(int) string) []SchemaBucket {
+	results := []SchemaBucket{}
+	for i, count := range counts {
+		label := ">" + format(buckets[len(buckets)-1])
+		if i < len(buckets) {
+			label = "<=" + format(buckets[i])
+		}
+		results = append(results, SchemaBucket{Count: count, Label: label})
+	}
+	return results
+}
+
+// getBSONTypeName returns $type alias of a BSON type
+func getBSONTypeName(t bsontype.Type) string {
+	if name, ok := bsonTypeNames[t]; ok {
+		return name
+	}
+	return t.String()
+}
+
+// getNonNullTypes returns sorted type names excluding null
+func getNonNullTypes(types map[string]int64) []string {
+	names := []string{}
+	for name := range types {
+		if name != "null" && name != "undefined" {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// isPolymorphic returns true if there are more than one type, of which numeric types count as one
+func isPolymorphic(types []string) bool {
+	families := map[string]bool{}
+	for _, name := range types {
+		if numericTypes[name] {
+			name = "number"
+		}
+		families[name] = true
+	}
+	return len(families) > 1
+}
+
+// getTypeMix returns types by counts in descending order, e.g. int:90,string:10
+func getTypeMix(types map[string]int64) string {
+	names := []string{}
+	for name := range types {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		if types[names[i]] == types[names[j]] {
+			return names[i] < names[j]
+		}
+		return types[names[i]] > types[names[j]]
+	})
+	strs := []string{}
+	for _, name := range names {
+		strs = append(strs, fmt.Sprintf("%v:%d", name, types[name]))
+	}
+	return strings.Join(strs, ",")
+}
+
+// formatBytes returns a human readable size, e.g. 4KB
+func formatBytes(n int) string {
+	if n >= 1024*1024 && n%(1024*1024) == 0 {
+		return fmt.Sprintf("%dMB", n/(1024*1024))
+	} else if n >= 1024*1024 {
+		return fmt.Sprintf("%.1fMB", float64(n)/(1024*1024))
+	} else if n >= 1024 && n%1024 == 0 {
+		return fmt.Sprintf("%dKB", n/1024)
+	} else if n >= 1024 {
+		return fmt.Sprintf("%.1fKB", float64(n)/1024)
+	}
+	return fmt.Sprintf("%dB", n)
+}
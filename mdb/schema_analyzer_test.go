@@ -0,0 +1,101 @@
+// Copyright 2020-present Kuei-chun Chen. All rights reserved.
+
+package mdb
+
+import (
+	"strings"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestSchemaAnalyzer(t *testing.T) {
+	analyzer := NewSchemaAnalyzer()
+	tags := make(bson.A, 1500)
+	for i := range tags {
+		tags[i] = i
+	}
+	docs := []bson.D{
+		{{Key: "_id", Value: 1}, {Key: "zip", Value: "08824"}, {Key: "tags", Value: bson.A{"a", "b"}},
+			{Key: "items", Value: bson.A{bson.D{{Key: "sku", Value: "x"}}, bson.D{{Key: "sku", Value: "y"}}}}},
+		{{Key: "_id", Value: 2}, {Key: "zip", Value: 8824}, {Key: "tags", Value: tags},
+			{Key: "address", Value: bson.D{{Key: "geo", Value: bson.D{{Key: "lat", Value: 40}}}}}},
+		{{Key: "_id", Value: 3}, {Key: "zip", Value: nil}, {Key: "address", Value: bson.D{{Key: "geo", Value: bson.D{{Key: "lat", Value: 40.5}}}}}},
+		{{Key: "_id", Value: 4}},
+	}
+	for _, doc := range docs {
+		data, err := bson.Marshal(doc)
+		if err != nil {
+			t.Fatal(err)
+		}
+		analyzer.AddDocument(data)
+	}
+	schema := analyzer.GetSchema()
+	if schema.Samples != 4 || schema.MaxDepth != 3 {
+		t.Fatal("expected 4 samples and depth 3, but got", schema.Samples, schema.MaxDepth)
+	}
+	fields := map[string]SchemaField{}
+	for _, field := range schema.Fields {
+		fields[field.Path] = field
+	}
+	if fields["_id"].Presence != 100 || fields["zip"].Presence != 75 || fields["items.sku"].Presence != 25 {
+		t.Fatal("unexpected presence", fields)
+	}
+	if !fields["zip"].Polymorphic || fields["zip"].Types["null"] != 1 || fields["_id"].Polymorphic ||
+		fields["address.geo.lat"].Polymorphic {
+		t.Fatal("expected zip to be polymorphic", fields["zip"])
+	}
+	if fields["items.sku"].Types["string"] != 2 || fields["tags[]"].Types["int"] != 1500 {
+		t.Fatal("unexpected array element types", fields["items.sku"], fields["tags[]"])
+	}
+	if fields["tags"].MaxArrayLength != 1500 || fields["tags"].AvgArrayLength != 751 {
+		t.Fatal("unexpected array lengths", fields["tags"])
+	}
+	warnings := strings.Join(schema.Warnings, "\n")
+	if !strings.Contains(warnings, "polymorphic field zip") || !strings.Contains(warnings, "polymorphic field tags[]") ||
+		!strings.Contains(warnings, "unbounded array tags") {
+		t.Fatal("missing warnings", warnings)
+	}
+	t.Log(schema.printSchemaSummary())
+}
+
+func TestSchemaValues(t *testing.T) {
+	analyzer := NewSchemaAnalyzer()
+	for i := 0; i < 1000; i++ {
+		status := "active"
+		if i%10 == 0 {
+			status = "closed"
+		}
+		doc := bson.D{{Key: "status", Value: status}, {Key: "age", Value: int32(18 + i%50)},
+			{Key: "email", Value: "ken.chen@simagix.com"}, {Key: "product", Value: int32(1000 / (i%100 + 1))}}
+		data, _ := bson.Marshal(doc)
+		analyzer.AddDocument(data)
+	}
+	schema := analyzer.GetSchema()
+	values := map[string]*SchemaValues{}
+	for _, field := range schema.Fields {
+		values[field.Path] = field.Values
+	}
+	if v := values["status"]; len(v.Enum) != 2 || v.Enum[0] != "active" || v.Weights[0] != 900 {
+		t.Fatal("expected status enum of active and closed, but got", v)
+	}
+	if v := values["age"]; v.Min != 18 || v.Max != 67 || v.Cardinality != 50 || v.Skew != 0 {
+		t.Fatal("expected uniform age of 18 to 67, but got", v)
+	}
+	if v := values["email"]; v.Formats["email"] != 1000 || v.MinLength != 20 {
+		t.Fatal("expected email format, but got", v)
+	}
+	if v := values["product"]; v.Skew < minZipfSkew || v.Enum != nil {
+		t.Fatal("expected zipf product, but got", v)
+	}
+
+	analyzer = NewSchemaAnalyzer()
+	analyzer.SetRedaction(true)
+	data, _ := bson.Marshal(bson.D{{Key: "status", Value: "active"}})
+	for i := 0; i < 10; i++ {
+		analyzer.AddDocument(data)
+	}
+	if schema = analyzer.GetSchema(); schema.Fields[0].Values.Enum != nil {
+		t.Fatal("expected no string enums when redacted, but got", schema.Fields[0].Values.Enum)
+	}
+}
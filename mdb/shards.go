@@ -101,6 +101,35 @@ func GetAllServerURIs(shards []Shard, connString connstring.ConnString) ([]strin
 	return list, nil
 }
 
+// GetDataBearingServerURIs returns URIs of all data bearing members of all shards, none of a standalone
+func GetDataBearingServerURIs(client *mongo.Client, connString connstring.ConnString) ([]string, error) {
+	var err error
+	var shards []Shard
+	var status ServerStatus
+	if status, err = GetServerStatus(client); err != nil {
+		return nil, err
+	}
+	cluster := GetClusterType(status)
+	if cluster == Sharded {
+		if shards, err = GetShards(client); err != nil {
+			return nil, err
+		}
+	} else if cluster == Replica {
+		var rs ReplSetGetStatus
+		if rs, err = GetReplSetGetStatus(client); err != nil {
+			return nil, err
+		}
+		hosts := []string{}
+		for _, member := range rs.Members {
+			if member.StateStr != "ARBITER" {
+				hosts = append(hosts, member.Name)
+			}
+		}
+		shards = []Shard{{ID: rs.Set, State: 1, Host: rs.Set + "/" + strings.Join(hosts, ",")}}
+	}
+	return GetAllServerURIs(shards, connString)
+}
+
 // GetQueryParams returns partial connection string from ConnString
 func GetQueryParams(connString connstring.ConnString, isConnectDirect bool) string {
 	ruri := ""
@@ -7,10 +7,12 @@ import (
 	"os"
 	"strconv"
 	"strings"
+	"time"
 )
 
 const (
-	outdir = "./out"
+	htmldir = "./html"
+	outdir  = "./out"
 )
 
 // CodeDefault shows default color
@@ -127,3 +129,15 @@ func DoesFileExist(filename string) bool {
 	}
 	return !info.IsDir()
 }
+
+// ParseTime parses a time string in RFC3339 or a shorter form, e.g. 2006-01-02T15:04
+func ParseTime(str string) (time.Time, error) {
+	var err error
+	var t time.Time
+	for _, layout := range []string{time.RFC3339, "2006-01-02T15:04:05", "2006-01-02T15:04", "2006-01-02"} {
+		if t, err = time.Parse(layout, str); err == nil {
+			return t, nil
+		}
+	}
+	return t, fmt.Errorf("invalid time %v", str)
+}
@@ -431,14 +431,28 @@ func (f *Seed) seedFromTemplate(client *mongo.Client) error {
 	var remaining = f.total
 	var sdoc bson.M
 	var buf []byte
-	if sdoc, err = util.GetDocByTemplate(f.file, true); err != nil {
-		return err
-	}
-	if buf, err = json.Marshal(sdoc); err != nil {
-		return err
+	var getDoc func() map[string]interface{}
+	if tmpl, terr := util.ReadDocTemplate(f.file); terr == nil { // distribution template
+		getDoc = func() map[string]interface{} {
+			doc := tmpl.GetDoc()
+			delete(doc, "_id")
+			return doc
+		}
+	} else {
+		if sdoc, err = util.GetDocByTemplate(f.file, true); err != nil {
+			return err
+		}
+		if buf, err = json.Marshal(sdoc); err != nil {
+			return err
+		}
+		doc := make(map[string]interface{})
+		json.Unmarshal(buf, &doc)
+		getDoc = func() map[string]interface{} {
+			mdoc := make(map[string]interface{})
+			util.RandomizeDocument(&mdoc, doc, false)
+			return mdoc
+		}
 	}
-	doc := make(map[string]interface{})
-	json.Unmarshal(buf, &doc)
 	collName := f.collection
 	if collName == "" {
 		collName = mdb.ExamplesCollection
@@ -484,7 +498,7 @@ func (f *Seed) seedFromTemplate(client *mongo.Client) error {
 		threads++
 		go func(num int) {
 			defer wg.Done()
-			inserted, err := populateData(c, num, doc)
+			inserted, err := populateData(c, num, getDoc)
 			remaining += (num - inserted)
 			if err != nil {
 				if mdb.IsUnauthorizedError(err) {
@@ -505,7 +519,7 @@ func (f *Seed) seedFromTemplate(client *mongo.Client) error {
 	}
 	wg.Wait()
 	if remaining > 0 {
-		inserted, _ := populateData(c, remaining, doc) // catchup
+		inserted, _ := populateData(c, remaining, getDoc) // catchup
 		remaining -= inserted
 	}
 
@@ -537,15 +551,13 @@ func getBatchSize(total int, conns int) int {
 	return size
 }
 
-func populateData(c *mongo.Collection, num int, doc map[string]interface{}) (int, error) {
+func populateData(c *mongo.Collection, num int, getDoc func() map[string]interface{}) (int, error) {
 	if num == 0 {
 		return 0, nil
 	}
 	var contentArray []interface{}
 	for n := 0; n < num; n++ {
-		mdoc := make(map[string]interface{})
-		util.RandomizeDocument(&mdoc, doc, false)
-		contentArray = append(contentArray, mdoc)
+		contentArray = append(contentArray, getDoc())
 	}
 	opts := options.InsertMany()
 	opts.SetOrdered(false) // ignore _id duplication errors
@@ -0,0 +1,177 @@
+// Copyright 2020-present Kuei-chun Chen. All rights reserved.
+
+package sim
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/simagix/keyhole/mdb"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+const resultsInterval = 10 * time.Second
+
+// OpStats stores executions, errors, and latencies in microseconds of an operation
+type OpStats struct {
+	Count   int64             `bson:"count" json:"count"`
+	Errors  int64             `bson:"errors" json:"errors"`
+	Latency mdb.LatencySketch `bson:"latency" json:"latency"`
+}
+
+// LoadInterval stores stats of operations of an interval
+type LoadInterval struct {
+	Operations map[string]*OpStats `bson:"operations" json:"operations"`
+	Seconds    int                 `bson:"seconds" json:"seconds"`
+}
+
+// LoadResults stores per-interval and per-operation stats of a load test, executions
+// of executors are counted as all
+type LoadResults struct {
+	Begin        time.Time                   `bson:"begin" json:"begin"`
+	Intervals    []LoadInterval              `bson:"intervals" json:"intervals"`
+	Operations   map[string]*OpStats         `bson:"operations" json:"operations"`
+	Transactions map[string]TransactionStats `bson:"transactions,omitempty" json:"transactions,omitempty"`
+
+	mutex        sync.Mutex
+	transactions *transactionCounter
+}
+
+// OpSummary is a summary of an operation, latencies are in microseconds
+type OpSummary struct {
+	Count     int64   `json:"count"`
+	Errors    int64   `json:"errors"`
+	Max       int     `json:"max"`
+	Name      string  `json:"name"`
+	OpsPerSec float64 `json:"opsPerSec"`
+	P50       int     `json:"p50"`
+	P95       int     `json:"p95"`
+	P99       int     `json:"p99"`
+}
+
+// IntervalSummary is a summary of operations of an interval
+type IntervalSummary struct {
+	Operations []OpSummary `json:"operations"`
+	Seconds    int         `json:"seconds"`
+}
+
+// LoadReport is a summary of a load test, operations are sorted by names to diff runs
+type LoadReport struct {
+	Begin        time.Time                   `json:"begin"`
+	Intervals    []IntervalSummary           `json:"intervals"`
+	Operations   []OpSummary                 `json:"operations"`
+	Seconds      int                         `json:"seconds"`
+	Transactions map[string]TransactionStats `json:"transactions,omitempty"`
+}
+
+// newLoadResults returns *LoadResults
+func newLoadResults(begin time.Time) *LoadResults {
+	return &LoadResults{Begin: begin, Intervals: []LoadInterval{}, Operations: map[string]*OpStats{}}
+}
+
+// record records execution times of an executor, an error is counted on operations
+// of the last result, which is the failed one if it was timed
+func (r *LoadResults) record(done time.Time, results []bson.M, err error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	n := int(done.Sub(r.Begin) / resultsInterval)
+	if n < 0 {
+		n = 0
+	}
+	for len(r.Intervals) <= n {
+		r.Intervals = append(r.Intervals, LoadInterval{Operations: map[string]*OpStats{},
+			Seconds: len(r.Intervals) * int(resultsInterval/time.Second)})
+	}
+	interval := r.Intervals[n]
+	var total time.Duration
+	for i, res := range results {
+		for name, v := range res {
+			d, ok := v.(time.Duration)
+			if !ok {
+				continue
+			}
+			total += d
+			failed := err != nil && i == len(results)-1
+			addOpStats(interval.Operations, name, d, failed)
+			addOpStats(r.Operations, name, d, failed)
+		}
+	}
+	addOpStats(interval.Operations, responseAll, total, err != nil)
+	addOpStats(r.Operations, responseAll, total, err != nil)
+}
+
+func addOpStats(ops map[string]*OpStats, name string, d time.Duration, failed bool) {
+	stats := ops[name]
+	if stats == nil {
+		stats = &OpStats{}
+		ops[name] = stats
+	}
+	stats.Count++
+	if failed {
+		stats.Errors++
+	}
+	stats.Latency.Add(int(d.Microseconds()))
+}
+
+// GetReport returns a summary of stats collected so far
+func (r *LoadResults) GetReport() LoadReport {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	secs := len(r.Intervals) * int(resultsInterval/time.Second)
+	if r.transactions != nil {
+		r.Transactions = r.transactions.get()
+	}
+	report := LoadReport{Begin: r.Begin, Intervals: []IntervalSummary{}, Seconds: secs,
+		Operations: getOpSummaries(r.Operations, float64(secs)), Transactions: r.Transactions}
+	for _, interval := range r.Intervals {
+		report.Intervals = append(report.Intervals, IntervalSummary{Seconds: interval.Seconds,
+			Operations: getOpSummaries(interval.Operations, resultsInterval.Seconds())})
+	}
+	return report
+}
+
+// getOpSummaries returns summaries of operations sorted by names
+func getOpSummaries(ops map[string]*OpStats, secs float64) []OpSummary {
+	summaries := []OpSummary{}
+	for name, stats := range ops {
+		summary := OpSummary{Count: stats.Count, Errors: stats.Errors, Name: name,
+			Max: stats.Latency.Percentile(100), P50: stats.Latency.Percentile(50),
+			P95: stats.Latency.Percentile(95), P99: stats.Latency.Percentile(99)}
+		if secs > 0 {
+			summary.OpsPerSec = float64(int(float64(stats.Count)/secs*10)) / 10
+		}
+		summaries = append(summaries, summary)
+	}
+	sort.Slice(summaries, func(i int, j int) bool {
+		return summaries[i].Name < summaries[j].Name
+	})
+	return summaries
+}
+
+// WriteFile writes the report to a JSON file
+func (r *LoadResults) WriteFile(filename string) error {
+	data, err := json.MarshalIndent(r.GetReport(), "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filename, data, 0644)
+}
+
+// Handler serves a live dashboard at /sim and the report at /sim/data
+func (rn *Runner) Handler(w http.ResponseWriter, r *http.Request) {
+	rn.mutex.RLock()
+	results := rn.Stats
+	rn.mutex.RUnlock()
+	if r.URL.Path[1:] == "sim/data" {
+		json.NewEncoder(w).Encode(results.GetReport())
+	} else if r.URL.Path[1:] == "sim" || r.URL.Path[1:] == "sim/" {
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(simHTML))
+	} else {
+		json.NewEncoder(w).Encode(bson.M{"ok": 1, "message": "hello keyhole!"})
+	}
+}
@@ -0,0 +1,70 @@
+// Copyright 2020-present Kuei-chun Chen. All rights reserved.
+
+package sim
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestLoadResults(t *testing.T) {
+	begin := time.Now()
+	results := newLoadResults(begin)
+	for i := 0; i < 30; i++ {
+		var err error
+		if i == 0 {
+			err = errors.New("timeout")
+		}
+		done := begin.Add(time.Duration(i) * time.Second)
+		results.record(done, []bson.M{{"findOne": time.Millisecond, "total": 1}}, err)
+		results.record(done, []bson.M{{"InsertOne": 2 * time.Millisecond, "FindOne": time.Millisecond}}, nil)
+	}
+	report := results.GetReport()
+	if len(report.Intervals) != 3 || report.Seconds != 30 {
+		t.Fatal("expected 3 intervals of 30 seconds, but got", len(report.Intervals), report.Seconds)
+	}
+	names := []string{}
+	for _, op := range report.Operations {
+		names = append(names, op.Name)
+	}
+	if strings.Join(names, ",") != "FindOne,InsertOne,all,findOne" {
+		t.Fatal("expected sorted operations, but got", names)
+	}
+	all, findOne := report.Operations[2], report.Operations[3]
+	if all.Count != 60 || all.Errors != 1 || findOne.Count != 30 || findOne.Errors != 1 || findOne.OpsPerSec != 1 {
+		t.Fatal("unexpected counts", all, findOne)
+	}
+	if op := report.Intervals[0].Operations[3]; op.Count != 10 || op.P50 < 900 || op.P50 > 1100 {
+		t.Fatal("unexpected interval", op)
+	}
+
+	filename := os.TempDir() + "/keyhole-results.json"
+	defer os.Remove(filename)
+	if err := results.WriteFile(filename); err != nil {
+		t.Fatal(err)
+	}
+	data, _ := os.ReadFile(filename)
+	var doc LoadReport
+	if err := json.Unmarshal(data, &doc); err != nil || len(doc.Operations) != 4 {
+		t.Fatal("unexpected results file", err, string(data))
+	}
+
+	rn := &Runner{Stats: results}
+	w := httptest.NewRecorder()
+	rn.Handler(w, httptest.NewRequest("GET", "/sim/data", nil))
+	if !strings.Contains(w.Body.String(), `"name":"findOne"`) {
+		t.Fatal("unexpected data", w.Body.String())
+	}
+	w = httptest.NewRecorder()
+	rn.Handler(w, httptest.NewRequest("GET", "/sim", nil))
+	if !strings.Contains(w.Body.String(), "Keyhole Load Test") {
+		t.Fatal("expected dashboard")
+	}
+}
@@ -0,0 +1,298 @@
+// Copyright 2020-present Kuei-chun Chen. All rights reserved.
+
+package sim
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/simagix/keyhole/mdb"
+	"github.com/simagix/keyhole/sim/util"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+const (
+	openLoopBacklog  = 10000 // scheduled operations waiting for a connection
+	openLoopInterval = 10 * time.Second
+	responseAll      = "all"
+	spikeBaseRatio   = .25 // base rate of a spike profile
+)
+
+// LoadProfile defines arrival rates of a run, constant, step[:n], linear, or spike
+type LoadProfile struct {
+	Duration time.Duration
+	Rate     float64 // peak operations per second
+	Steps    int
+	Type     string
+}
+
+// NewLoadProfile returns a load profile by spec, e.g. step:4
+func NewLoadProfile(spec string, rate float64, duration time.Duration) (*LoadProfile, error) {
+	if rate <= 0 {
+		return nil, fmt.Errorf("invalid rate %v", rate)
+	}
+	p := LoadProfile{Duration: duration, Rate: rate, Steps: 4, Type: spec}
+	if spec == "" {
+		p.Type = "constant"
+	} else if strings.HasPrefix(spec, "step:") {
+		p.Type = "step"
+		n, err := strconv.Atoi(strings.TrimPrefix(spec, "step:"))
+		if err != nil || n < 1 {
+			return nil, fmt.Errorf("invalid profile %v", spec)
+		}
+		p.Steps = n
+	}
+	if p.Type != "constant" && p.Type != "step" && p.Type != "linear" && p.Type != "spike" {
+		return nil, fmt.Errorf("profile %v is not one of constant, step[:n], linear, or spike", spec)
+	}
+	return &p, nil
+}
+
+// RateAt returns the arrival rate at an elapsed time, at least 1 per second
+func (p *LoadProfile) RateAt(elapsed time.Duration) float64 {
+	frac := float64(elapsed) / float64(p.Duration)
+	rate := p.Rate
+	switch p.Type {
+	case "step": // n equal steps up to the rate
+		rate = p.Rate * math.Min(float64(p.Steps), math.Floor(frac*float64(p.Steps))+1) / float64(p.Steps)
+	case "linear": // ramps up from 0 to the rate
+		rate = p.Rate * frac
+	case "spike": // the rate in the middle 10%, a quarter of it otherwise
+		if frac < .45 || frac >= .55 {
+			rate = p.Rate * spikeBaseRatio
+		}
+	}
+	return math.Max(1, rate)
+}
+
+// String returns the profile description
+func (p *LoadProfile) String() string {
+	if p.Type == "step" {
+		return fmt.Sprintf("step:%d to %.0f ops/sec", p.Steps, p.Rate)
+	}
+	return fmt.Sprintf("%v %.0f ops/sec", p.Type, p.Rate)
+}
+
+// OpenLoopInterval stores stats of an interval, operations are counted when scheduled
+// (target) and when completed (achieved), and latencies are in microseconds
+type OpenLoopInterval struct {
+	Achieved int64             `bson:"achieved" json:"achieved"`
+	Errors   int64             `bson:"errors" json:"errors"`
+	Latency  mdb.LatencySketch `bson:"latency" json:"latency"`
+	Seconds  int               `bson:"seconds" json:"seconds"`
+	Target   int64             `bson:"target" json:"target"`
+}
+
+// OpenLoopResults stores results of an open-loop run.  Response times are measured
+// from the intended start times, and service times from the actual start times.
+type OpenLoopResults struct {
+	Intervals []OpenLoopInterval           `bson:"intervals" json:"intervals"`
+	Profile   string                       `bson:"profile" json:"profile"`
+	Response  map[string]mdb.LatencySketch `bson:"response" json:"response"`
+	Service   map[string]mdb.LatencySketch `bson:"service" json:"service"`
+
+	begin time.Time
+	mutex sync.Mutex
+}
+
+// ticket is an operation scheduled at an intended time
+type ticket struct {
+	intended time.Time
+	seq      int
+}
+
+// newOpenLoopResults returns *OpenLoopResults
+func newOpenLoopResults(profile *LoadProfile, begin time.Time) *OpenLoopResults {
+	return &OpenLoopResults{Intervals: []OpenLoopInterval{}, Profile: profile.String(), begin: begin,
+		Response: map[string]mdb.LatencySketch{}, Service: map[string]mdb.LatencySketch{}}
+}
+
+// getInterval returns the interval of a time, locked by the caller
+func (r *OpenLoopResults) getInterval(t time.Time) *OpenLoopInterval {
+	n := int(t.Sub(r.begin) / openLoopInterval)
+	if n < 0 {
+		n = 0
+	}
+	for len(r.Intervals) <= n {
+		r.Intervals = append(r.Intervals, OpenLoopInterval{Seconds: len(r.Intervals) * int(openLoopInterval/time.Second)})
+	}
+	return &r.Intervals[n]
+}
+
+// schedule counts a scheduled operation
+func (r *OpenLoopResults) schedule(intended time.Time) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.getInterval(intended).Target++
+}
+
+// complete records latencies of a completed operation
+func (r *OpenLoopResults) complete(tk ticket, done time.Time, results []bson.M, err error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	interval := r.getInterval(done)
+	interval.Achieved++
+	if err != nil {
+		interval.Errors++
+	}
+	response := int(done.Sub(tk.intended).Microseconds())
+	interval.Latency.Add(response)
+	addSketch(r.Response, responseAll, response)
+	for _, res := range results {
+		for name, v := range res {
+			if d, ok := v.(time.Duration); ok {
+				addSketch(r.Service, name, int(d.Microseconds()))
+				if len(results) == 1 && len(res) <= 2 { // one operation of a ticket, besides total
+					addSketch(r.Response, name, response)
+				}
+			}
+		}
+	}
+}
+
+func addSketch(sketches map[string]mdb.LatencySketch, name string, value int) {
+	sketch := sketches[name]
+	sketch.Add(value)
+	sketches[name] = sketch
+}
+
+// getIntervalSummary returns a line of an interval
+func (r *OpenLoopResults) getIntervalSummary(n int) string {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if n >= len(r.Intervals) {
+		return ""
+	}
+	interval := r.Intervals[n]
+	secs := openLoopInterval.Seconds()
+	return fmt.Sprintf("open loop [%4ds] target %8.1f ops/sec, achieved %8.1f ops/sec, errors %d, p50 %v, p99 %v",
+		interval.Seconds, float64(interval.Target)/secs, float64(interval.Achieved)/secs, interval.Errors,
+		formatMicros(interval.Latency.Percentile(50)), formatMicros(interval.Latency.Percentile(99)))
+}
+
+// Print prints the summary of an open-loop run
+func (r *OpenLoopResults) Print() {
+	fmt.Println(r.printOpenLoopSummary())
+}
+
+// printOpenLoopSummary returns throughputs and latencies by operations
+func (r *OpenLoopResults) printOpenLoopSummary() string {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	var buffer bytes.Buffer
+	var target, achieved, errors int64
+	for _, interval := range r.Intervals {
+		target, achieved, errors = target+interval.Target, achieved+interval.Achieved, errors+interval.Errors
+	}
+	secs := float64(len(r.Intervals)) * openLoopInterval.Seconds()
+	if secs == 0 {
+		secs = 1
+	}
+	buffer.WriteString(fmt.Sprintf("\nOpen loop %v: target %.1f ops/sec, achieved %.1f ops/sec, %d errors\n",
+		r.Profile, float64(target)/secs, float64(achieved)/secs, errors))
+	buffer.WriteString("+----------------------+----------+----------+----------+----------+----------+----------+\n")
+	buffer.WriteString("| Operation            |  Count   | svc p50  | svc p99  | resp p50 | resp p99 | resp max |\n")
+	buffer.WriteString("|----------------------+----------+----------+----------+----------+----------+----------|\n")
+	names := []string{}
+	for name := range r.Response {
+		names = append(names, name)
+	}
+	for name := range r.Service {
+		if _, ok := r.Response[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		svc, resp := r.Service[name], r.Response[name]
+		count := resp.Total()
+		if count == 0 {
+			count = svc.Total()
+		}
+		label := name
+		if len(label) > 20 {
+			label = label[:17] + "..."
+		}
+		buffer.WriteString(fmt.Sprintf("| %-20v %10d %10v %10v %10v %10v %10v |\n", label, count,
+			formatMicros(svc.Percentile(50)), formatMicros(svc.Percentile(99)), formatMicros(resp.Percentile(50)),
+			formatMicros(resp.Percentile(99)), formatMicros(resp.Percentile(100))))
+	}
+	buffer.WriteString("+----------------------+----------+----------+----------+----------+----------+----------+\n")
+	buffer.WriteString("svc: service time from actual starts, resp: response time from intended starts\n")
+	return buffer.String()
+}
+
+// formatMicros returns a readable duration of microseconds, - if none
+func formatMicros(micros int) string {
+	if micros <= 0 {
+		return "-"
+	}
+	return (time.Duration(micros) * time.Microsecond).String()
+}
+
+// RunOpenLoop issues operations at the arrival rates of a profile regardless of
+// completions, from a pool of connections, until the profile duration ends
+func (rn *Runner) RunOpenLoop(profile *LoadProfile) error {
+	tickets := make(chan ticket, openLoopBacklog)
+	begin := time.Now()
+	results := newOpenLoopResults(profile, begin)
+	rn.mutex.Lock()
+	rn.OpenLoop = results
+	stats := rn.Stats
+	rn.mutex.Unlock()
+	var wg sync.WaitGroup
+	for i := 0; i < rn.conns; i++ {
+		exec, closeFunc, err := rn.getExecutor(i)
+		if err != nil {
+			close(tickets)
+			return err
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer closeFunc()
+			for tk := range tickets {
+				doc := util.CloneDoc(simDocs[tk.seq%len(simDocs)])
+				res, err := exec(doc)
+				done := time.Now()
+				results.complete(tk, done, res, err)
+				stats.record(done, res, err)
+			}
+		}()
+	}
+	quit := make(chan bool)
+	go func() { // reports completed intervals
+		ticker := time.NewTicker(openLoopInterval)
+		defer ticker.Stop()
+		for n := 0; ; n++ {
+			select {
+			case <-quit:
+				return
+			case <-ticker.C:
+				if str := results.getIntervalSummary(n); str != "" {
+					rn.channel <- str
+				}
+			}
+		}
+	}()
+	rn.Logger.Info("open loop ", profile.String(), " for ", profile.Duration, " with ", rn.conns, " connections")
+	next := begin
+	for seq := 0; next.Sub(begin) < profile.Duration; seq++ {
+		if d := time.Until(next); d > 0 {
+			time.Sleep(d)
+		}
+		results.schedule(next)
+		tickets <- ticket{intended: next, seq: seq} // blocked if backlogged, intended times stay on schedule
+		next = next.Add(time.Duration(float64(time.Second) / profile.RateAt(next.Sub(begin))))
+	}
+	close(tickets)
+	wg.Wait()
+	close(quit)
+	return nil
+}
@@ -0,0 +1,70 @@
+// Copyright 2020-present Kuei-chun Chen. All rights reserved.
+
+package sim
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestLoadProfile(t *testing.T) {
+	duration := 100 * time.Second
+	if _, err := NewLoadProfile("ramp", 100, duration); err == nil {
+		t.Fatal("expected error")
+	}
+	if _, err := NewLoadProfile("", 0, duration); err == nil {
+		t.Fatal("expected error")
+	}
+	expected := map[string][]float64{ // rates at 0s, 30s, 50s, and 99s
+		"":       {100, 100, 100, 100},
+		"step:4": {25, 50, 75, 100},
+		"linear": {1, 30, 50, 99},
+		"spike":  {25, 25, 100, 25},
+	}
+	for spec, rates := range expected {
+		profile, err := NewLoadProfile(spec, 100, duration)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i, secs := range []int{0, 30, 50, 99} {
+			if rate := profile.RateAt(time.Duration(secs) * time.Second); rate != rates[i] {
+				t.Fatal(spec, "expected", rates[i], "at", secs, "but got", rate)
+			}
+		}
+	}
+}
+
+func TestOpenLoopResults(t *testing.T) {
+	profile, _ := NewLoadProfile("", 10, time.Minute)
+	begin := time.Now()
+	results := newOpenLoopResults(profile, begin)
+	for i := 0; i < 20; i++ {
+		intended := begin.Add(time.Duration(i) * 100 * time.Millisecond)
+		results.schedule(intended)
+		// service time is 1ms, but each operation starts 1 second late
+		res := []bson.M{{"findOne": time.Millisecond, "total": 1}}
+		var err error
+		if i == 0 {
+			err = errors.New("timeout")
+		}
+		results.complete(ticket{intended: intended, seq: i}, intended.Add(time.Second), res, err)
+	}
+	interval := results.Intervals[0]
+	if interval.Target != 20 || interval.Achieved != 20 || interval.Errors != 1 {
+		t.Fatal("unexpected interval", interval)
+	}
+	if p50 := results.Response["findOne"].Percentile(50); p50 < 900000 {
+		t.Fatal("expected response time of about 1 second, but got", p50)
+	}
+	if p50 := results.Service["findOne"].Percentile(50); p50 > 1100 {
+		t.Fatal("expected service time of about 1ms, but got", p50)
+	}
+	if str := results.getIntervalSummary(0); !strings.Contains(str, "target      2.0 ops/sec") {
+		t.Fatal("unexpected summary", str)
+	}
+	t.Log(results.printOpenLoopSummary())
+}
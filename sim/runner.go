@@ -31,9 +31,12 @@ const (
 
 // Runner -
 type Runner struct {
-	Logger  *gox.Logger         `bson:"keyhole"`
-	Metrics map[string][]bson.M `bson:"metrics"`
-	Results []string            `bson:"results"`
+	Logger   *gox.Logger         `bson:"keyhole"`
+	Metrics  map[string][]bson.M `bson:"metrics"`
+	OpenLoop *OpenLoopResults    `bson:"openLoop,omitempty"`
+	Results  []string            `bson:"results"`
+	Sharding *ShardingReport     `bson:"sharding,omitempty"`
+	Stats    *LoadResults        `bson:"stats"`
 
 	auto           bool
 	channel        chan string
@@ -48,12 +51,19 @@ type Runner struct {
 	filename       string
 	mutex          sync.RWMutex
 	peek           bool
+	profile        string
+	rate           float64
+	shardKey       string
 	simOnly        bool
+	splitStrategy  string
 	tps            int
+	transactions   []Transaction
 	txFilename     string
 	uri            string
 	uriList        []string
 	verbose        bool
+	workload       *Workload
+	workloadName   string
 }
 
 // NewRunner - Constructor
@@ -61,7 +71,7 @@ func NewRunner(connString connstring.ConnString) (*Runner, error) {
 	var err error
 	runner := Runner{Logger: gox.GetLogger("keyhole"), connString: connString, conns: runtime.NumCPU(),
 		channel: make(chan string), collectionName: mdb.ExamplesCollection, Metrics: map[string][]bson.M{},
-		mutex: sync.RWMutex{}}
+		mutex: sync.RWMutex{}, Stats: newLoadResults(time.Now())}
 	runner.dbName = connString.Database
 	if runner.dbName == "" {
 		runner.dbName = mdb.KeyholeDB
@@ -148,6 +158,31 @@ func (rn *Runner) SetTransactionTemplate(filename string) {
 	rn.txFilename = filename
 }
 
+// SetWorkload sets a workload file or a preset, ycsb-a to ycsb-f
+func (rn *Runner) SetWorkload(name string) {
+	rn.workloadName = name
+}
+
+// SetRate sets the open-loop arrival rate in operations per second, 0 for closed loops
+func (rn *Runner) SetRate(rate float64) {
+	rn.rate = rate
+}
+
+// SetProfile sets the ramp profile of open loops, constant, step[:n], linear, or spike
+func (rn *Runner) SetProfile(profile string) {
+	rn.profile = profile
+}
+
+// SetShardKey sets the shard key of the load test collection, e.g. {"email": "hashed"}
+func (rn *Runner) SetShardKey(shardKey string) {
+	rn.shardKey = shardKey
+}
+
+// SetSplitStrategy sets how to distribute chunks, presplit, balancer, or zones
+func (rn *Runner) SetSplitStrategy(strategy string) {
+	rn.splitStrategy = strategy
+}
+
 // SetSimOnlyMode -
 func (rn *Runner) SetSimOnlyMode(mode bool) {
 	rn.simOnly = mode
@@ -169,6 +204,18 @@ func (rn *Runner) Start() error {
 		}
 	}
 	rn.Logger.Info("Duration in minute(s):", rn.duration)
+	if rn.splitStrategy == "" {
+		rn.splitStrategy = SplitPresplit
+	} else if rn.splitStrategy != SplitBalancer && rn.splitStrategy != SplitPresplit && rn.splitStrategy != SplitZones {
+		return fmt.Errorf("split strategy %v is not one of %v, %v, or %v", rn.splitStrategy, SplitPresplit, SplitBalancer, SplitZones)
+	}
+	if rn.shardKey != "" {
+		if _, err = parseShardKey(rn.shardKey); err != nil {
+			return err
+		} else if rn.clusterType != mdb.Sharded {
+			rn.Logger.Warn("shard key ignored, not a sharded cluster")
+		}
+	}
 	if rn.dbName == "" || rn.dbName == "admin" || rn.dbName == "config" || rn.dbName == "local" {
 		rn.dbName = mdb.KeyholeDB // switch to _KEYHOLE_88800 database for load tests
 	}
@@ -176,7 +223,37 @@ func (rn *Runner) Start() error {
 		rn.Cleanup()
 	}
 	rn.initSimDocs()
+	rn.mutex.Lock()
+	rn.Stats = newLoadResults(time.Now())
+	rn.mutex.Unlock()
+	if rn.workloadName != "" {
+		if rn.workload, err = GetWorkload(rn.workloadName); err != nil {
+			return err
+		}
+		rn.workload.init(rn.dbName, rn.collectionName)
+		rn.Stats.transactions = &rn.workload.transactions
+		rn.Logger.Info(rn.workload.String())
+		if err = rn.workload.Preload(rn.client); err != nil {
+			return err
+		}
+	}
 	tdoc := GetTransactions(rn.txFilename)
+	rn.transactions = tdoc.Transactions
+	if rn.rate > 0 { // open loop
+		var profile *LoadProfile
+		if profile, err = NewLoadProfile(rn.profile, rn.rate, time.Duration(rn.duration)*time.Minute); err != nil {
+			return err
+		}
+		if !rn.simOnly {
+			rn.createIndexes(tdoc.Indexes)
+		}
+		go func() {
+			if err := rn.RunOpenLoop(profile); err != nil {
+				rn.Logger.Error(err)
+			}
+		}()
+		return nil
+	}
 	// Simulation mode
 	// 1st minute - build up data and memory
 	// 2nd and 3rd minutes - normal TPS ops
@@ -190,7 +267,7 @@ func (rn *Runner) Start() error {
 	}
 	for i := 0; i < rn.conns; i++ {
 		go func(thread int) {
-			if !rn.simOnly && rn.duration > 0 {
+			if !rn.simOnly && rn.duration > 0 && rn.workload == nil {
 				if err = rn.PopulateData(); err != nil {
 					rn.Logger.Info("Thread", thread, "existing with", err)
 					return
@@ -215,6 +292,27 @@ func (rn *Runner) terminate() {
 	var result string
 
 	os.Mkdir(outdir, 0755)
+	hostname, _ := os.Hostname()
+	rn.mutex.Lock()
+	if rn.OpenLoop != nil {
+		rn.OpenLoop.Print()
+	}
+	if rn.workload != nil {
+		fmt.Print(rn.workload.printTransactionsSummary())
+	}
+	if rn.Sharding != nil { // before the collection is dropped
+		if err = rn.collectShardingReport(); err != nil {
+			rn.Logger.Error(err)
+		}
+		rn.Sharding.Print()
+	}
+	ofile := fmt.Sprintf(`%s/%s.%s-results.json`, outdir, hostname, fileTimestamp)
+	if err = rn.Stats.WriteFile(ofile); err != nil {
+		rn.Logger.Error(err)
+	} else {
+		rn.Logger.Info("results written to ", ofile)
+	}
+	rn.mutex.Unlock()
 	rn.Cleanup()
 	rn.Results = []string{}
 	for _, uri := range rn.uriList {
@@ -261,7 +359,6 @@ func (rn *Runner) terminate() {
 		fmt.Println(result)
 		rn.Results = append(rn.Results, result)
 	}
-	hostname, _ := os.Hostname()
 	filename = fmt.Sprintf(`%s/%s.%s-perf.bson.gz`, outdir, hostname, fileTimestamp)
 	var buf []byte
 	if buf, err = bson.Marshal(rn); err != nil {
@@ -332,12 +429,22 @@ func (rn *Runner) createIndexes(docs []bson.M) error {
 			return err
 		}
 
-		if rn.clusterType == mdb.Sharded {
+		if rn.clusterType == mdb.Sharded && rn.shardKey == "" {
 			if err = rn.splitChunks(); err != nil {
 				fmt.Println(err)
+			} else {
+				rn.startShardingReport(bson.D{{Key: "email", Value: 1}}, SplitPresplit)
 			}
 		}
 	}
+	if rn.clusterType == mdb.Sharded && rn.shardKey != "" {
+		key, _ := parseShardKey(rn.shardKey) // validated by Start
+		if err = rn.shardCollection(key); err != nil {
+			fmt.Println(err)
+		} else {
+			rn.startShardingReport(key, rn.splitStrategy)
+		}
+	}
 
 	for _, doc := range docs {
 		keys := bson.D{}
@@ -0,0 +1,382 @@
+// Copyright 2020-present Kuei-chun Chen. All rights reserved.
+
+package sim
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/simagix/keyhole/mdb"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// pre-split strategies of a sharded collection
+const (
+	SplitBalancer = "balancer" // leaves chunks to the balancer
+	SplitPresplit = "presplit" // splits and moves a chunk to each shard
+	SplitZones    = "zones"    // creates a zone of a key range on each shard
+)
+
+const zonePrefix = "keyhole-"
+
+// ShardStats stores operations routed to a shard, and chunks and documents on it.  New chunks
+// and new jumbo chunks are changes since the start of a load test.
+type ShardStats struct {
+	Chunks    int64  `bson:"chunks"`
+	Commands  int64  `bson:"commands"`
+	Docs      int64  `bson:"docs"`
+	Jumbo     int64  `bson:"jumbo"`
+	NewChunks int64  `bson:"newChunks"`
+	NewJumbo  int64  `bson:"newJumbo"`
+	Reads     int64  `bson:"reads"`
+	Shard     string `bson:"shard"`
+	Writes    int64  `bson:"writes"`
+}
+
+// ShardingReport stores per-shard stats and chunk migrations of a load test
+type ShardingReport struct {
+	Migrations int64        `bson:"migrations"`
+	Namespace  string       `bson:"ns"`
+	ShardKey   string       `bson:"shardKey"`
+	Shards     []ShardStats `bson:"shards"`
+	Strategy   string       `bson:"strategy"`
+
+	baseline map[string]ShardStats
+	begin    time.Time
+}
+
+// parseShardKey returns a shard key of a JSON document, e.g. {"region": 1, "email": "hashed"}
+func parseShardKey(str string) (bson.D, error) {
+	var key bson.D
+	if err := bson.UnmarshalExtJSON([]byte(str), false, &key); err != nil {
+		return nil, fmt.Errorf("invalid shard key %v: %v", str, err)
+	}
+	if len(key) == 0 {
+		return nil, errors.New("empty shard key")
+	}
+	hashed := 0
+	for _, e := range key {
+		if e.Value == "hashed" {
+			hashed++
+		} else if mdb.ToInt(e.Value) != 1 {
+			return nil, fmt.Errorf("shard key field %v must be 1 or hashed", e.Key)
+		}
+	}
+	if hashed > 1 {
+		return nil, errors.New("only one hashed field is allowed")
+	}
+	return key, nil
+}
+
+// getShardKeyString returns a shard key in JSON
+func getShardKeyString(key bson.D) string {
+	data, _ := bson.MarshalExtJSON(key, false, false)
+	return string(data)
+}
+
+// isHashedPrefix returns true if the first field of a shard key is hashed
+func isHashedPrefix(key bson.D) bool {
+	return key[0].Value == "hashed"
+}
+
+// getSplitPoints returns n-1 shard key values splitting the key space into n ranges.
+// Hashed prefixes split the int64 space evenly, ranged prefixes split by quantiles
+// of values of sim docs, and remaining fields are MinKey.
+func getSplitPoints(key bson.D, n int, docs []bson.M) ([]bson.D, error) {
+	points := []bson.D{}
+	if n < 2 {
+		return points, nil
+	}
+	values := []interface{}{}
+	field := key[0].Key
+	if isHashedPrefix(key) {
+		lowest := int64(math.MinInt64)
+		step := uint64(math.MaxUint64) / uint64(n)
+		for i := 1; i < n; i++ {
+			values = append(values, int64(uint64(lowest)+uint64(i)*step))
+		}
+	} else {
+		distinct := map[interface{}]bool{}
+		for _, doc := range docs {
+			if v := getFieldValue(doc, field); v != nil {
+				distinct[v] = true
+			}
+		}
+		strs, nums := []string{}, []float64{}
+		for v := range distinct {
+			if s, ok := v.(string); ok {
+				strs = append(strs, s)
+			} else if f, ok := toFloat(v); ok {
+				nums = append(nums, f)
+			}
+		}
+		sort.Strings(strs)
+		sort.Float64s(nums)
+		if len(strs) >= n {
+			for i := 1; i < n; i++ {
+				values = append(values, strs[i*len(strs)/n])
+			}
+		} else if len(nums) >= n {
+			for i := 1; i < n; i++ {
+				values = append(values, nums[i*len(nums)/n])
+			}
+		} else {
+			return nil, fmt.Errorf("unable to derive split points of %v from sim docs, use -split %v", field, SplitBalancer)
+		}
+	}
+	for _, v := range values {
+		point := bson.D{{Key: field, Value: v}}
+		for _, e := range key[1:] {
+			point = append(point, bson.E{Key: e.Key, Value: primitive.MinKey{}})
+		}
+		points = append(points, point)
+	}
+	return points, nil
+}
+
+// getBounds returns ranges of split points, from MinKey to MaxKey
+func getBounds(key bson.D, points []bson.D) [][2]bson.D {
+	min, max := bson.D{}, bson.D{}
+	for _, e := range key {
+		min = append(min, bson.E{Key: e.Key, Value: primitive.MinKey{}})
+		max = append(max, bson.E{Key: e.Key, Value: primitive.MaxKey{}})
+	}
+	bounds := [][2]bson.D{}
+	lower := min
+	for _, point := range points {
+		bounds = append(bounds, [2]bson.D{lower, point})
+		lower = point
+	}
+	return append(bounds, [2]bson.D{lower, max})
+}
+
+// getFieldValue returns a value of a dotted field path
+func getFieldValue(doc bson.M, path string) interface{} {
+	var v interface{} = doc
+	for _, name := range strings.Split(path, ".") {
+		m, ok := v.(bson.M)
+		if !ok {
+			if mi, ok := v.(map[string]interface{}); ok {
+				m = bson.M(mi)
+			} else {
+				return nil
+			}
+		}
+		v = m[name]
+	}
+	switch v.(type) {
+	case bson.M, map[string]interface{}, []interface{}, bson.A:
+		return nil
+	}
+	return v
+}
+
+func toFloat(v interface{}) (float64, bool) {
+	switch n := v.(type) {
+	case int:
+		return float64(n), true
+	case int32:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	case float64:
+		return n, true
+	}
+	return 0, false
+}
+
+// shardCollection shards the load test collection by a shard key and a split strategy
+func (rn *Runner) shardCollection(key bson.D) error {
+	var err error
+	var shards []mdb.Shard
+	ctx := context.Background()
+	admin := rn.client.Database("admin")
+	ns := rn.dbName + "." + rn.collectionName
+	if shards, err = mdb.GetShards(rn.client); err != nil {
+		return err
+	}
+	rn.Logger.Info(fmt.Sprintf("sharding %v by %v, %v", ns, getShardKeyString(key), rn.splitStrategy))
+	if err = admin.RunCommand(ctx, bson.D{{Key: "enableSharding", Value: rn.dbName}}).Err(); err != nil {
+		return err
+	}
+	cmd := bson.D{{Key: "shardCollection", Value: ns}, {Key: "key", Value: key}}
+	if isHashedPrefix(key) && len(key) == 1 && rn.splitStrategy == SplitPresplit {
+		cmd = append(cmd, bson.E{Key: "numInitialChunks", Value: 2 * len(shards)})
+	}
+	if err = admin.RunCommand(ctx, cmd).Err(); err != nil {
+		return err
+	}
+	if rn.splitStrategy == SplitBalancer || len(shards) < 2 {
+		return nil
+	}
+	if isHashedPrefix(key) && rn.splitStrategy == SplitPresplit {
+		return nil // distributed by numInitialChunks, or by the balancer of compound hashed keys
+	}
+	var points []bson.D
+	if points, err = getSplitPoints(key, len(shards), simDocs); err != nil {
+		return err
+	}
+	bounds := getBounds(key, points)
+	for _, point := range points {
+		if isHashedPrefix(key) { // chunks are split by the balancer at zone boundaries
+			break
+		}
+		if err = admin.RunCommand(ctx, bson.D{{Key: "split", Value: ns}, {Key: "middle", Value: point}}).Err(); err != nil {
+			return err
+		}
+	}
+	for i, bound := range bounds {
+		shard := shards[i%len(shards)].ID
+		if rn.splitStrategy == SplitZones {
+			zone := zonePrefix + shard
+			if err = admin.RunCommand(ctx, bson.D{{Key: "addShardToZone", Value: shard}, {Key: "zone", Value: zone}}).Err(); err != nil {
+				return err
+			}
+			cmd = bson.D{{Key: "updateZoneKeyRange", Value: ns}, {Key: "min", Value: bound[0]},
+				{Key: "max", Value: bound[1]}, {Key: "zone", Value: zone}}
+		} else {
+			cmd = bson.D{{Key: "moveChunk", Value: ns}, {Key: "bounds", Value: bson.A{bound[0], bound[1]}}, {Key: "to", Value: shard}}
+		}
+		if err = admin.RunCommand(ctx, cmd).Err(); err != nil {
+			rn.Logger.Info(err) // could be on the shard already
+		}
+	}
+	return nil
+}
+
+// startShardingReport records baseline stats of the load test collection
+func (rn *Runner) startShardingReport(key bson.D, strategy string) {
+	report := &ShardingReport{Namespace: rn.dbName + "." + rn.collectionName, ShardKey: getShardKeyString(key),
+		Strategy: strategy, begin: time.Now()}
+	report.baseline, _ = rn.getShardStats(report.Namespace)
+	rn.mutex.Lock()
+	rn.Sharding = report
+	rn.mutex.Unlock()
+}
+
+// collectShardingReport collects per-shard stats, migrations, and jumbo chunks since the baseline
+func (rn *Runner) collectShardingReport() error {
+	var err error
+	var stats map[string]ShardStats
+	ctx := context.Background()
+	report := rn.Sharding
+	if stats, err = rn.getShardStats(report.Namespace); err != nil {
+		return err
+	}
+	config := rn.client.Database("config")
+	filter := bson.M{"what": "moveChunk.commit", "ns": report.Namespace, "time": bson.M{"$gte": report.begin}}
+	if report.Migrations, err = config.Collection("changelog").CountDocuments(ctx, filter); err != nil {
+		return err
+	}
+	report.Shards = []ShardStats{}
+	for shard, s := range stats {
+		base := report.baseline[shard]
+		s.Commands, s.Reads, s.Writes = s.Commands-base.Commands, s.Reads-base.Reads, s.Writes-base.Writes
+		s.NewChunks, s.NewJumbo = s.Chunks-base.Chunks, s.Jumbo-base.Jumbo
+		report.Shards = append(report.Shards, s)
+	}
+	sort.Slice(report.Shards, func(i int, j int) bool {
+		return report.Shards[i].Shard < report.Shards[j].Shard
+	})
+	return nil
+}
+
+// getShardStats returns latency stats, document counts, and chunks by shards
+func (rn *Runner) getShardStats(ns string) (map[string]ShardStats, error) {
+	var err error
+	var cursor *mongo.Cursor
+	ctx := context.Background()
+	stats := map[string]ShardStats{}
+	c := getCollection(rn.client, ns)
+	pipeline := mongo.Pipeline{{{Key: "$collStats", Value: bson.M{"latencyStats": bson.M{}, "storageStats": bson.M{}}}}}
+	if cursor, err = c.Aggregate(ctx, pipeline); err != nil {
+		return stats, err
+	}
+	for cursor.Next(ctx) {
+		var doc struct {
+			LatencyStats map[string]struct {
+				Ops int64 `bson:"ops"`
+			} `bson:"latencyStats"`
+			Shard        string `bson:"shard"`
+			StorageStats struct {
+				Count int64 `bson:"count"`
+			} `bson:"storageStats"`
+		}
+		if err = cursor.Decode(&doc); err != nil {
+			continue
+		}
+		stats[doc.Shard] = ShardStats{Commands: doc.LatencyStats["commands"].Ops, Docs: doc.StorageStats.Count,
+			Reads: doc.LatencyStats["reads"].Ops, Shard: doc.Shard, Writes: doc.LatencyStats["writes"].Ops}
+	}
+	cursor.Close(ctx)
+
+	config := rn.client.Database("config")
+	coll := bson.M{}
+	config.Collection("collections").FindOne(ctx, bson.M{"_id": ns}).Decode(&coll)
+	match := bson.M{"ns": ns} // chunks are by collection uuid since v5.0
+	if coll["uuid"] != nil {
+		match = bson.M{"$or": []bson.M{{"ns": ns}, {"uuid": coll["uuid"]}}}
+	}
+	pipeline = mongo.Pipeline{{{Key: "$match", Value: match}}, {{Key: "$group", Value: bson.M{"_id": "$shard",
+		"chunks": bson.M{"$sum": 1}, "jumbo": bson.M{"$sum": bson.M{"$cond": bson.A{"$jumbo", 1, 0}}}}}}}
+	if cursor, err = config.Collection("chunks").Aggregate(ctx, pipeline); err != nil {
+		return stats, err
+	}
+	defer cursor.Close(ctx)
+	for cursor.Next(ctx) {
+		var doc struct {
+			Chunks int64  `bson:"chunks"`
+			ID     string `bson:"_id"`
+			Jumbo  int64  `bson:"jumbo"`
+		}
+		if err = cursor.Decode(&doc); err != nil {
+			continue
+		}
+		s := stats[doc.ID]
+		s.Shard, s.Chunks, s.Jumbo = doc.ID, doc.Chunks, doc.Jumbo
+		stats[doc.ID] = s
+	}
+	return stats, nil
+}
+
+// Print prints the sharding report
+func (r *ShardingReport) Print() {
+	fmt.Println(r.printShardingSummary())
+}
+
+// printShardingSummary returns operations routed, chunks, and documents by shards
+func (r *ShardingReport) printShardingSummary() string {
+	var buffer bytes.Buffer
+	var total int64
+	for _, s := range r.Shards {
+		total += s.Reads + s.Writes + s.Commands
+	}
+	buffer.WriteString(fmt.Sprintf("\nSharding %v by %v (%v), %d chunk migrations\n", r.Namespace, r.ShardKey, r.Strategy, r.Migrations))
+	buffer.WriteString("+----------------------+----------+----------+----------+--------+----------+---------------+---------------+\n")
+	buffer.WriteString("| Shard                |  Reads   |  Writes  | Commands |  Ops%  |   Docs   |  Chunks (new) |   Jumbo (new) |\n")
+	buffer.WriteString("|----------------------+----------+----------+----------+--------+----------+---------------+---------------|\n")
+	for _, s := range r.Shards {
+		pct := float64(0)
+		if total > 0 {
+			pct = 100 * float64(s.Reads+s.Writes+s.Commands) / float64(total)
+		}
+		label := s.Shard
+		if len(label) > 20 {
+			label = label[:17] + "..."
+		}
+		chunks := fmt.Sprintf("%d (%+d)", s.Chunks, s.NewChunks)
+		jumbo := fmt.Sprintf("%d (%+d)", s.Jumbo, s.NewJumbo)
+		buffer.WriteString(fmt.Sprintf("| %-20v %10d %10d %10d %7.1f%% %10d %15v %15v |\n", label, s.Reads, s.Writes,
+			s.Commands, pct, s.Docs, chunks, jumbo))
+	}
+	buffer.WriteString("+----------------------+----------+----------+----------+--------+----------+---------------+---------------+\n")
+	return buffer.String()
+}
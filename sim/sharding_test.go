@@ -0,0 +1,85 @@
+// Copyright 2020-present Kuei-chun Chen. All rights reserved.
+
+package sim
+
+import (
+	"math"
+	"strings"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestParseShardKey(t *testing.T) {
+	for _, str := range []string{`{}`, `{"a": -1}`, `{"a": "hashed", "b": "hashed"}`, `a:1`} {
+		if _, err := parseShardKey(str); err == nil {
+			t.Fatal("expected error", str)
+		}
+	}
+	key, err := parseShardKey(`{"region": 1, "email": "hashed"}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if key[0].Key != "region" || isHashedPrefix(key) || getShardKeyString(key) != `{"region":1,"email":"hashed"}` {
+		t.Fatal("unexpected shard key", key)
+	}
+}
+
+func TestGetSplitPoints(t *testing.T) {
+	key, _ := parseShardKey(`{"email": "hashed"}`)
+	points, err := getSplitPoints(key, 4, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(points) != 3 || math.Abs(float64(points[1][0].Value.(int64))) > 10 || points[0][0].Value.(int64) > math.MinInt64/2 {
+		t.Fatal("expected the int64 space split evenly, but got", points)
+	}
+
+	key, _ = parseShardKey(`{"email": 1, "ts": 1}`)
+	if _, err = getSplitPoints(key, 2, []bson.M{{"email": "john.doe@keyhole.dev"}}); err == nil {
+		t.Fatal("expected error of fewer distinct emails than shards")
+	}
+	emails := []bson.M{}
+	for _, name := range []string{"d", "a", "c", "b"} {
+		emails = append(emails, bson.M{"email": name + "@keyhole.dev"})
+	}
+	if points, err = getSplitPoints(key, 2, emails); err != nil {
+		t.Fatal(err)
+	}
+	if points[0][0].Value != "c@keyhole.dev" || points[0][1].Value != (primitive.MinKey{}) {
+		t.Fatal("unexpected email split points", points)
+	}
+
+	docs := []bson.M{}
+	for i := 0; i < 100; i++ {
+		docs = append(docs, bson.M{"address": bson.M{"zip": int32(i)}})
+	}
+	key, _ = parseShardKey(`{"address.zip": 1}`)
+	if points, err = getSplitPoints(key, 4, docs); err != nil {
+		t.Fatal(err)
+	}
+	if points[0][0].Value != float64(25) || points[2][0].Value != float64(75) {
+		t.Fatal("expected quartiles, but got", points)
+	}
+	bounds := getBounds(key, points)
+	if len(bounds) != 4 || bounds[0][0][0].Value != (primitive.MinKey{}) || bounds[3][1][0].Value != (primitive.MaxKey{}) {
+		t.Fatal("unexpected bounds", bounds)
+	}
+
+	key, _ = parseShardKey(`{"region": 1}`)
+	if _, err = getSplitPoints(key, 4, docs); err == nil {
+		t.Fatal("expected error of a field not in sim docs")
+	}
+}
+
+func TestShardingReport(t *testing.T) {
+	report := ShardingReport{Migrations: 2, Namespace: "_KEYHOLE_88800.examples", ShardKey: `{"email":"hashed"}`,
+		Strategy: SplitZones, Shards: []ShardStats{{Chunks: 2, Docs: 300, Reads: 600, Shard: "shard01", Writes: 200},
+			{Chunks: 3, Docs: 100, Jumbo: 1, NewChunks: 1, NewJumbo: 1, Reads: 150, Shard: "shard02", Writes: 50}}}
+	str := report.printShardingSummary()
+	if !strings.Contains(str, "2 chunk migrations") || !strings.Contains(str, "80.0%") || !strings.Contains(str, "3 (+1)") {
+		t.Fatal("unexpected summary", str)
+	}
+	t.Log(str)
+}
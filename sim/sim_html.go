@@ -0,0 +1,91 @@
+// Copyright 2020-present Kuei-chun Chen. All rights reserved.
+
+package sim
+
+const simHTML = `
+<!DOCTYPE html>
+<html lang="en">
+<head>
+<title>Keyhole Load Test</title>
+<meta http-equiv="Cache-Control" content="no-cache, no-store, must-revalidate" />
+<meta http-equiv="Pragma" content="no-cache" />
+<meta http-equiv="Expires" content="0" />
+<style>
+  body { font-family: Helvetica, Arial, sans-serif; background-color: #f2f2f2; margin: 30px 60px; }
+  h1 { font-family: "Trebuchet MS"; font-size: 1.7em; }
+  table { font-family: Consolas, monaco, monospace; font-size: 12px; border-collapse: collapse; margin-bottom: 30px; }
+  caption { caption-side: top; font-weight: bold; font-style: italic; margin: 2px; text-align: left; }
+  table, th, td { border: 1px solid gray; }
+  th, td { padding: 2px 4px; }
+  th { background-color: #a0c3ff; white-space: nowrap; }
+  tr:nth-child(odd) { background-color: #f2f2f2; }
+  tr:nth-child(even) { background-color: #fff; }
+  td.num { text-align: right; }
+  svg { display: block; margin-bottom: 20px; font-size: 11px; background-color: #fff; }
+  svg .axis { stroke: gray; }
+</style>
+</head>
+<body>
+<h1>Keyhole Load Test</h1>
+<p id="summary"></p>
+<svg id="chart" width="800" height="240"></svg>
+<table id="totals"></table>
+<table id="intervals"></table>
+<script>
+  var colors = ['#4a7fd4', '#d4594a', '#4ad48a', '#d4b84a', '#8a4ad4', '#4ad4d4', '#d44ab8', '#7f7f7f'];
+  function micros(v) {
+    if (v <= 0) { return '-'; }
+    return v < 1000 ? v + 'µs' : v < 1000000 ? (v / 1000).toFixed(1) + 'ms' : (v / 1000000).toFixed(2) + 's';
+  }
+  function row(cells, tag) {
+    return '<tr>' + cells.map(function(c, i) {
+      return tag === 'th' ? '<th>' + c + '</th>' : '<td' + (i > 0 ? ' class="num"' : '') + '>' + c + '</td>';
+    }).join('') + '</tr>';
+  }
+  function draw(report) {
+    var svg = document.getElementById('chart');
+    var w = 800, h = 240, pad = 40, names = report.operations.map(function(o) { return o.name; });
+    var max = 1, n = report.intervals.length;
+    report.intervals.forEach(function(iv) {
+      iv.operations.forEach(function(o) { max = Math.max(max, o.opsPerSec); });
+    });
+    var html = '<text x="' + pad + '" y="15">ops/sec by 10-second intervals (max ' + max + ')</text>';
+    html += '<line class="axis" x1="' + pad + '" y1="' + (h - pad) + '" x2="' + (w - 10) + '" y2="' + (h - pad) + '"/>';
+    html += '<line class="axis" x1="' + pad + '" y1="20" x2="' + pad + '" y2="' + (h - pad) + '"/>';
+    names.forEach(function(name, k) {
+      var pts = report.intervals.map(function(iv, i) {
+        var o = iv.operations.find(function(x) { return x.name === name; });
+        var x = pad + (n > 1 ? i * (w - pad - 10) / (n - 1) : 0);
+        var y = h - pad - (o ? o.opsPerSec : 0) * (h - pad - 20) / max;
+        return x + ',' + y;
+      }).join(' ');
+      var color = colors[k % colors.length];
+      html += '<polyline fill="none" stroke-width="1.5" stroke="' + color + '" points="' + pts + '"/>';
+      html += '<text fill="' + color + '" x="' + (pad + k * 90) + '" y="' + (h - 10) + '">' + name + '</text>';
+    });
+    svg.innerHTML = html;
+  }
+  function refresh() {
+    fetch('/sim/data').then(function(res) { return res.json(); }).then(function(report) {
+      document.getElementById('summary').innerText = 'Began at ' + report.begin + ', elapsed ' + report.seconds + ' seconds';
+      var header = row(['Operation', 'Count', 'Errors', 'ops/sec', 'p50', 'p95', 'p99', 'max'], 'th');
+      document.getElementById('totals').innerHTML = '<caption>Operations</caption>' + header +
+        report.operations.map(function(o) {
+          return row([o.name, o.count, o.errors, o.opsPerSec, micros(o.p50), micros(o.p95), micros(o.p99), micros(o.max)]);
+        }).join('');
+      var rows = [];
+      report.intervals.slice().reverse().forEach(function(iv) {
+        iv.operations.forEach(function(o) {
+          rows.push(row([iv.seconds + 's ' + o.name, o.count, o.errors, o.opsPerSec, micros(o.p50), micros(o.p95), micros(o.p99), micros(o.max)]));
+        });
+      });
+      document.getElementById('intervals').innerHTML = '<caption>Intervals</caption>' + header + rows.join('');
+      draw(report);
+    });
+  }
+  refresh();
+  setInterval(refresh, 5000);
+</script>
+</body>
+</html>
+`
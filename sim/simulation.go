@@ -40,6 +40,15 @@ func (rn *Runner) initSimDocs() {
 		return
 	}
 
+	if tmpl, terr := util.ReadDocTemplate(rn.filename); terr == nil { // distribution template
+		for len(simDocs) < total {
+			ndoc := tmpl.GetDoc()
+			delete(ndoc, "_id")
+			ndoc["_search"] = strconv.FormatInt(rand.Int63(), 16)
+			simDocs = append(simDocs, ndoc)
+		}
+		return
+	}
 	if sdoc, err = util.GetDocByTemplate(rn.filename, true); err != nil {
 		return
 	}
@@ -89,6 +98,48 @@ func (rn *Runner) PopulateData() error {
 	return nil
 }
 
+// executor executes operations of a document and returns their execution times with totals
+type executor func(doc bson.M) ([]bson.M, error)
+
+// newExecutor returns an executor of a workload, transactions, or the default CRUD
+func (rn *Runner) newExecutor(c *mongo.Collection, transactions []Transaction, wr *workloadRunner) executor {
+	return func(doc bson.M) ([]bson.M, error) {
+		if wr != nil {
+			res, err := wr.execute(doc)
+			return []bson.M{res}, err
+		} else if len(transactions) > 0 {
+			results := []bson.M{}
+			for _, tx := range transactions {
+				res, err := execTXByTemplateAndTX(c, util.CloneDoc(doc), tx)
+				if err != nil {
+					return results, err
+				}
+				results = append(results, res)
+			}
+			return results, nil
+		}
+		res, err := execTx(c, doc)
+		if err != nil {
+			return nil, err
+		}
+		return []bson.M{res}, nil
+	}
+}
+
+// getExecutor returns an executor of a new connection and a function to close it
+func (rn *Runner) getExecutor(thread int) (executor, func(), error) {
+	client, err := mdb.NewMongoClient(rn.uri)
+	if err != nil {
+		return nil, nil, err
+	}
+	var wr *workloadRunner
+	if rn.workload != nil {
+		wr = rn.workload.newRunner(client, thread)
+	}
+	c := client.Database(rn.dbName).Collection(rn.collectionName)
+	return rn.newExecutor(c, rn.transactions, wr), func() { client.Disconnect(context.Background()) }, nil
+}
+
 // Simulate simulates CRUD for load tests
 func (rn *Runner) Simulate(duration int, transactions []Transaction, thread int) error {
 	var err error
@@ -103,6 +154,11 @@ func (rn *Runner) Simulate(duration int, transactions []Transaction, thread int)
 	c := client.Database(rn.dbName).Collection(rn.collectionName)
 	// Metrics := map[string][]bson.M{}
 	minutes := 1
+	var wr *workloadRunner
+	if rn.workload != nil {
+		wr = rn.workload.newRunner(client, thread)
+	}
+	exec := rn.newExecutor(c, transactions, wr)
 
 	for run := 0; run < duration; run++ {
 		// be a minute transactions
@@ -132,27 +188,18 @@ func (rn *Runner) Simulate(duration int, transactions []Transaction, thread int)
 				doc := simDocs[batchCount%len(simDocs)]
 				batchCount++
 				if stage == setupStage || stage == thrashingStage {
-					var res bson.M
-					if len(transactions) > 0 {
-						for _, tx := range transactions {
-							if res, err = execTXByTemplateAndTX(c, util.CloneDoc(doc), tx); err != nil {
-								break
-							}
-							rn.mutex.Lock()
-							txCount += res["total"].(int)
-							delete(res, "total")
-							rn.Metrics[connID] = append(rn.Metrics[connID], res)
-							rn.mutex.Unlock()
-						}
-					} else {
-						if res, err = execTx(c, util.CloneDoc(doc)); err != nil {
-							break
-						}
+					var results []bson.M
+					results, err = exec(util.CloneDoc(doc))
+					rn.mutex.Lock()
+					rn.Stats.record(time.Now(), results, err)
+					for _, res := range results {
 						txCount += res["total"].(int)
 						delete(res, "total")
-						rn.mutex.Lock()
 						rn.Metrics[connID] = append(rn.Metrics[connID], res)
-						rn.mutex.Unlock()
+					}
+					rn.mutex.Unlock()
+					if err != nil {
+						break
 					}
 				} else if stage == teardownStage {
 					c.DeleteMany(ctx, bson.M{"_search": strconv.FormatInt(rand.Int63(), 16)})
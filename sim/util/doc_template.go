@@ -0,0 +1,357 @@
+// Copyright 2020-present Kuei-chun Chen. All rights reserved.
+
+package util
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"math"
+	"math/rand"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/simagix/gox"
+	"github.com/simagix/keyhole/mdb"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// DocTemplateType identifies a distribution template
+const DocTemplateType = "keyhole.template"
+
+const minFormatRatio = .9 // a string format applies if 90% of values match
+
+// DocTemplate generates documents by field distributions inferred from sampled documents
+type DocTemplate struct {
+	Fields    map[string]*FieldTemplate `json:"fields"`
+	Namespace string                    `json:"namespace"`
+	Samples   int64                     `json:"samples"`
+	Type      string                    `json:"type"`
+
+	children map[string][]string // field paths by parent path prefix
+	once     sync.Once
+}
+
+// FieldTemplate stores distributions of a field path.  Presence is relative to
+// the parent document, min and max of dates are in milliseconds since epoch, and
+// distribution is enum, uniform, zipf, or unique.
+type FieldTemplate struct {
+	Cardinality  int64              `json:"cardinality,omitempty"`
+	Distribution string             `json:"distribution,omitempty"`
+	Enum         []interface{}      `json:"enum,omitempty"`
+	Format       string             `json:"format,omitempty"`
+	Max          float64            `json:"max,omitempty"`
+	MaxItems     int                `json:"maxItems,omitempty"`
+	MaxLength    int                `json:"maxLength,omitempty"`
+	Min          float64            `json:"min,omitempty"`
+	MinItems     int                `json:"minItems,omitempty"`
+	MinLength    int                `json:"minLength,omitempty"`
+	Presence     float64            `json:"presence"`
+	Skew         float64            `json:"skew,omitempty"`
+	Types        map[string]float64 `json:"types"`
+	Weights      []int64            `json:"weights,omitempty"`
+
+	cdf  []float64 // cumulative zipf probabilities by rank
+	hash int64
+}
+
+// NewDocTemplate returns a distribution template from an inferred schema
+func NewDocTemplate(schema *mdb.Schema) *DocTemplate {
+	t := DocTemplate{Fields: map[string]*FieldTemplate{}, Namespace: schema.Namespace, Samples: schema.Samples,
+		Type: DocTemplateType}
+	presences := map[string]float64{}
+	for _, field := range schema.Fields {
+		presences[field.Path] = field.Presence
+	}
+	for _, field := range schema.Fields {
+		f := &FieldTemplate{Types: map[string]float64{}, MinItems: field.MinArrayLength, MaxItems: field.MaxArrayLength}
+		if schema.Samples > 0 {
+			f.Presence = field.Presence / 100
+		}
+		if parent := getParentPath(field.Path); parent != "" && presences[parent] > 0 {
+			f.Presence = math.Min(1, field.Presence/presences[parent])
+		}
+		f.Presence = math.Round(f.Presence*10000) / 10000
+		var total int64
+		for _, count := range field.Types {
+			total += count
+		}
+		for name, count := range field.Types {
+			f.Types[name] = math.Round(10000*float64(count)/float64(total)) / 10000
+		}
+		if v := field.Values; v != nil {
+			f.Min, f.Max, f.MinLength, f.MaxLength = v.Min, v.Max, v.MinLength, v.MaxLength
+			for format, count := range v.Formats {
+				if float64(count) >= minFormatRatio*float64(v.Count) {
+					f.Format = format
+				}
+			}
+			if len(v.Enum) > 0 {
+				f.Distribution, f.Enum, f.Weights = "enum", v.Enum, v.Weights
+			} else if v.Overflow || v.Cardinality == 0 || float64(v.Cardinality) >= minFormatRatio*float64(v.Count) {
+				f.Distribution = "unique"
+			} else if v.Skew > 0 {
+				f.Cardinality, f.Distribution, f.Skew = v.Cardinality, "zipf", v.Skew
+			} else {
+				f.Cardinality, f.Distribution = v.Cardinality, "uniform"
+			}
+		}
+		t.Fields[field.Path] = f
+	}
+	return &t
+}
+
+// ReadDocTemplate reads a distribution template from a file
+func ReadDocTemplate(filename string) (*DocTemplate, error) {
+	var err error
+	var data []byte
+	if data, err = os.ReadFile(filename); err != nil {
+		return nil, err
+	}
+	var t DocTemplate
+	if err = json.Unmarshal(data, &t); err != nil {
+		return nil, err
+	}
+	if t.Type != DocTemplateType || len(t.Fields) == 0 {
+		return nil, errors.New("not a distribution template")
+	}
+	return &t, nil
+}
+
+// WriteFile writes the template to a file
+func (t *DocTemplate) WriteFile(filename string) error {
+	data, err := json.MarshalIndent(t, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filename, data, 0644)
+}
+
+// GetDoc returns a randomized document, safe for concurrent use
+func (t *DocTemplate) GetDoc() bson.M {
+	t.once.Do(t.prepare)
+	return t.getDocument("")
+}
+
+// prepare indexes field paths by parents and builds zipf distributions
+func (t *DocTemplate) prepare() {
+	t.children = map[string][]string{}
+	for path, f := range t.Fields {
+		if !strings.HasSuffix(path, "[]") {
+			prefix := ""
+			if parent := getParentPath(path); parent != "" {
+				prefix = parent + "."
+			}
+			t.children[prefix] = append(t.children[prefix], path)
+		}
+		h := fnv.New64a()
+		h.Write([]byte(path))
+		f.hash = int64(h.Sum64())
+		if f.Distribution == "zipf" && f.Cardinality > 0 {
+			var sum float64
+			for k := int64(1); k <= f.Cardinality; k++ {
+				sum += 1 / math.Pow(float64(k), f.Skew)
+				f.cdf = append(f.cdf, sum)
+			}
+			for i := range f.cdf {
+				f.cdf[i] /= sum
+			}
+		}
+	}
+	for prefix := range t.children {
+		sort.Strings(t.children[prefix])
+	}
+}
+
+// getDocument returns a randomized document of fields under a path prefix
+func (t *DocTemplate) getDocument(prefix string) bson.M {
+	doc := bson.M{}
+	for _, path := range t.children[prefix] {
+		if rand.Float64() < t.Fields[path].Presence {
+			doc[path[len(prefix):]] = t.getValue(path)
+		}
+	}
+	return doc
+}
+
+// getValue returns a randomized value of a field path
+func (t *DocTemplate) getValue(path string) interface{} {
+	f := t.Fields[path]
+	typ := f.getType()
+	if typ == "object" {
+		return t.getDocument(path + ".")
+	} else if typ == "array" {
+		n := f.MinItems
+		if f.MaxItems > f.MinItems {
+			n += rand.Intn(f.MaxItems - f.MinItems + 1)
+		}
+		arr := bson.A{}
+		_, hasScalars := t.Fields[path+"[]"]
+		hasDocs := len(t.children[path+"."]) > 0
+		for i := 0; i < n; i++ {
+			if hasScalars && (!hasDocs || rand.Intn(2) == 0) {
+				arr = append(arr, t.getValue(path+"[]"))
+			} else if hasDocs {
+				arr = append(arr, t.getDocument(path+"."))
+			}
+		}
+		return arr
+	} else if len(f.Enum) > 0 {
+		return f.getEnumValue(typ)
+	}
+	return f.getScalar(typ)
+}
+
+// getType returns a type by weights
+func (f *FieldTemplate) getType() string {
+	names := []string{}
+	for name := range f.Types {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	r := rand.Float64()
+	for _, name := range names {
+		if r -= f.Types[name]; r < 0 {
+			return name
+		}
+	}
+	if len(names) == 0 {
+		return "null"
+	}
+	return names[len(names)-1]
+}
+
+// getEnumValue returns an enum value by weights, numbers of JSON templates are converted back
+func (f *FieldTemplate) getEnumValue(typ string) interface{} {
+	var total int64
+	for _, w := range f.Weights {
+		total += w
+	}
+	value := f.Enum[rand.Intn(len(f.Enum))]
+	if total > 0 && len(f.Weights) == len(f.Enum) {
+		r := rand.Int63n(total)
+		for i, w := range f.Weights {
+			if r -= w; r < 0 {
+				value = f.Enum[i]
+				break
+			}
+		}
+	}
+	if num, ok := value.(float64); ok && num == math.Trunc(num) {
+		if typ == "int" {
+			return int32(num)
+		} else if typ == "long" {
+			return int64(num)
+		}
+	}
+	return value
+}
+
+// getRank returns a zipf or uniform rank of values, -1 if values are unique
+func (f *FieldTemplate) getRank() int64 {
+	if f.Cardinality <= 0 {
+		return -1
+	} else if len(f.cdf) > 0 {
+		return int64(sort.SearchFloat64s(f.cdf, rand.Float64()))
+	}
+	return rand.Int63n(f.Cardinality)
+}
+
+// getNumber returns a number within min and max, ranked values are spread evenly
+func (f *FieldTemplate) getNumber() float64 {
+	if rank := f.getRank(); rank >= 0 && f.Cardinality > 1 {
+		return f.Min + float64(rank)*(f.Max-f.Min)/float64(f.Cardinality-1)
+	}
+	return f.Min + rand.Float64()*(f.Max-f.Min)
+}
+
+// getScalar returns a randomized scalar value of a type
+func (f *FieldTemplate) getScalar(typ string) interface{} {
+	switch typ {
+	case "binData":
+		return primitive.Binary{Subtype: 0, Data: []byte(gox.GetRandomDigitString(16))}
+	case "bool":
+		return rand.Intn(2) == 0
+	case "date":
+		if f.Max <= f.Min {
+			return getDate()
+		}
+		return time.UnixMilli(int64(f.Min + rand.Float64()*(f.Max-f.Min)))
+	case "decimal":
+		d, _ := primitive.ParseDecimal128(fmt.Sprintf("%.2f", f.getNumber()))
+		return d
+	case "double":
+		return math.Round(f.getNumber()*100) / 100
+	case "int":
+		return int32(math.Round(f.getNumber()))
+	case "long":
+		return int64(math.Round(f.getNumber()))
+	case "objectId":
+		return primitive.NewObjectID()
+	case "string":
+		return f.getString()
+	case "timestamp":
+		return primitive.Timestamp{T: uint32(time.Now().Unix())}
+	default:
+		return nil
+	}
+}
+
+// getString returns a string of the format, or of random letters within min and max lengths
+func (f *FieldTemplate) getString() string {
+	length := f.MinLength
+	if f.MaxLength > f.MinLength {
+		length += rand.Intn(f.MaxLength - f.MinLength + 1)
+	}
+	switch f.Format {
+	case "date":
+		return getDate().Format(time.RFC3339)
+	case "email":
+		return GetEmailAddress()
+	case "hex":
+		return gox.GetRandomHexString(length / 2 * 2)
+	case "ip":
+		return getIP()
+	case "objectId":
+		return primitive.NewObjectID().Hex()
+	case "uuid":
+		return gox.GetRandomUUIDString()
+	}
+	if rank := f.getRank(); rank >= 0 { // the same string of a rank
+		return getRandomLetters(rand.New(rand.NewSource(f.hash+rank)), length)
+	}
+	return getRandomLetters(nil, length)
+}
+
+// getRandomLetters returns lower case letters with spaces in between, r is optional
+func getRandomLetters(r *rand.Rand, length int) string {
+	intn := rand.Intn
+	if r != nil {
+		intn = r.Intn
+	}
+	b := make([]byte, length)
+	for i := range b {
+		if i > 0 && i < length-1 && b[i-1] != ' ' && intn(7) == 0 {
+			b[i] = ' '
+		} else {
+			b[i] = byte('a' + intn(26))
+		}
+	}
+	return string(b)
+}
+
+// getParentPath returns the parent path, e.g. a.b of a.b.c, and an empty string of top level fields
+func getParentPath(path string) string {
+	if strings.HasSuffix(path, "[]") {
+		return ""
+	}
+	if i := strings.LastIndex(path, "."); i > 0 {
+		return path[:i]
+	}
+	return ""
+}
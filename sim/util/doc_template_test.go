@@ -0,0 +1,77 @@
+// Copyright 2020-present Kuei-chun Chen. All rights reserved.
+
+package util
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/simagix/keyhole/mdb"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestDocTemplate(t *testing.T) {
+	analyzer := mdb.NewSchemaAnalyzer()
+	for i := 0; i < 1000; i++ {
+		doc := bson.D{{Key: "status", Value: []string{"active", "closed"}[i%2]}, {Key: "age", Value: int32(18 + i%50)},
+			{Key: "email", Value: GetEmailAddress()}, {Key: "tags", Value: bson.A{"a", "b", "c"}[:i%4]},
+			{Key: "items", Value: bson.A{bson.D{{Key: "sku", Value: "x"}, {Key: "qty", Value: int64(i % 5)}}}}}
+		if i%4 == 0 {
+			doc = append(doc, bson.E{Key: "address", Value: bson.D{{Key: "zip", Value: "08824"}}})
+		}
+		data, _ := bson.Marshal(doc)
+		analyzer.AddDocument(data)
+	}
+	filename := filepath.Join(t.TempDir(), "template.json")
+	if err := NewDocTemplate(analyzer.GetSchema()).WriteFile(filename); err != nil {
+		t.Fatal(err)
+	}
+	tmpl, err := ReadDocTemplate(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = ReadDocTemplate("doc_template.go"); err == nil {
+		t.Fatal("expected error")
+	}
+	addresses := 0
+	for i := 0; i < 1000; i++ {
+		doc := tmpl.GetDoc()
+		if doc["status"] != "active" && doc["status"] != "closed" {
+			t.Fatal("unexpected status", doc["status"])
+		}
+		if age, ok := doc["age"].(int32); !ok || age < 18 || age > 67 {
+			t.Fatal("unexpected age", doc["age"])
+		}
+		if !isEmailAddress(doc["email"].(string)) {
+			t.Fatal("unexpected email", doc["email"])
+		}
+		if tags := doc["tags"].(bson.A); len(tags) > 3 {
+			t.Fatal("unexpected tags", tags)
+		}
+		items := doc["items"].(bson.A)
+		if item := items[0].(bson.M); len(items) != 1 || item["sku"] != "x" || item["qty"].(int64) > 4 {
+			t.Fatal("unexpected items", items)
+		}
+		if address, ok := doc["address"].(bson.M); ok {
+			addresses++
+			if len(address["zip"].(string)) != 5 {
+				t.Fatal("unexpected address", address)
+			}
+		}
+	}
+	if addresses < 150 || addresses > 350 {
+		t.Fatal("expected about 250 addresses, but got", addresses)
+	}
+}
+
+func TestDocTemplateHighCardinality(t *testing.T) {
+	analyzer := mdb.NewSchemaAnalyzer()
+	for i := 0; i < 1500; i++ {
+		data, _ := bson.Marshal(bson.D{{Key: "ref", Value: int32(i % 1200)}})
+		analyzer.AddDocument(data)
+	}
+	tmpl := NewDocTemplate(analyzer.GetSchema())
+	if f := tmpl.Fields["ref"]; f == nil || f.Distribution != "unique" {
+		t.Fatal("expected unique values of more than 1000 distinct values, but got", f)
+	}
+}
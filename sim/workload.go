@@ -0,0 +1,536 @@
+// Copyright 2020-present Kuei-chun Chen. All rights reserved.
+
+package sim
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/simagix/keyhole/mdb"
+	"github.com/simagix/keyhole/sim/util"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	maxPoolIDs    = 10000 // recent _ids kept by namespace for $ref, $zipf, and $latest
+	zipfSkew      = 1.1
+	ycsbFieldSize = 100
+	ycsbRecords   = 10000
+)
+
+var workloadCommands = map[string]bool{"aggregate": true, "count": true, "deleteMany": true, "deleteOne": true,
+	"find": true, "findOne": true, "findOneAndUpdate": true, "insertOne": true, "updateMany": true, "updateOne": true}
+
+const cmdTransaction = "transaction" // steps in a multi-document transaction
+
+// Workload defines weighted operations against namespaces.  Values of filter, op,
+// doc, and $match stages of pipe can be parameter generators below.
+//
+//	$ref[:ns]     a random _id inserted to, or read from, a namespace
+//	$zipf[:ns]    a zipfian distributed _id, hot _ids are chosen more often
+//	$latest[:ns]  a recently inserted _id
+//	$string[:n]   a string of n random letters
+//	$int[:min:max] a random integer
+//	$date, $email, $ip, $oId, $uuid, $numberDecimal, see templates
+type Workload struct {
+	Name       string         `json:"name"`
+	Operations []WorkloadOp   `json:"operations"`
+	Records    map[string]int `json:"records"` // documents to insert to namespaces before the run
+	Seed       int64          `json:"seed"`    // a seed to reproduce the sequence of operations
+
+	cumWeights   []float64
+	dbName       string
+	mutex        sync.Mutex
+	pools        map[string]*idPool
+	transactions transactionCounter
+}
+
+// WorkloadOp defines an operation, ns is a collection name or db.collection.  A
+// transaction executes its steps in a multi-document transaction.
+type WorkloadOp struct {
+	C            string       `json:"c"`
+	Doc          bson.M       `json:"doc"`
+	Filter       bson.M       `json:"filter"`
+	Limit        int64        `json:"limit"`
+	Name         string       `json:"name"`
+	NS           string       `json:"ns"`
+	Op           bson.M       `json:"op"`
+	Pipe         []bson.M     `json:"pipe"`
+	ReadConcern  string       `json:"readConcern"` // of a transaction, e.g. snapshot
+	Steps        []WorkloadOp `json:"steps"`
+	ThinkTime    int          `json:"thinkTime"` // milliseconds after the operation
+	Weight       float64      `json:"weight"`
+	WriteConcern string       `json:"writeConcern"` // of a transaction, majority or a number
+}
+
+// idPool keeps recent _ids of a namespace in a ring
+type idPool struct {
+	ids   []interface{}
+	mutex sync.Mutex
+	next  int
+}
+
+func (p *idPool) add(id interface{}) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	if len(p.ids) < maxPoolIDs {
+		p.ids = append(p.ids, id)
+		return
+	}
+	p.ids[p.next] = id
+	p.next = (p.next + 1) % maxPoolIDs
+}
+
+func (p *idPool) size() int {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	return len(p.ids)
+}
+
+// get returns an _id by generator, ranks of $zipf and $latest count from the first and the last added
+func (p *idPool) get(generator string, rng *rand.Rand) interface{} {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	n := len(p.ids)
+	if n == 0 {
+		return nil
+	}
+	last := (p.next - 1 + n) % n
+	switch generator {
+	case "$zipf":
+		if n == 1 {
+			return p.ids[0]
+		}
+		return p.ids[(p.next+int(rand.NewZipf(rng, zipfSkew, 1, uint64(n-1)).Uint64()))%n]
+	case "$latest":
+		offset := int(rng.ExpFloat64() * 10)
+		if offset >= n {
+			offset = n - 1
+		}
+		return p.ids[(last-offset+n)%n]
+	default:
+		return p.ids[rng.Intn(n)]
+	}
+}
+
+// GetWorkload returns a workload from a JSON file or a preset, ycsb-a to ycsb-f
+func GetWorkload(name string) (*Workload, error) {
+	var err error
+	var w *Workload
+	if strings.HasPrefix(name, "ycsb-") {
+		if w, err = getYCSBWorkload(strings.TrimPrefix(name, "ycsb-")); err != nil {
+			return nil, err
+		}
+	} else {
+		var data []byte
+		if data, err = os.ReadFile(name); err != nil {
+			return nil, err
+		}
+		w = &Workload{}
+		if err = json.Unmarshal(data, w); err != nil {
+			return nil, err
+		}
+	}
+	if len(w.Operations) == 0 {
+		return nil, fmt.Errorf("no operations defined in workload %v", name)
+	}
+	for i, op := range w.Operations {
+		if op.C == cmdTransaction {
+			if len(op.Steps) == 0 {
+				return nil, fmt.Errorf("no steps of transaction %d", i)
+			}
+			for j, step := range op.Steps {
+				if !workloadCommands[step.C] {
+					return nil, fmt.Errorf("unsupported command %v of step %d of transaction %d", step.C, j, i)
+				}
+			}
+			if _, err = getTransactionOptions(&op); err != nil {
+				return nil, err
+			}
+		} else if !workloadCommands[op.C] {
+			return nil, fmt.Errorf("unsupported command %v of operation %d", op.C, i)
+		}
+		if op.Weight < 0 {
+			return nil, fmt.Errorf("negative weight of operation %d", i)
+		}
+	}
+	return w, nil
+}
+
+// getYCSBWorkload returns a YCSB core workload on usertable
+func getYCSBWorkload(letter string) (*Workload, error) {
+	fields := bson.M{}
+	for i := 0; i < 10; i++ {
+		fields[fmt.Sprintf("field%d", i)] = fmt.Sprintf("$string:%d", ycsbFieldSize)
+	}
+	ns := "usertable"
+	read := WorkloadOp{C: "findOne", Name: "read", NS: ns, Filter: bson.M{"_id": "$zipf"}}
+	update := WorkloadOp{C: "updateOne", Name: "update", NS: ns, Filter: bson.M{"_id": "$zipf"},
+		Op: bson.M{"$set": bson.M{"field0": fmt.Sprintf("$string:%d", ycsbFieldSize)}}}
+	insert := WorkloadOp{C: "insertOne", Name: "insert", NS: ns, Doc: fields}
+	w := Workload{Name: "ycsb-" + letter, Records: map[string]int{ns: ycsbRecords}}
+	switch letter {
+	case "a": // update heavy
+		read.Weight, update.Weight = 50, 50
+		w.Operations = []WorkloadOp{read, update}
+	case "b": // read mostly
+		read.Weight, update.Weight = 95, 5
+		w.Operations = []WorkloadOp{read, update}
+	case "c": // read only
+		read.Weight = 100
+		w.Operations = []WorkloadOp{read}
+	case "d": // read latest
+		read.Filter, read.Weight, insert.Weight = bson.M{"_id": "$latest"}, 95, 5
+		w.Operations = []WorkloadOp{read, insert}
+	case "e": // short ranges
+		scan := WorkloadOp{C: "find", Name: "scan", NS: ns, Filter: bson.M{"_id": bson.M{"$gte": "$zipf"}}, Limit: 100, Weight: 95}
+		insert.Weight = 5
+		w.Operations = []WorkloadOp{scan, insert}
+	case "f": // read-modify-write
+		rmw := WorkloadOp{C: "findOneAndUpdate", Name: "readModifyWrite", NS: ns, Filter: update.Filter, Op: update.Op, Weight: 50}
+		read.Weight = 50
+		w.Operations = []WorkloadOp{read, rmw}
+	default:
+		return nil, errors.New("ycsb workloads are ycsb-a to ycsb-f")
+	}
+	return &w, nil
+}
+
+// init qualifies namespaces, names operations, and computes weights
+func (w *Workload) init(dbName string, collectionName string) {
+	qualify := func(ns string) string {
+		if ns == "" {
+			return dbName + "." + collectionName
+		} else if !strings.Contains(ns, ".") {
+			return dbName + "." + ns
+		}
+		return ns
+	}
+	w.dbName = dbName
+	records := map[string]int{}
+	for ns, n := range w.Records {
+		records[qualify(ns)] = n
+	}
+	w.Records = records
+	w.cumWeights = []float64{}
+	w.pools = map[string]*idPool{}
+	var sum float64
+	for i := range w.Operations {
+		op := &w.Operations[i]
+		op.NS = qualify(op.NS)
+		for j := range op.Steps {
+			op.Steps[j].NS = qualify(op.Steps[j].NS)
+		}
+		if op.Name == "" && op.C == cmdTransaction {
+			op.Name = fmt.Sprintf("%v %d", cmdTransaction, i)
+		} else if op.Name == "" {
+			op.Name = op.C + " " + op.NS[strings.Index(op.NS, ".")+1:]
+		}
+		if op.Weight == 0 {
+			op.Weight = 1
+		}
+		sum += op.Weight
+		w.cumWeights = append(w.cumWeights, sum)
+	}
+}
+
+// String returns the mix of operations
+func (w *Workload) String() string {
+	var buffer bytes.Buffer
+	buffer.WriteString(fmt.Sprintf("workload %v:", w.Name))
+	total := w.cumWeights[len(w.cumWeights)-1]
+	for _, op := range w.Operations {
+		buffer.WriteString(fmt.Sprintf(" %v %v %.1f%%", op.Name, op.NS, 100*op.Weight/total))
+		if op.ThinkTime > 0 {
+			buffer.WriteString(fmt.Sprintf(" (think %dms)", op.ThinkTime))
+		}
+		buffer.WriteString(",")
+	}
+	return strings.TrimSuffix(buffer.String(), ",")
+}
+
+// getPool returns the _id pool of a namespace
+func (w *Workload) getPool(ns string) *idPool {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	if w.pools[ns] == nil {
+		w.pools[ns] = &idPool{}
+	}
+	return w.pools[ns]
+}
+
+// Preload inserts records and reads existing _ids of namespaces referenced
+func (w *Workload) Preload(client *mongo.Client) error {
+	ctx := context.Background()
+	rng := rand.New(rand.NewSource(w.Seed))
+	namespaces := []string{}
+	for ns := range w.Records {
+		namespaces = append(namespaces, ns)
+	}
+	sort.Strings(namespaces)
+	for _, ns := range namespaces {
+		c := getCollection(client, ns)
+		pool := w.getPool(ns)
+		for inserted := 0; inserted < w.Records[ns]; {
+			docs := []interface{}{}
+			for i := 0; i < 1000 && inserted+i < w.Records[ns]; i++ {
+				docs = append(docs, w.getInsertDoc(ns, rng, nil))
+			}
+			if _, err := c.InsertMany(ctx, docs); err != nil {
+				return err
+			}
+			for _, doc := range docs {
+				pool.add(doc.(bson.M)["_id"])
+			}
+			inserted += len(docs)
+		}
+	}
+	operations := []WorkloadOp{}
+	for _, op := range w.Operations {
+		operations = append(operations, op)
+		operations = append(operations, op.Steps...)
+	}
+	for _, op := range operations {
+		if op.C == cmdTransaction {
+			continue
+		}
+		pool := w.getPool(op.NS)
+		if pool.size() > 0 {
+			continue
+		}
+		opts := options.Find().SetProjection(bson.M{"_id": 1}).SetLimit(maxPoolIDs)
+		cursor, err := getCollection(client, op.NS).Find(ctx, bson.M{}, opts)
+		if err != nil {
+			return err
+		}
+		for cursor.Next(ctx) {
+			pool.add(cursor.Current.Lookup("_id"))
+		}
+		cursor.Close(ctx)
+	}
+	return nil
+}
+
+// getInsertDoc returns the doc of the insertOne operation of a namespace, or a copy of a sim doc
+func (w *Workload) getInsertDoc(ns string, rng *rand.Rand, simDoc bson.M) bson.M {
+	var doc bson.M
+	for _, op := range w.Operations {
+		if op.C == "insertOne" && op.NS == ns && op.Doc != nil {
+			doc = w.resolve(op.Doc, ns, rng).(bson.M)
+			break
+		}
+	}
+	if doc == nil && simDoc != nil {
+		doc = simDoc
+	} else if doc == nil {
+		doc = util.CloneDoc(simDocs[rng.Intn(len(simDocs))])
+	}
+	if doc["_id"] == nil {
+		doc["_id"] = primitive.NewObjectID()
+	}
+	return doc
+}
+
+// resolvePipeline returns a copy of a pipeline with parameter generators of $match stages replaced.
+// Strings of other stages are field paths or variables, e.g. {"$group": {"_id": "$email"}}, and kept.
+func (w *Workload) resolvePipeline(pipe []bson.M, ns string, rng *rand.Rand) []interface{} {
+	pipeline := []interface{}{}
+	for _, stage := range pipe {
+		doc := bson.M{}
+		for k, v := range stage {
+			if k == "$match" {
+				v = w.resolve(v, ns, rng)
+			}
+			doc[k] = v
+		}
+		pipeline = append(pipeline, doc)
+	}
+	return pipeline
+}
+
+// resolve returns a copy of a value with parameter generators replaced, except of $expr of field paths
+func (w *Workload) resolve(value interface{}, ns string, rng *rand.Rand) interface{} {
+	switch o := value.(type) {
+	case bson.M:
+		doc := bson.M{}
+		for k, v := range o {
+			if k == "$expr" {
+				doc[k] = v
+				continue
+			}
+			doc[k] = w.resolve(v, ns, rng)
+		}
+		return doc
+	case map[string]interface{}:
+		return w.resolve(bson.M(o), ns, rng)
+	case []interface{}:
+		arr := []interface{}{}
+		for _, v := range o {
+			arr = append(arr, w.resolve(v, ns, rng))
+		}
+		return arr
+	case string:
+		if strings.HasPrefix(o, "$") {
+			return w.getParam(o, ns, rng)
+		}
+	}
+	return value
+}
+
+// getParam returns a generated value, or the string itself, e.g. a field path of a pipeline
+func (w *Workload) getParam(str string, ns string, rng *rand.Rand) interface{} {
+	args := strings.Split(str, ":")
+	switch args[0] {
+	case "$ref", "$zipf", "$latest":
+		if len(args) > 1 {
+			ns = strings.Join(args[1:], ":")
+			if !strings.Contains(ns, ".") {
+				ns = w.dbName + "." + ns
+			}
+		}
+		return w.getPool(ns).get(args[0], rng)
+	case "$string":
+		n := 10
+		if len(args) > 1 {
+			n, _ = strconv.Atoi(args[1])
+		}
+		b := make([]byte, n)
+		for i := range b {
+			b[i] = byte('a' + rng.Intn(26))
+		}
+		return string(b)
+	case "$int":
+		min, max := 0, 1000000
+		if len(args) > 2 {
+			min, _ = strconv.Atoi(args[1])
+			max, _ = strconv.Atoi(args[2])
+		}
+		if max <= min {
+			return min
+		}
+		return min + rng.Intn(max-min+1)
+	case "$date", "$email", "$ip", "$numberDecimal", "$oId", "$uuid":
+		doc := map[string]interface{}{}
+		util.RandomizeDocument(&doc, map[string]interface{}{"v": str}, false)
+		return doc["v"]
+	}
+	return str
+}
+
+// workloadRunner executes operations of a workload on a connection
+type workloadRunner struct {
+	client   *mongo.Client
+	rng      *rand.Rand
+	workload *Workload
+}
+
+// newRunner returns a runner of a connection, seeded by the workload seed and the thread
+func (w *Workload) newRunner(client *mongo.Client, thread int) *workloadRunner {
+	seed := time.Now().UnixNano() + int64(thread)
+	if w.Seed != 0 {
+		seed = w.Seed + int64(thread)
+	}
+	return &workloadRunner{client: client, rng: rand.New(rand.NewSource(seed)), workload: w}
+}
+
+// pick returns an operation by weights
+func (r *workloadRunner) pick() *WorkloadOp {
+	weights := r.workload.cumWeights
+	n := sort.SearchFloat64s(weights, r.rng.Float64()*weights[len(weights)-1])
+	if n >= len(weights) {
+		n = len(weights) - 1
+	}
+	return &r.workload.Operations[n]
+}
+
+// execute executes an operation picked by weights and returns its execution time
+func (r *workloadRunner) execute(doc bson.M) (bson.M, error) {
+	op := r.pick()
+	var err error
+	t := time.Now()
+	if op.C == cmdTransaction {
+		err = r.execTransaction(op, doc)
+	} else {
+		err = r.exec(context.Background(), op, doc)
+	}
+	execTime := bson.M{op.Name: time.Since(t), "total": 1}
+	if op.ThinkTime > 0 {
+		time.Sleep(time.Duration(op.ThinkTime) * time.Millisecond)
+	}
+	return execTime, err
+}
+
+// exec executes an operation, ctx is a session context in a transaction
+func (r *workloadRunner) exec(ctx context.Context, op *WorkloadOp, simDoc bson.M) error {
+	var err error
+	var cursor *mongo.Cursor
+	w := r.workload
+	c := getCollection(r.client, op.NS)
+	filter := bson.M{}
+	if op.Filter != nil {
+		filter = w.resolve(op.Filter, op.NS, r.rng).(bson.M)
+	}
+	switch op.C {
+	case "aggregate":
+		pipeline := w.resolvePipeline(op.Pipe, op.NS, r.rng)
+		if cursor, err = c.Aggregate(ctx, pipeline); err == nil {
+			for cursor.Next(ctx) {
+			}
+			cursor.Close(ctx)
+		}
+	case "count":
+		_, err = c.CountDocuments(ctx, filter)
+	case "deleteMany":
+		_, err = c.DeleteMany(ctx, filter)
+	case "deleteOne":
+		_, err = c.DeleteOne(ctx, filter)
+	case "find":
+		opts := options.Find()
+		if op.Limit > 0 {
+			opts.SetLimit(op.Limit)
+		}
+		if cursor, err = c.Find(ctx, filter, opts); err == nil {
+			for cursor.Next(ctx) {
+			}
+			cursor.Close(ctx)
+		}
+	case "findOne":
+		if err = c.FindOne(ctx, filter).Err(); err == mongo.ErrNoDocuments {
+			err = nil
+		}
+	case "findOneAndUpdate":
+		update := w.resolve(op.Op, op.NS, r.rng)
+		if err = c.FindOneAndUpdate(ctx, filter, update).Err(); err == mongo.ErrNoDocuments {
+			err = nil
+		}
+	case "insertOne":
+		doc := w.getInsertDoc(op.NS, r.rng, simDoc)
+		if _, err = c.InsertOne(ctx, doc); err == nil {
+			w.getPool(op.NS).add(doc["_id"])
+		}
+	case "updateMany":
+		_, err = c.UpdateMany(ctx, filter, w.resolve(op.Op, op.NS, r.rng))
+	case "updateOne":
+		_, err = c.UpdateOne(ctx, filter, w.resolve(op.Op, op.NS, r.rng))
+	}
+	return err
+}
+
+// getCollection returns a collection of a namespace
+func getCollection(client *mongo.Client, ns string) *mongo.Collection {
+	dbName, collName := mdb.SplitNamespace(ns)
+	return client.Database(dbName).Collection(collName)
+}
@@ -0,0 +1,93 @@
+// Copyright 2020-present Kuei-chun Chen. All rights reserved.
+
+package sim
+
+import (
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestGetWorkload(t *testing.T) {
+	for _, name := range []string{"ycsb-a", "ycsb-b", "ycsb-c", "ycsb-d", "ycsb-e", "ycsb-f"} {
+		if _, err := GetWorkload(name); err != nil {
+			t.Fatal(name, err)
+		}
+	}
+	if _, err := GetWorkload("ycsb-g"); err == nil {
+		t.Fatal("expected error")
+	}
+	filename := filepath.Join(t.TempDir(), "workload.json")
+	data := []byte(`{"name": "orders", "seed": 1, "operations": [
+		{"c": "insertOne", "ns": "orders", "doc": {"customer": "$ref:customers", "qty": "$int:1:9"}, "weight": 20},
+		{"c": "findOne", "ns": "orders", "filter": {"_id": "$latest"}, "weight": 80, "thinkTime": 10}]}`)
+	os.WriteFile(filename, data, 0644)
+	w, err := GetWorkload(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.init("keyhole", "examples")
+	if w.Operations[0].NS != "keyhole.orders" || w.Operations[1].Name != "findOne orders" {
+		t.Fatal("unexpected operations", w.Operations)
+	}
+	t.Log(w.String())
+
+	counts := map[string]int{}
+	runner := w.newRunner(nil, 0)
+	for i := 0; i < 10000; i++ {
+		counts[runner.pick().C]++
+	}
+	if counts["findOne"] < 7800 || counts["findOne"] > 8200 {
+		t.Fatal("expected about 80% findOne, but got", counts)
+	}
+	// the same seed and thread, the same sequence
+	x, y := w.newRunner(nil, 1), w.newRunner(nil, 1)
+	for i := 0; i < 100; i++ {
+		if x.pick() != y.pick() {
+			t.Fatal("expected the same sequence")
+		}
+	}
+
+	for i := 1; i <= 100; i++ {
+		w.getPool("keyhole.customers").add(i)
+	}
+	rng := rand.New(rand.NewSource(1))
+	doc := w.resolve(w.Operations[0].Doc, "keyhole.orders", rng).(bson.M)
+	if customer, ok := doc["customer"].(int); !ok || customer < 1 || customer > 100 {
+		t.Fatal("unexpected customer", doc["customer"])
+	}
+	if qty := doc["qty"].(int); qty < 1 || qty > 9 {
+		t.Fatal("unexpected qty", doc["qty"])
+	}
+	if w.Operations[0].Doc["customer"] != "$ref:customers" {
+		t.Fatal("expected the template unchanged")
+	}
+	pool := w.getPool("keyhole.customers")
+	if id := pool.get("$latest", rng).(int); id < 50 {
+		t.Fatal("expected a recent id, but got", id)
+	}
+	hot := 0
+	for i := 0; i < 1000; i++ {
+		if pool.get("$zipf", rng).(int) <= 10 {
+			hot++
+		}
+	}
+	if hot < 500 {
+		t.Fatal("expected mostly hot ids, but got", hot)
+	}
+	pipeline := w.resolvePipeline([]bson.M{{"$match": bson.M{"customer": "$ref:customers"}},
+		{"$group": bson.M{"_id": "$email", "ts": bson.M{"$max": "$date"}}}}, "keyhole.orders", rng)
+	if _, ok := pipeline[0].(bson.M)["$match"].(bson.M)["customer"].(int); !ok {
+		t.Fatal("expected a generated customer of $match", pipeline)
+	}
+	if group := pipeline[1].(bson.M)["$group"].(bson.M); group["_id"] != "$email" || group["ts"].(bson.M)["$max"] != "$date" {
+		t.Fatal("expected field paths unchanged", pipeline)
+	}
+	filter := w.resolve(bson.M{"$expr": bson.M{"$eq": bson.A{"$email", "$ip"}}}, "keyhole.orders", rng).(bson.M)
+	if filter["$expr"].(bson.M)["$eq"].(bson.A)[0] != "$email" {
+		t.Fatal("expected field paths of $expr unchanged", filter)
+	}
+}
@@ -0,0 +1,180 @@
+// Copyright 2020-present Kuei-chun Chen. All rights reserved.
+
+package sim
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.mongodb.org/mongo-driver/mongo/readconcern"
+	"go.mongodb.org/mongo-driver/mongo/writeconcern"
+)
+
+const (
+	transientTransactionError      = "TransientTransactionError"
+	unknownTransactionCommitResult = "UnknownTransactionCommitResult"
+	txRetryTimeout                 = 120 * time.Second // the same as session.WithTransaction
+)
+
+// TransactionStats counts outcomes of a transaction operation, retries are by
+// TransientTransactionError and unknown commits by UnknownTransactionCommitResult
+type TransactionStats struct {
+	Aborts         int64 `bson:"aborts" json:"aborts"`
+	Commits        int64 `bson:"commits" json:"commits"`
+	Retries        int64 `bson:"retries" json:"retries"`
+	UnknownCommits int64 `bson:"unknownCommits" json:"unknownCommits"`
+}
+
+// transactionCounter keeps transaction stats by operation names
+type transactionCounter struct {
+	mutex sync.Mutex
+	stats map[string]*TransactionStats
+}
+
+// add adds outcomes of a transaction
+func (tc *transactionCounter) add(name string, outcome TransactionStats) {
+	tc.mutex.Lock()
+	defer tc.mutex.Unlock()
+	if tc.stats == nil {
+		tc.stats = map[string]*TransactionStats{}
+	}
+	stats := tc.stats[name]
+	if stats == nil {
+		stats = &TransactionStats{}
+		tc.stats[name] = stats
+	}
+	stats.Aborts += outcome.Aborts
+	stats.Commits += outcome.Commits
+	stats.Retries += outcome.Retries
+	stats.UnknownCommits += outcome.UnknownCommits
+}
+
+// get returns a copy of transaction stats
+func (tc *transactionCounter) get() map[string]TransactionStats {
+	tc.mutex.Lock()
+	defer tc.mutex.Unlock()
+	stats := map[string]TransactionStats{}
+	for name, s := range tc.stats {
+		stats[name] = *s
+	}
+	return stats
+}
+
+// getTransactionOptions returns read and write concerns of a transaction operation
+func getTransactionOptions(op *WorkloadOp) (*options.TransactionOptions, error) {
+	opts := options.Transaction()
+	if op.ReadConcern != "" {
+		opts.SetReadConcern(readconcern.New(readconcern.Level(op.ReadConcern)))
+	}
+	if op.WriteConcern == "majority" {
+		opts.SetWriteConcern(writeconcern.New(writeconcern.WMajority()))
+	} else if op.WriteConcern != "" {
+		w, err := strconv.Atoi(op.WriteConcern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid writeConcern %v", op.WriteConcern)
+		}
+		opts.SetWriteConcern(writeconcern.New(writeconcern.W(w)))
+	}
+	return opts, nil
+}
+
+// hasErrorLabel returns true if an error has a label
+func hasErrorLabel(err error, label string) bool {
+	var le mongo.LabeledError
+	return errors.As(err, &le) && le.HasErrorLabel(label)
+}
+
+// execTransaction executes steps of an operation in a transaction.  It follows the
+// retry rules of session.WithTransaction but counts each outcome.
+func (r *workloadRunner) execTransaction(op *WorkloadOp, simDoc bson.M) error {
+	var outcome TransactionStats
+	ctx := context.Background()
+	opts, err := getTransactionOptions(op)
+	if err != nil {
+		return err
+	}
+	session, err := r.client.StartSession()
+	if err != nil {
+		return err
+	}
+	defer session.EndSession(ctx)
+	defer func() { r.workload.transactions.add(op.Name, outcome) }()
+	begin := time.Now()
+	for {
+		if err = session.StartTransaction(opts); err != nil {
+			return err
+		}
+		err = mongo.WithSession(ctx, session, func(sc mongo.SessionContext) error {
+			for i := range op.Steps {
+				if err := r.exec(sc, &op.Steps[i], simDoc); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			session.AbortTransaction(ctx)
+			if hasErrorLabel(err, transientTransactionError) && time.Since(begin) < txRetryTimeout {
+				outcome.Retries++
+				continue
+			}
+			outcome.Aborts++
+			return err
+		}
+		for {
+			if err = session.CommitTransaction(ctx); err == nil {
+				outcome.Commits++
+				return nil
+			}
+			if hasErrorLabel(err, unknownTransactionCommitResult) && time.Since(begin) < txRetryTimeout {
+				outcome.UnknownCommits++
+				continue
+			}
+			break
+		}
+		if hasErrorLabel(err, transientTransactionError) && time.Since(begin) < txRetryTimeout {
+			outcome.Retries++
+			continue
+		}
+		outcome.Aborts++
+		return err
+	}
+}
+
+// printTransactionsSummary returns transaction outcomes by operations, empty if none
+func (w *Workload) printTransactionsSummary() string {
+	stats := w.transactions.get()
+	if len(stats) == 0 {
+		return ""
+	}
+	names := []string{}
+	for name := range stats {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var buffer bytes.Buffer
+	buffer.WriteString("\nTransactions\n")
+	buffer.WriteString("+----------------------+----------+----------+----------+----------+\n")
+	buffer.WriteString("| Operation            | Commits  | Retries  | Unknown  |  Aborts  |\n")
+	buffer.WriteString("|----------------------+----------+----------+----------+----------|\n")
+	for _, name := range names {
+		s := stats[name]
+		label := name
+		if len(label) > 20 {
+			label = label[:17] + "..."
+		}
+		buffer.WriteString(fmt.Sprintf("| %-20v %10d %10d %10d %10d |\n", label, s.Commits, s.Retries, s.UnknownCommits, s.Aborts))
+	}
+	buffer.WriteString("+----------------------+----------+----------+----------+----------+\n")
+	buffer.WriteString("Retries: TransientTransactionError, Unknown: UnknownTransactionCommitResult\n")
+	return buffer.String()
+}
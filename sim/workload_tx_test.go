@@ -0,0 +1,63 @@
+// Copyright 2020-present Kuei-chun Chen. All rights reserved.
+
+package sim
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+func TestTransactionWorkload(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "workload.json")
+	data := []byte(`{"name": "transfer", "operations": [
+		{"c": "transaction", "name": "transfer", "readConcern": "snapshot", "writeConcern": "majority", "steps": [
+			{"c": "updateOne", "ns": "accounts", "filter": {"_id": "$zipf"}, "op": {"$inc": {"balance": -10}}},
+			{"c": "updateOne", "ns": "accounts", "filter": {"_id": "$zipf"}, "op": {"$inc": {"balance": 10}}},
+			{"c": "insertOne", "ns": "transfers", "doc": {"amount": 10}}]},
+		{"c": "findOne", "ns": "accounts", "filter": {"_id": "$zipf"}}]}`)
+	os.WriteFile(filename, data, 0644)
+	w, err := GetWorkload(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.init("keyhole", "examples")
+	if w.Operations[0].Steps[2].NS != "keyhole.transfers" || w.Operations[0].Name != "transfer" {
+		t.Fatal("unexpected transaction", w.Operations[0])
+	}
+
+	for _, str := range []string{`{"operations": [{"c": "transaction"}]}`,
+		`{"operations": [{"c": "transaction", "steps": [{"c": "transaction"}]}]}`,
+		`{"operations": [{"c": "transaction", "writeConcern": "all", "steps": [{"c": "findOne"}]}]}`} {
+		os.WriteFile(filename, []byte(str), 0644)
+		if _, err = GetWorkload(filename); err == nil {
+			t.Fatal("expected error", str)
+		}
+	}
+
+	transient := mongo.CommandError{Labels: []string{transientTransactionError}}
+	if !hasErrorLabel(fmt.Errorf("wrapped: %w", transient), transientTransactionError) ||
+		hasErrorLabel(transient, unknownTransactionCommitResult) || hasErrorLabel(errors.New("x"), transientTransactionError) {
+		t.Fatal("unexpected error labels")
+	}
+
+	w.transactions.add("transfer", TransactionStats{Commits: 1, Retries: 2})
+	w.transactions.add("transfer", TransactionStats{Aborts: 1, UnknownCommits: 1})
+	if stats := w.transactions.get()["transfer"]; stats.Commits != 1 || stats.Retries != 2 || stats.Aborts != 1 || stats.UnknownCommits != 1 {
+		t.Fatal("unexpected stats", stats)
+	}
+	results := newLoadResults(time.Now())
+	results.transactions = &w.transactions
+	if report := results.GetReport(); report.Transactions["transfer"].Commits != 1 {
+		t.Fatal("expected transactions in the report", report.Transactions)
+	}
+	if str := w.printTransactionsSummary(); !strings.Contains(str, "| transfer                      1          2          1          1 |") {
+		t.Fatal("unexpected summary", str)
+	}
+}